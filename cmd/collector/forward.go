@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/UDL-TF/UnitedStats/internal/collector"
+	"github.com/UDL-TF/UnitedStats/internal/queue"
+)
+
+// forwardTargetConfig is one entry of the forward configuration file
+type forwardTargetConfig struct {
+	Name       string   `json:"name"`
+	Type       string   `json:"type"` // "amqp", "udp" or "file"
+	URL        string   `json:"url,omitempty"`
+	Address    string   `json:"address,omitempty"`
+	Path       string   `json:"path,omitempty"`
+	EventTypes []string `json:"event_types,omitempty"`
+	Servers    []string `json:"servers,omitempty"`
+	Raw        bool     `json:"raw,omitempty"`
+	QueueSize  int      `json:"queue_size,omitempty"`
+}
+
+// loadForwardTargets reads a forward configuration file of the form
+//
+//	{"targets": [
+//	  {"name": "staging", "type": "amqp", "url": "amqp://...", "event_types": ["kill"]},
+//	  {"name": "hlstatsx", "type": "udp", "address": "10.0.0.5:27500", "raw": true},
+//	  {"name": "archive", "type": "file", "path": "/var/log/unitedstats/events.ndjson"}
+//	]}
+//
+// and opens each sink. The returned closers close the sinks.
+func loadForwardTargets(path string, logger watermill.LoggerAdapter) ([]collector.ForwardTarget, []io.Closer, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- path comes from operator configuration
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read forward config: %w", err)
+	}
+
+	var file struct {
+		Targets []forwardTargetConfig `json:"targets"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse forward config: %w", err)
+	}
+
+	var targets []collector.ForwardTarget
+	var closers []io.Closer
+	closeAll := func() {
+		for _, closer := range closers {
+			_ = closer.Close()
+		}
+	}
+
+	names := make(map[string]bool)
+	for i, cfg := range file.Targets {
+		if cfg.Name == "" {
+			closeAll()
+			return nil, nil, fmt.Errorf("target %d: missing name", i)
+		}
+		if names[cfg.Name] {
+			closeAll()
+			return nil, nil, fmt.Errorf("target %s: duplicate name", cfg.Name)
+		}
+		names[cfg.Name] = true
+
+		sink, closer, err := openSink(cfg, logger)
+		if err != nil {
+			closeAll()
+			return nil, nil, fmt.Errorf("target %s: %w", cfg.Name, err)
+		}
+		closers = append(closers, closer)
+
+		targets = append(targets, collector.ForwardTarget{
+			Name:       cfg.Name,
+			Sink:       sink,
+			EventTypes: cfg.EventTypes,
+			Servers:    cfg.Servers,
+			Raw:        cfg.Raw,
+			QueueSize:  cfg.QueueSize,
+		})
+	}
+
+	return targets, closers, nil
+}
+
+// openSink opens the sink of a forward target
+func openSink(cfg forwardTargetConfig, logger watermill.LoggerAdapter) (collector.Sink, io.Closer, error) {
+	switch cfg.Type {
+	case "amqp":
+		if cfg.Raw {
+			return nil, nil, errors.New("raw targets cannot be amqp")
+		}
+		publisher, err := queue.NewPublisher(queue.Config{URL: cfg.URL, Logger: logger})
+		if err != nil {
+			return nil, nil, err
+		}
+		return &collector.PublisherSink{Publisher: publisher}, publisher, nil
+
+	case "udp":
+		sink, err := collector.DialUDPSink(cfg.Address)
+		if err != nil {
+			return nil, nil, err
+		}
+		return sink, sink, nil
+
+	case "file":
+		sink, err := collector.OpenFileSink(cfg.Path)
+		if err != nil {
+			return nil, nil, err
+		}
+		return sink, sink, nil
+
+	default:
+		return nil, nil, fmt.Errorf("unknown type %q", cfg.Type)
+	}
+}
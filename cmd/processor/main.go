@@ -4,14 +4,18 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/ThreeDotsLabs/watermill"
 	"github.com/UDL-TF/UnitedStats/internal/processor"
 	"github.com/UDL-TF/UnitedStats/internal/queue"
 	"github.com/UDL-TF/UnitedStats/internal/store"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func main() {
@@ -25,16 +29,31 @@ func main() {
 	dbUser := getEnv("DB_USER", "unitedstats")
 	dbPassword := getEnv("DB_PASSWORD", "unitedstats")
 	dbName := getEnv("DB_NAME", "unitedstats")
+	maxAttempts := getEnvInt("MAX_ATTEMPTS", 5)
+	retryBackoffMS := getEnvInt("RETRY_BACKOFF_MS", 100)
+	maxRetryBackoffSeconds := getEnvInt("MAX_RETRY_BACKOFF_SECONDS", 10)
+	handlerTimeoutSeconds := getEnvInt("HANDLER_TIMEOUT_SECONDS", 30)
+	drainTimeoutSeconds := getEnvInt("DRAIN_TIMEOUT_SECONDS", 30)
+	maxMessagesPerSecond := getEnvInt("MAX_MESSAGES_PER_SECOND", 0)
+	metricsPort := getEnvInt("METRICS_PORT", 9102)
+	reorderWindowMS := getEnvInt("REORDER_WINDOW_MS", 0)
+	maxPendingEvents := getEnvInt("MAX_PENDING_EVENTS", 10000)
+
+	queueDriver, err := queue.ParseDriver(getEnv("QUEUE_DRIVER", string(queue.DriverAMQP)))
+	if err != nil {
+		log.Fatalf("Invalid QUEUE_DRIVER: %v", err)
+	}
 
 	// Create database store
-	st, err := store.New(store.Config{
+	storeConfig := store.Config{
 		Host:     dbHost,
 		Port:     dbPort,
 		User:     dbUser,
 		Password: dbPassword,
 		DBName:   dbName,
 		SSLMode:  "disable",
-	})
+	}
+	st, err := store.New(storeConfig)
 	if err != nil {
 		log.Fatalf("Failed to create store: %v", err)
 	}
@@ -46,9 +65,16 @@ func main() {
 
 	log.Println("Database connection established")
 
-	// Create RabbitMQ subscriber
+	// The sql queue lives in the stats database unless QUEUE_URL says otherwise
+	queueURL := getEnv("QUEUE_URL", rabbitmqURL)
+	if queueDriver == queue.DriverSQL {
+		queueURL = getEnv("QUEUE_URL", storeConfig.ConnString())
+	}
+
+	// Create queue subscriber
 	subscriber, err := queue.NewSubscriber(queue.Config{
-		URL:    rabbitmqURL,
+		Driver: queueDriver,
+		URL:    queueURL,
 		Logger: logger,
 	})
 	if err != nil {
@@ -60,11 +86,62 @@ func main() {
 		}
 	}()
 
+	// Quarantined messages are announced on the poison topic
+	publisher, err := queue.NewPublisher(queue.Config{
+		Driver: queueDriver,
+		URL:    queueURL,
+		Logger: logger,
+	})
+	if err != nil {
+		log.Fatalf("Failed to create publisher: %v", err)
+	}
+	defer func() {
+		if err := publisher.Close(); err != nil {
+			log.Printf("Error closing publisher: %v", err)
+		}
+	}()
+
+	// Serve handler metrics for Prometheus
+	var metrics prometheus.Registerer
+	if metricsPort > 0 {
+		registry := prometheus.NewRegistry()
+		metrics = registry
+		go func() {
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+			server := &http.Server{
+				Addr:              fmt.Sprintf(":%d", metricsPort),
+				Handler:           mux,
+				ReadHeaderTimeout: 10 * time.Second,
+			}
+			if err := server.ListenAndServe(); err != nil {
+				log.Printf("Metrics server error: %v", err)
+			}
+		}()
+	}
+
+	// Ordered processing acknowledges events before they are processed
+	if reorderWindowMS > 0 {
+		log.Printf("Reordering events within %dms; up to %d buffered events are lost if the processor crashes\n", reorderWindowMS, maxPendingEvents)
+	}
+
 	// Create processor
 	proc := processor.New(processor.Config{
 		Store:      st,
 		Subscriber: subscriber,
+		Publisher:  publisher,
 		Logger:     logger,
+		Retry: processor.RetryConfig{
+			MaxAttempts:    maxAttempts,
+			InitialBackoff: time.Duration(retryBackoffMS) * time.Millisecond,
+			MaxBackoff:     time.Duration(maxRetryBackoffSeconds) * time.Second,
+		},
+		HandlerTimeout: time.Duration(handlerTimeoutSeconds) * time.Second,
+		DrainTimeout:   time.Duration(drainTimeoutSeconds) * time.Second,
+		Throttle:       int64(maxMessagesPerSecond),
+		Metrics:        metrics,
+		ReorderWindow:  time.Duration(reorderWindowMS) * time.Millisecond,
+		MaxPending:     maxPendingEvents,
 	})
 
 	// Start processor
@@ -81,7 +158,7 @@ func main() {
 		cancel()
 	}()
 
-	log.Println("Starting event processor...")
+	log.Printf("Starting event processor (queue driver: %s)...\n", queueDriver)
 	if err := proc.Start(ctx); err != nil {
 		log.Printf("Processor error: %v", err)
 	}
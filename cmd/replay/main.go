@@ -0,0 +1,87 @@
+// Command replay sends a collector capture file back to a collector.
+//
+//	replay [-addr host:port] [-speed N] capture.bin
+//
+// With -speed 1 datagrams are sent at their original timing, with -speed N at
+// N times that rate, and with -speed 0 as fast as possible.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"time"
+
+	"github.com/UDL-TF/UnitedStats/internal/capture"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:27500", "collector UDP address")
+	speed := flag.Float64("speed", 1, "playback speed multiplier, 0 sends as fast as possible")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] <capture file>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 || *speed < 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := replay(flag.Arg(0), *addr, *speed); err != nil {
+		log.Fatalf("Replay failed: %v", err)
+	}
+}
+
+// replay sends every datagram of a capture file to addr
+func replay(path, addr string, speed float64) error {
+	reader, err := capture.Open(path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to collector: %w", err)
+	}
+	defer conn.Close()
+
+	var first time.Time
+	start := time.Now()
+	sent := 0
+
+	for {
+		record, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read record %d: %w", sent+1, err)
+		}
+
+		// Keep each datagram's offset from the first one, scaled by speed
+		if speed > 0 {
+			if first.IsZero() {
+				first = record.Time
+			}
+			offset := time.Duration(float64(record.Time.Sub(first)) / speed)
+			if wait := time.Until(start.Add(offset)); wait > 0 {
+				time.Sleep(wait)
+			}
+		}
+
+		if _, err := conn.Write(record.Payload); err != nil {
+			return fmt.Errorf("failed to send record %d: %w", sent+1, err)
+		}
+		sent++
+	}
+
+	log.Printf("Replayed %d datagrams to %s in %s\n", sent, addr, time.Since(start).Round(time.Millisecond))
+	return nil
+}
@@ -2,12 +2,16 @@ package api
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 	"time"
 
+	"github.com/UDL-TF/UnitedStats/internal/parser"
 	"github.com/UDL-TF/UnitedStats/internal/store"
+	"github.com/UDL-TF/UnitedStats/pkg/steamid"
 	"github.com/gin-gonic/gin"
 )
 
@@ -71,6 +75,17 @@ func (a *API) setupRoutes() {
 	stats := v1.Group("/stats")
 	stats.GET("/overview", a.getStatsOverview)
 	stats.GET("/weapons", a.getWeaponStats)
+
+	// Servers
+	servers := v1.Group("/servers")
+	servers.GET("/compatibility", a.getServerCompatibility)
+
+	// Payloads rejected by the collector
+	v1.GET("/invalid-events", a.getInvalidEvents)
+
+	// Messages the processor quarantined (fixed and requeued with cmd/quarantine)
+	v1.GET("/poison-messages", a.getPoisonMessages)
+	v1.GET("/poison-messages/:id", a.getPoisonMessage)
 }
 
 // Start starts the API server
@@ -132,13 +147,28 @@ func (a *API) getLeaderboard(c *gin.Context) {
 	})
 }
 
+// playerFromParam looks up the player named by the steam_id path parameter,
+// in any SteamID format. If there is none it responds with the error and
+// returns nil.
+func (a *API) playerFromParam(c *gin.Context) *store.Player {
+	player, err := a.store.GetPlayerBySteamID(c.Request.Context(), c.Param("steam_id"))
+	switch {
+	case err == nil:
+		return player
+	case errors.Is(err, steamid.ErrInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid SteamID"})
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Player not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch player"})
+	}
+	return nil
+}
+
 // getPlayer returns player information
 func (a *API) getPlayer(c *gin.Context) {
-	steamID := c.Param("steam_id")
-
-	player, err := a.store.GetPlayerBySteamID(c.Request.Context(), steamID)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Player not found"})
+	player := a.playerFromParam(c)
+	if player == nil {
 		return
 	}
 
@@ -149,11 +179,8 @@ func (a *API) getPlayer(c *gin.Context) {
 
 // getPlayerStats returns detailed player statistics
 func (a *API) getPlayerStats(c *gin.Context) {
-	steamID := c.Param("steam_id")
-
-	player, err := a.store.GetPlayerBySteamID(c.Request.Context(), steamID)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Player not found"})
+	player := a.playerFromParam(c)
+	if player == nil {
 		return
 	}
 
@@ -186,7 +213,6 @@ func (a *API) getPlayerStats(c *gin.Context) {
 
 // getPlayerMatches returns a player's match history
 func (a *API) getPlayerMatches(c *gin.Context) {
-	steamID := c.Param("steam_id")
 	limit := 20
 	offset := 0
 
@@ -206,9 +232,8 @@ func (a *API) getPlayerMatches(c *gin.Context) {
 		limit = 100
 	}
 
-	player, err := a.store.GetPlayerBySteamID(c.Request.Context(), steamID)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Player not found"})
+	player := a.playerFromParam(c)
+	if player == nil {
 		return
 	}
 
@@ -331,3 +356,140 @@ func (a *API) getWeaponStats(c *gin.Context) {
 		"count":   len(stats),
 	})
 }
+
+// getInvalidEvents returns payloads the collector rejected, optionally for one server
+func (a *API) getInvalidEvents(c *gin.Context) {
+	limit := 50
+	offset := 0
+
+	if limitStr := c.DefaultQuery("limit", "50"); limitStr != "" {
+		if val, err := strconv.Atoi(limitStr); err == nil {
+			limit = val
+		}
+	}
+
+	if offsetStr := c.DefaultQuery("offset", "0"); offsetStr != "" {
+		if val, err := strconv.Atoi(offsetStr); err == nil {
+			offset = val
+		}
+	}
+
+	if limit > 200 {
+		limit = 200
+	}
+
+	serverIP := c.Query("server_ip")
+
+	invalid, err := a.store.GetInvalidEvents(c.Request.Context(), serverIP, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invalid events"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"invalid_events": invalid,
+		"count":          len(invalid),
+		"limit":          limit,
+		"offset":         offset,
+	})
+}
+
+// getPoisonMessages returns quarantined messages, optionally by status and topic
+func (a *API) getPoisonMessages(c *gin.Context) {
+	limit := 50
+	offset := 0
+
+	if limitStr := c.DefaultQuery("limit", "50"); limitStr != "" {
+		if val, err := strconv.Atoi(limitStr); err == nil {
+			limit = val
+		}
+	}
+
+	if offsetStr := c.DefaultQuery("offset", "0"); offsetStr != "" {
+		if val, err := strconv.Atoi(offsetStr); err == nil {
+			offset = val
+		}
+	}
+
+	if limit > 200 {
+		limit = 200
+	}
+
+	status := c.Query("status")
+	topic := c.Query("topic")
+
+	poison, err := a.store.GetPoisonMessages(c.Request.Context(), status, topic, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch poison messages"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"poison_messages": poison,
+		"count":           len(poison),
+		"limit":           limit,
+		"offset":          offset,
+	})
+}
+
+// getPoisonMessage returns a quarantined message by ID
+func (a *API) getPoisonMessage(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid poison message ID"})
+		return
+	}
+
+	poison, err := a.store.GetPoisonMessage(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Poison message not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"poison_message": poison,
+	})
+}
+
+// serverCompatibility reports the plugin a server currently runs and how its
+// payloads are handled
+type serverCompatibility struct {
+	ServerIP      string                 `json:"server_ip"`
+	PluginVersion string                 `json:"plugin_version"`
+	SchemaVersion int                    `json:"schema_version"`
+	Status        string                 `json:"status"`
+	LastSeen      time.Time              `json:"last_seen"`
+	Versions      []*store.ServerVersion `json:"versions"`
+}
+
+// getServerCompatibility reports the plugin and schema version of each
+// server, optionally for one server
+func (a *API) getServerCompatibility(c *gin.Context) {
+	versions, err := a.store.GetServerVersions(c.Request.Context(), c.Query("server_ip"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch server versions"})
+		return
+	}
+
+	// Versions are grouped by server, most recently seen first
+	var servers []*serverCompatibility
+	for _, v := range versions {
+		if len(servers) == 0 || servers[len(servers)-1].ServerIP != v.ServerIP {
+			servers = append(servers, &serverCompatibility{
+				ServerIP:      v.ServerIP,
+				PluginVersion: v.PluginVersion,
+				SchemaVersion: v.SchemaVersion,
+				Status:        parser.Compatibility(v.SchemaVersion),
+				LastSeen:      v.LastSeen,
+			})
+		}
+		server := servers[len(servers)-1]
+		server.Versions = append(server.Versions, v)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"servers":                servers,
+		"count":                  len(servers),
+		"current_schema_version": parser.CurrentSchemaVersion,
+	})
+}
@@ -0,0 +1,218 @@
+// Package capture records raw collector traffic to a file and reads it back.
+//
+// A capture file starts with a magic header followed by one record per
+// datagram:
+//
+//	int64   receive time, Unix nanoseconds
+//	uint8   length of the source address
+//	[]byte  source address ("ip:port")
+//	uint32  length of the payload
+//	[]byte  payload as received
+//
+// Integers are big-endian. Files ending in .gz are gzip-compressed.
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// magic identifies capture files and their format version
+var magic = []byte("USCAP\x01\n")
+
+// maxPayloadSize guards against reading a corrupt length
+const maxPayloadSize = 1 << 20
+
+// ErrNotCapture is returned for files without the capture header
+var ErrNotCapture = errors.New("not a capture file")
+
+// Record is one captured datagram
+type Record struct {
+	Time    time.Time
+	Addr    string
+	Payload []byte
+}
+
+// Writer appends records to a capture file. It is safe for concurrent use.
+type Writer struct {
+	mu     sync.Mutex
+	file   *os.File
+	gz     *gzip.Writer
+	buf    *bufio.Writer
+	header [13]byte
+}
+
+// Create creates a capture file, compressing it when the name ends in .gz
+func Create(path string) (*Writer, error) {
+	file, err := os.Create(path) // #nosec G304 -- path comes from operator configuration
+	if err != nil {
+		return nil, fmt.Errorf("failed to create capture file: %w", err)
+	}
+
+	w := &Writer{file: file}
+
+	var out io.Writer = file
+	if strings.HasSuffix(path, ".gz") {
+		w.gz = gzip.NewWriter(file)
+		out = w.gz
+	}
+	w.buf = bufio.NewWriterSize(out, 64<<10)
+
+	if _, err := w.buf.Write(magic); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("failed to write capture header: %w", err)
+	}
+
+	return w, nil
+}
+
+// Write appends a record
+func (w *Writer) Write(r Record) error {
+	if len(r.Addr) > 255 {
+		return fmt.Errorf("address too long: %q", r.Addr)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	binary.BigEndian.PutUint64(w.header[:8], uint64(r.Time.UnixNano()))
+	w.header[8] = byte(len(r.Addr))
+	if _, err := w.buf.Write(w.header[:9]); err != nil {
+		return err
+	}
+	if _, err := w.buf.WriteString(r.Addr); err != nil {
+		return err
+	}
+
+	binary.BigEndian.PutUint32(w.header[9:13], uint32(len(r.Payload)))
+	if _, err := w.buf.Write(w.header[9:13]); err != nil {
+		return err
+	}
+	_, err := w.buf.Write(r.Payload)
+	return err
+}
+
+// Flush writes buffered records to the file
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+	if w.gz != nil {
+		return w.gz.Flush()
+	}
+	return nil
+}
+
+// Close flushes and closes the capture file
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.buf.Flush(); err != nil {
+		_ = w.file.Close()
+		return err
+	}
+	if w.gz != nil {
+		if err := w.gz.Close(); err != nil {
+			_ = w.file.Close()
+			return err
+		}
+	}
+	return w.file.Close()
+}
+
+// Reader reads records from a capture file
+type Reader struct {
+	file   io.Closer
+	r      *bufio.Reader
+	header [13]byte
+}
+
+// Open opens a capture file for reading
+func Open(path string) (*Reader, error) {
+	file, err := os.Open(path) // #nosec G304 -- path comes from the command line
+	if err != nil {
+		return nil, fmt.Errorf("failed to open capture file: %w", err)
+	}
+
+	r, err := NewReader(file)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	r.file = file
+
+	return r, nil
+}
+
+// NewReader reads records from in, which may be gzip-compressed
+func NewReader(in io.Reader) (*Reader, error) {
+	r := &Reader{r: bufio.NewReaderSize(in, 64<<10)}
+
+	// gzip streams start with 0x1f 0x8b
+	if prefix, err := r.r.Peek(2); err == nil && prefix[0] == 0x1f && prefix[1] == 0x8b {
+		gz, err := gzip.NewReader(r.r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open gzip stream: %w", err)
+		}
+		r.r = bufio.NewReaderSize(gz, 64<<10)
+	}
+
+	header := make([]byte, len(magic))
+	if _, err := io.ReadFull(r.r, header); err != nil || !bytes.Equal(header, magic) {
+		return nil, ErrNotCapture
+	}
+
+	return r, nil
+}
+
+// Next returns the next record, or io.EOF at the end of the capture
+func (r *Reader) Next() (Record, error) {
+	if _, err := io.ReadFull(r.r, r.header[:9]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return Record{}, fmt.Errorf("truncated record: %w", err)
+		}
+		return Record{}, err
+	}
+
+	nanos := int64(binary.BigEndian.Uint64(r.header[:8]))
+	addr := make([]byte, r.header[8])
+	if _, err := io.ReadFull(r.r, addr); err != nil {
+		return Record{}, fmt.Errorf("truncated record: %w", err)
+	}
+
+	if _, err := io.ReadFull(r.r, r.header[9:13]); err != nil {
+		return Record{}, fmt.Errorf("truncated record: %w", err)
+	}
+	size := binary.BigEndian.Uint32(r.header[9:13])
+	if size > maxPayloadSize {
+		return Record{}, fmt.Errorf("corrupt record: payload of %d bytes", size)
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r.r, payload); err != nil {
+		return Record{}, fmt.Errorf("truncated record: %w", err)
+	}
+
+	return Record{Time: time.Unix(0, nanos), Addr: string(addr), Payload: payload}, nil
+}
+
+// Close closes the underlying file when the reader was opened with Open
+func (r *Reader) Close() error {
+	if r.file == nil {
+		return nil
+	}
+	return r.file.Close()
+}
@@ -0,0 +1,91 @@
+package capture
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestRoundTrip tests that records are read back exactly as written
+func TestRoundTrip(t *testing.T) {
+	records := []Record{
+		{Time: time.Unix(1706788800, 123456789), Addr: "10.0.0.1:27015", Payload: []byte(`{"event_type":"kill"}`)},
+		{Time: time.Unix(1706788800, 500000000), Addr: "[2001:db8::1]:27015", Payload: []byte{0xff, 0xff, 0xff, 0xff, 'R', 'L'}},
+		{Time: time.Unix(1706788801, 0), Addr: "10.0.0.2:27015", Payload: []byte{}},
+	}
+
+	for _, name := range []string{"traffic.bin", "traffic.bin.gz"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+
+			w, err := Create(path)
+			if err != nil {
+				t.Fatalf("Create() error = %v", err)
+			}
+			for _, record := range records {
+				if err := w.Write(record); err != nil {
+					t.Fatalf("Write() error = %v", err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+
+			r, err := Open(path)
+			if err != nil {
+				t.Fatalf("Open() error = %v", err)
+			}
+			defer r.Close()
+
+			for i, want := range records {
+				got, err := r.Next()
+				if err != nil {
+					t.Fatalf("Next() record %d error = %v", i, err)
+				}
+				if !got.Time.Equal(want.Time) || got.Addr != want.Addr || !bytes.Equal(got.Payload, want.Payload) {
+					t.Errorf("Next() record %d = %+v, want %+v", i, got, want)
+				}
+			}
+			if _, err := r.Next(); !errors.Is(err, io.EOF) {
+				t.Errorf("Next() after last record error = %v, want io.EOF", err)
+			}
+		})
+	}
+}
+
+// TestReaderErrors tests that foreign and damaged files are rejected
+func TestReaderErrors(t *testing.T) {
+	if _, err := NewReader(strings.NewReader("L 02/01/2024 - 12:00:00: log line\n")); !errors.Is(err, ErrNotCapture) {
+		t.Errorf("NewReader() on a log file error = %v, want ErrNotCapture", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "traffic.bin")
+	w, err := Create(path)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if err := w.Write(Record{Time: time.Now(), Addr: "10.0.0.1:27015", Payload: []byte("payload")}); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	// Cut the file in the middle of the payload, as a crash would
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	r, err := NewReader(bytes.NewReader(data[:len(data)-3]))
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+	if _, err := r.Next(); err == nil || errors.Is(err, io.EOF) {
+		t.Errorf("Next() on a truncated record error = %v, want truncation error", err)
+	}
+}
@@ -0,0 +1,247 @@
+package collector
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// signatureVersion prefixes every signed packet header
+const signatureVersion = "US1"
+
+// maxServerIDLength matches the width of the server_ip columns in the database
+const maxServerIDLength = 45
+
+// Authentication errors
+var (
+	ErrUnsigned        = errors.New("packet is not signed")
+	ErrMalformedHeader = errors.New("malformed signature header")
+	ErrUnknownServer   = errors.New("unknown server")
+	ErrBadSignature    = errors.New("signature mismatch")
+	ErrStaleTimestamp  = errors.New("timestamp outside allowed window")
+	ErrReplay          = errors.New("replayed packet")
+)
+
+// ServerIdentity is a game server registered with the collector
+type ServerIdentity struct {
+	ID     string `json:"id"`
+	Name   string `json:"name,omitempty"`
+	Secret string `json:"secret"`
+	// LogSecret is the server's sv_logsecret, used to identify native log packets
+	LogSecret string `json:"log_secret,omitempty"`
+}
+
+// Registry holds the registered game servers and their shared secrets
+type Registry struct {
+	servers    map[string]*ServerIdentity
+	logSecrets map[string]*ServerIdentity
+}
+
+// NewRegistry creates a registry from a list of servers
+func NewRegistry(servers []ServerIdentity) (*Registry, error) {
+	r := &Registry{
+		servers:    make(map[string]*ServerIdentity, len(servers)),
+		logSecrets: make(map[string]*ServerIdentity),
+	}
+
+	for i := range servers {
+		server := servers[i]
+
+		if server.ID == "" {
+			return nil, fmt.Errorf("server %d: missing id", i)
+		}
+		if len(server.ID) > maxServerIDLength {
+			return nil, fmt.Errorf("server %s: id longer than %d characters", server.ID, maxServerIDLength)
+		}
+		if server.Secret == "" {
+			return nil, fmt.Errorf("server %s: missing secret", server.ID)
+		}
+		if _, exists := r.servers[server.ID]; exists {
+			return nil, fmt.Errorf("server %s: duplicate id", server.ID)
+		}
+
+		if server.LogSecret != "" {
+			if _, exists := r.logSecrets[server.LogSecret]; exists {
+				return nil, fmt.Errorf("server %s: duplicate log_secret", server.ID)
+			}
+			r.logSecrets[server.LogSecret] = &server
+		}
+
+		r.servers[server.ID] = &server
+	}
+
+	return r, nil
+}
+
+// LoadRegistry reads a registry file of the form
+//
+//	{"servers": [{"id": "eu-1", "name": "UDL EU #1", "secret": "...", "log_secret": "..."}]}
+func LoadRegistry(path string) (*Registry, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- path comes from operator configuration
+	if err != nil {
+		return nil, fmt.Errorf("failed to read server registry: %w", err)
+	}
+
+	var file struct {
+		Servers []ServerIdentity `json:"servers"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse server registry: %w", err)
+	}
+
+	return NewRegistry(file.Servers)
+}
+
+// Lookup returns the server registered under id
+func (r *Registry) Lookup(id string) (*ServerIdentity, bool) {
+	server, ok := r.servers[id]
+	return server, ok
+}
+
+// LookupLogSecret returns the server whose sv_logsecret is secret
+func (r *Registry) LookupLogSecret(secret string) (*ServerIdentity, bool) {
+	server, ok := r.logSecrets[secret]
+	return server, ok
+}
+
+// Len returns the number of registered servers
+func (r *Registry) Len() int {
+	return len(r.servers)
+}
+
+// Authenticator verifies signed packets against the server registry.
+//
+// A signed packet starts with a single header line followed by the body:
+//
+//	US1 <server_id> <unix_timestamp> <nonce> <hex_hmac_sha256>\n<body>
+//
+// The HMAC is computed with the server's secret over the version, server ID,
+// timestamp, nonce and body joined by newlines (see Sign). The SourceMod
+// plugin signs its packets once sm_unitedstats_server_id and
+// sm_unitedstats_secret are set to the server's registry entry.
+type Authenticator struct {
+	registry *Registry
+	maxSkew  time.Duration
+	now      func() time.Time
+
+	mu        sync.Mutex
+	seen      map[string]time.Time // server_id + nonce -> expiry
+	lastSweep time.Time
+}
+
+// NewAuthenticator creates an authenticator that accepts packets whose
+// timestamp is within maxSkew of the collector's clock
+func NewAuthenticator(registry *Registry, maxSkew time.Duration) *Authenticator {
+	if maxSkew <= 0 {
+		maxSkew = 30 * time.Second
+	}
+
+	return &Authenticator{
+		registry: registry,
+		maxSkew:  maxSkew,
+		now:      time.Now,
+		seen:     make(map[string]time.Time),
+	}
+}
+
+// Verify checks the signature header of a packet and returns the verified
+// server together with the packet body
+func (a *Authenticator) Verify(data []byte) (*ServerIdentity, []byte, error) {
+	header, body, found := bytes.Cut(data, []byte("\n"))
+	if !found || !bytes.HasPrefix(header, []byte(signatureVersion+" ")) {
+		return nil, nil, ErrUnsigned
+	}
+
+	fields := bytes.Fields(header)
+	if len(fields) != 5 {
+		return nil, nil, ErrMalformedHeader
+	}
+
+	serverID := string(fields[1])
+	timestamp := string(fields[2])
+	nonce := string(fields[3])
+
+	signature, err := hex.DecodeString(string(fields[4]))
+	if err != nil {
+		return nil, nil, ErrMalformedHeader
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, nil, ErrMalformedHeader
+	}
+
+	server, ok := a.registry.Lookup(serverID)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %s", ErrUnknownServer, serverID)
+	}
+
+	expected := computeSignature(server.Secret, serverID, timestamp, nonce, body)
+	if !hmac.Equal(signature, expected) {
+		return nil, nil, ErrBadSignature
+	}
+
+	now := a.now()
+	sentAt := time.Unix(unix, 0)
+	if sentAt.Before(now.Add(-a.maxSkew)) || sentAt.After(now.Add(a.maxSkew)) {
+		return nil, nil, ErrStaleTimestamp
+	}
+
+	if !a.markSeen(serverID+"\x00"+nonce, sentAt.Add(a.maxSkew), now) {
+		return nil, nil, ErrReplay
+	}
+
+	return server, body, nil
+}
+
+// markSeen records a nonce and reports whether it was new.
+// Nonces are remembered until their packet timestamp leaves the window.
+func (a *Authenticator) markSeen(key string, expiry, now time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if now.Sub(a.lastSweep) > a.maxSkew {
+		for k, exp := range a.seen {
+			if now.After(exp) {
+				delete(a.seen, k)
+			}
+		}
+		a.lastSweep = now
+	}
+
+	if exp, ok := a.seen[key]; ok && !now.After(exp) {
+		return false
+	}
+
+	a.seen[key] = expiry
+	return true
+}
+
+// Sign prepends a signature header to body
+func Sign(serverID, secret string, timestamp time.Time, nonce string, body []byte) []byte {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	signature := hex.EncodeToString(computeSignature(secret, serverID, ts, nonce, body))
+
+	var buf bytes.Buffer
+	buf.Grow(len(body) + len(serverID) + len(nonce) + 96)
+	fmt.Fprintf(&buf, "%s %s %s %s %s\n", signatureVersion, serverID, ts, nonce, signature)
+	buf.Write(body)
+
+	return buf.Bytes()
+}
+
+// computeSignature computes the HMAC-SHA256 of a packet
+func computeSignature(secret, serverID, timestamp, nonce string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signatureVersion + "\n" + serverID + "\n" + timestamp + "\n" + nonce + "\n"))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
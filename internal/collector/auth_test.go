@@ -0,0 +1,194 @@
+package collector
+
+import (
+	"errors"
+	"os"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newTestAuthenticator(t *testing.T, now time.Time) *Authenticator {
+	t.Helper()
+
+	registry, err := NewRegistry([]ServerIdentity{
+		{ID: "eu-1", Name: "UDL EU #1", Secret: "s3cret"},
+	})
+	if err != nil {
+		t.Fatalf("NewRegistry() error = %v", err)
+	}
+
+	auth := NewAuthenticator(registry, 30*time.Second)
+	auth.now = func() time.Time { return now }
+	return auth
+}
+
+// TestAuthenticatorVerify tests signature verification
+func TestAuthenticatorVerify(t *testing.T) {
+	now := time.Unix(1706788800, 0)
+	body := []byte(`{"event_type":"kill"}`)
+
+	tests := []struct {
+		name    string
+		packet  []byte
+		wantErr error
+	}{
+		{
+			name:   "Valid signature",
+			packet: Sign("eu-1", "s3cret", now, "n1", body),
+		},
+		{
+			name:    "Unsigned packet",
+			packet:  body,
+			wantErr: ErrUnsigned,
+		},
+		{
+			name:    "Unknown server",
+			packet:  Sign("us-1", "s3cret", now, "n2", body),
+			wantErr: ErrUnknownServer,
+		},
+		{
+			name:    "Wrong secret",
+			packet:  Sign("eu-1", "wrong", now, "n3", body),
+			wantErr: ErrBadSignature,
+		},
+		{
+			name:    "Stale timestamp",
+			packet:  Sign("eu-1", "s3cret", now.Add(-time.Minute), "n4", body),
+			wantErr: ErrStaleTimestamp,
+		},
+		{
+			name:    "Future timestamp",
+			packet:  Sign("eu-1", "s3cret", now.Add(time.Minute), "n5", body),
+			wantErr: ErrStaleTimestamp,
+		},
+		{
+			name:    "Malformed header",
+			packet:  []byte("US1 eu-1 notanumber n6 abcd\n{}"),
+			wantErr: ErrMalformedHeader,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := newTestAuthenticator(t, now)
+
+			server, gotBody, err := auth.Verify(tt.packet)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if server.ID != "eu-1" {
+				t.Errorf("server.ID = %v, want eu-1", server.ID)
+			}
+			if string(gotBody) != string(body) {
+				t.Errorf("body = %s, want %s", gotBody, body)
+			}
+		})
+	}
+}
+
+// TestAuthenticatorTamperedBody tests that modifying the body invalidates the signature
+func TestAuthenticatorTamperedBody(t *testing.T) {
+	now := time.Unix(1706788800, 0)
+	auth := newTestAuthenticator(t, now)
+
+	packet := Sign("eu-1", "s3cret", now, "n1", []byte(`{"event_type":"kill","crit":false}`))
+	packet[len(packet)-6] = 't'
+
+	if _, _, err := auth.Verify(packet); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("Verify() error = %v, want %v", err, ErrBadSignature)
+	}
+}
+
+// TestAuthenticatorReplay tests that a nonce is only accepted once
+func TestAuthenticatorReplay(t *testing.T) {
+	now := time.Unix(1706788800, 0)
+	auth := newTestAuthenticator(t, now)
+
+	packet := Sign("eu-1", "s3cret", now, "n1", []byte(`{"event_type":"kill"}`))
+
+	if _, _, err := auth.Verify(packet); err != nil {
+		t.Fatalf("first Verify() error = %v", err)
+	}
+
+	if _, _, err := auth.Verify(packet); !errors.Is(err, ErrReplay) {
+		t.Errorf("second Verify() error = %v, want %v", err, ErrReplay)
+	}
+}
+
+// TestPluginSignature tests that the collector accepts the packet the plugin
+// signs for its known-answer vector, which the plugin checks itself against
+// when signing is enabled
+func TestPluginSignature(t *testing.T) {
+	source, err := os.ReadFile("../../sourcemod/scripting/include/superlogs-core.inc")
+	if err != nil {
+		t.Skipf("Skipping plugin test: %v", err)
+	}
+
+	vector := make(map[string]string)
+	for _, m := range regexp.MustCompile(`(?m)^#define SUPERLOGS_TEST_(\w+) (.+)$`).FindAllStringSubmatch(string(source), -1) {
+		value := m[2]
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		}
+		vector[m[1]] = value
+	}
+
+	unix, err := strconv.ParseInt(vector["TIMESTAMP"], 10, 64)
+	if err != nil {
+		t.Fatalf("SUPERLOGS_TEST_TIMESTAMP = %q: %v", vector["TIMESTAMP"], err)
+	}
+	sentAt := time.Unix(unix, 0)
+
+	registry, err := NewRegistry([]ServerIdentity{{ID: vector["SERVER_ID"], Secret: vector["SECRET"]}})
+	if err != nil {
+		t.Fatalf("NewRegistry() error = %v", err)
+	}
+	auth := NewAuthenticator(registry, 30*time.Second)
+	auth.now = func() time.Time { return sentAt }
+
+	packet := vector["PACKET"]
+	if want := string(Sign(vector["SERVER_ID"], vector["SECRET"], sentAt, vector["NONCE"], []byte(vector["BODY"]))); packet != want {
+		t.Fatalf("plugin packet = %q, want %q", packet, want)
+	}
+
+	server, body, err := auth.Verify([]byte(packet))
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if server.ID != vector["SERVER_ID"] {
+		t.Errorf("server.ID = %v, want %v", server.ID, vector["SERVER_ID"])
+	}
+	if string(body) != vector["BODY"] {
+		t.Errorf("body = %s, want %s", body, vector["BODY"])
+	}
+}
+
+// TestNewRegistryValidation tests registry validation
+func TestNewRegistryValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		servers []ServerIdentity
+	}{
+		{name: "Missing id", servers: []ServerIdentity{{Secret: "x"}}},
+		{name: "Missing secret", servers: []ServerIdentity{{ID: "eu-1"}}},
+		{name: "Duplicate id", servers: []ServerIdentity{{ID: "eu-1", Secret: "x"}, {ID: "eu-1", Secret: "y"}}},
+		{name: "Id too long", servers: []ServerIdentity{{ID: "this-server-id-is-far-too-long-to-fit-in-server-ip", Secret: "x"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewRegistry(tt.servers); err == nil {
+				t.Error("NewRegistry() error = nil, want error")
+			}
+		})
+	}
+}
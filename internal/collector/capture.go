@@ -0,0 +1,48 @@
+package collector
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/UDL-TF/UnitedStats/internal/capture"
+)
+
+// captureInterval is how often captured datagrams are flushed to disk
+const captureInterval = time.Second
+
+// capturePacket records a datagram exactly as it was received
+func (c *Collector) capturePacket(data []byte, addr *net.UDPAddr, receivedAt time.Time) {
+	err := c.capture.Write(capture.Record{
+		Time:    receivedAt,
+		Addr:    addr.String(),
+		Payload: data,
+	})
+	if err != nil {
+		c.counters.captureErrors.Add(1)
+		return
+	}
+	c.counters.captured.Add(1)
+}
+
+// flushCapture periodically flushes the capture file until the context is
+// cancelled. Write errors are counted rather than logged per packet.
+func (c *Collector) flushCapture(ctx context.Context) {
+	ticker := time.NewTicker(captureInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := c.capture.Flush(); err != nil {
+			c.logger.Error("Failed to flush capture file", err, watermill.LogFields{
+				"capture_errors": c.counters.captureErrors.Load(),
+			})
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package collector
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/UDL-TF/UnitedStats/internal/capture"
+)
+
+// TestCapturePackets tests that every datagram is captured, including ones the
+// collector rejects
+func TestCapturePackets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traffic.bin")
+	w, err := capture.Create(path)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	c := New(Config{
+		Publisher: &recordingPublisher{failAfter: -1},
+		Logger:    watermill.NopLogger{},
+		Capture:   w,
+		RateLimit: &RateLimitConfig{Source: Limit{Rate: 1, Burst: 1}},
+	})
+	c.addr = "127.0.0.1:0"
+	if err := c.listen(); err != nil {
+		t.Fatalf("listen() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- c.serve(ctx) }()
+
+	conn, err := net.Dial("udp", c.conn.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+
+	// The second and third payloads are throttled and invalid
+	payloads := [][]byte{benchmarkPayload, benchmarkPayload, []byte("not json")}
+	for _, payload := range payloads {
+		if _, err := conn.Write(payload); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for c.Stats().Captured < uint64(len(payloads)) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	r, err := capture.Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer r.Close()
+
+	for i, want := range payloads {
+		record, err := r.Next()
+		if err != nil {
+			t.Fatalf("Next() record %d error = %v", i, err)
+		}
+		if string(record.Payload) != string(want) {
+			t.Errorf("record %d payload = %q, want %q", i, record.Payload, want)
+		}
+		if record.Addr != conn.LocalAddr().String() {
+			t.Errorf("record %d addr = %q, want %q", i, record.Addr, conn.LocalAddr())
+		}
+	}
+}
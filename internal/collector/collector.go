@@ -2,13 +2,25 @@ package collector
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
+	"runtime"
+	"sync"
 	"time"
 
 	"github.com/ThreeDotsLabs/watermill"
 	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/UDL-TF/UnitedStats/internal/capture"
+	"github.com/UDL-TF/UnitedStats/internal/parser"
+)
+
+// Event errors
+var (
+	ErrInvalidJSON      = errors.New("invalid JSON")
+	ErrMissingEventType = errors.New("missing event_type")
 )
 
 // Collector receives UDP events from game servers and publishes them to the message queue
@@ -16,7 +28,49 @@ type Collector struct {
 	addr      string
 	conn      *net.UDPConn
 	publisher message.Publisher
+	auth      *Authenticator
 	logger    watermill.LoggerAdapter
+
+	readBuffer    int
+	workers       int
+	queue         chan packet
+	dropPolicy    DropPolicy
+	statsInterval time.Duration
+	counters      intakeCounters
+
+	spool         *Spool
+	spoolInterval time.Duration
+	statusAddr    string
+
+	chunks *Reassembler
+
+	limiter *RateLimiter
+
+	ingestTokens   map[string]string
+	maxIngestBytes int64
+
+	tcpAddr        string
+	tlsConfig      *tls.Config
+	tcpListener    net.Listener
+	tcpSlots       chan struct{}
+	tcpIdleTimeout time.Duration
+
+	logGamemode  string
+	logParsersMu sync.Mutex
+	logParsers   map[string]*parser.LogParser
+
+	capture *capture.Writer
+
+	heartbeats      *Heartbeats
+	lifecycleEvents bool
+
+	strict bool
+
+	skew *SkewEstimator
+
+	forwarders    []*forwarder
+	forwardEvents bool
+	forwardRaw    bool
 }
 
 // Config holds collector configuration
@@ -24,19 +78,184 @@ type Config struct {
 	UDPPort   int
 	Publisher message.Publisher
 	Logger    watermill.LoggerAdapter
+
+	// Registry enables packet authentication. When set, every packet must be
+	// signed by a registered server; unsigned packets are dropped.
+	Registry *Registry
+	// MaxClockSkew is how far a signed packet's timestamp may be from the
+	// collector's clock (default 30s)
+	MaxClockSkew time.Duration
+
+	// ReadBuffer is the socket receive buffer size in bytes (default 4MiB).
+	// It absorbs bursts while the read loop is busy.
+	ReadBuffer int
+	// Workers is the number of goroutines handling packets (default 2*NumCPU)
+	Workers int
+	// QueueSize is how many packets may wait for a worker (default 4096)
+	QueueSize int
+	// DropPolicy decides what happens when the queue is full (default DropNewest)
+	DropPolicy DropPolicy
+	// StatsInterval is how often intake counters are logged (default 1m)
+	StatsInterval time.Duration
+
+	// RateLimit enables flood protection when set
+	RateLimit *RateLimitConfig
+
+	// Spool stores messages on disk while the publisher is failing.
+	// Without a spool, undeliverable messages are dropped.
+	Spool *Spool
+	// SpoolInterval is how often the spool is replayed (default 5s)
+	SpoolInterval time.Duration
+
+	// StatusPort serves collector stats over HTTP when non-zero
+	StatusPort int
+	// IngestTokens maps bearer tokens to client names. When set, the status
+	// server also accepts event batches on POST /ingest.
+	IngestTokens map[string]string
+	// MaxIngestBytes limits the decompressed size of one batch (default 64MiB)
+	MaxIngestBytes int64
+
+	// TCPPort enables the TCP stream listener when non-zero. Lines may be as
+	// large as Reassembly.MaxSize.
+	TCPPort int
+	// TLSConfig serves the TCP listener over TLS when set
+	TLSConfig *tls.Config
+	// MaxConnections limits concurrent TCP connections (default 256)
+	MaxConnections int
+	// TCPIdleTimeout closes TCP connections that send nothing (default 5m)
+	TCPIdleTimeout time.Duration
+
+	// Reassembly limits chunked batches that span several datagrams
+	Reassembly ReassemblerConfig
+
+	// LogGamemode is the gamemode reported for events parsed from native
+	// srcds log packets (default "default")
+	LogGamemode string
+
+	// Capture records every received datagram, before any filtering, so the
+	// traffic can be replayed later. The caller closes the writer.
+	Capture *capture.Writer
+
+	// OfflineAfter is how long a server may send no events before it is
+	// considered offline (default 2m)
+	OfflineAfter time.Duration
+	// LifecycleEvents publishes server_online and server_offline events when
+	// servers appear or go quiet
+	LifecycleEvents bool
+
+	// StrictValidation also rejects events that decode but fail
+	// parser.Validate, such as players without a SteamID or team
+	StrictValidation bool
+
+	// ClockSkew configures how each server's clock offset is estimated.
+	// Events are published with a corrected_timestamp on the collector's clock.
+	ClockSkew SkewConfig
+
+	// Forward mirrors events or raw datagrams to secondary sinks. The caller
+	// closes the sinks after the collector stopped.
+	Forward []ForwardTarget
 }
 
 // New creates a new collector
 func New(cfg Config) *Collector {
-	return &Collector{
-		addr:      fmt.Sprintf(":%d", cfg.UDPPort),
-		publisher: cfg.Publisher,
-		logger:    cfg.Logger,
+	if cfg.ReadBuffer <= 0 {
+		cfg.ReadBuffer = 4 << 20
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = 2 * runtime.NumCPU()
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 4096
+	}
+	if cfg.DropPolicy == "" {
+		cfg.DropPolicy = DropNewest
+	}
+	if cfg.StatsInterval <= 0 {
+		cfg.StatsInterval = time.Minute
+	}
+	if cfg.SpoolInterval <= 0 {
+		cfg.SpoolInterval = 5 * time.Second
+	}
+	if cfg.MaxIngestBytes <= 0 {
+		cfg.MaxIngestBytes = 64 << 20
+	}
+	if cfg.MaxConnections <= 0 {
+		cfg.MaxConnections = 256
+	}
+	if cfg.TCPIdleTimeout <= 0 {
+		cfg.TCPIdleTimeout = 5 * time.Minute
+	}
+	if cfg.LogGamemode == "" {
+		cfg.LogGamemode = "default"
 	}
+	if cfg.OfflineAfter <= 0 {
+		cfg.OfflineAfter = 2 * time.Minute
+	}
+
+	c := &Collector{
+		addr:            fmt.Sprintf(":%d", cfg.UDPPort),
+		publisher:       cfg.Publisher,
+		logger:          cfg.Logger,
+		readBuffer:      cfg.ReadBuffer,
+		workers:         cfg.Workers,
+		queue:           make(chan packet, cfg.QueueSize),
+		dropPolicy:      cfg.DropPolicy,
+		statsInterval:   cfg.StatsInterval,
+		spool:           cfg.Spool,
+		spoolInterval:   cfg.SpoolInterval,
+		chunks:          NewReassembler(cfg.Reassembly),
+		ingestTokens:    cfg.IngestTokens,
+		maxIngestBytes:  cfg.MaxIngestBytes,
+		tlsConfig:       cfg.TLSConfig,
+		tcpSlots:        make(chan struct{}, cfg.MaxConnections),
+		tcpIdleTimeout:  cfg.TCPIdleTimeout,
+		logGamemode:     cfg.LogGamemode,
+		logParsers:      make(map[string]*parser.LogParser),
+		capture:         cfg.Capture,
+		heartbeats:      NewHeartbeats(cfg.OfflineAfter),
+		lifecycleEvents: cfg.LifecycleEvents,
+		strict:          cfg.StrictValidation,
+		skew:            NewSkewEstimator(cfg.ClockSkew),
+	}
+
+	if cfg.TCPPort != 0 {
+		c.tcpAddr = fmt.Sprintf(":%d", cfg.TCPPort)
+	}
+
+	if cfg.StatusPort != 0 {
+		c.statusAddr = fmt.Sprintf(":%d", cfg.StatusPort)
+	}
+
+	if cfg.RateLimit != nil {
+		c.limiter = NewRateLimiter(*cfg.RateLimit)
+	}
+
+	if cfg.Registry != nil {
+		c.auth = NewAuthenticator(cfg.Registry, cfg.MaxClockSkew)
+	}
+
+	for _, target := range cfg.Forward {
+		c.forwarders = append(c.forwarders, newForwarder(target, cfg.Logger))
+		if target.Raw {
+			c.forwardRaw = true
+		} else {
+			c.forwardEvents = true
+		}
+	}
+
+	return c
 }
 
 // Start starts the UDP collector
 func (c *Collector) Start(ctx context.Context) error {
+	if err := c.listen(); err != nil {
+		return err
+	}
+	return c.serve(ctx)
+}
+
+// listen opens the UDP socket
+func (c *Collector) listen() error {
 	// Resolve UDP address
 	udpAddr, err := net.ResolveUDPAddr("udp", c.addr)
 	if err != nil {
@@ -50,22 +269,86 @@ func (c *Collector) Start(ctx context.Context) error {
 	}
 	c.conn = conn
 
+	// The kernel may cap this below the requested size
+	if err := conn.SetReadBuffer(c.readBuffer); err != nil {
+		c.logger.Error("Failed to set socket read buffer", err, watermill.LogFields{
+			"read_buffer": c.readBuffer,
+		})
+	}
+
 	c.logger.Info("UDP collector started", watermill.LogFields{
-		"address": c.addr,
+		"address":     c.addr,
+		"workers":     c.workers,
+		"queue_size":  cap(c.queue),
+		"drop_policy": string(c.dropPolicy),
 	})
 
-	// Start reading packets
-	go c.readLoop(ctx)
+	if c.tcpAddr != "" {
+		if err := c.listenTCP(); err != nil {
+			_ = c.conn.Close()
+			return err
+		}
+	}
+
+	return nil
+}
+
+// serve runs the read loop and worker pool until the context is cancelled
+func (c *Collector) serve(ctx context.Context) error {
+	// Stop also ends the read loop, which must stop the TCP listener too
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	workers := c.startWorkers()
+	forwarders := c.startForwarders()
+	go c.reportStats(ctx, c.statsInterval)
+	go c.expireChunks(ctx)
+	go c.watchHeartbeats(ctx)
+
+	if c.spool != nil {
+		go c.replaySpool(ctx)
+	}
+
+	if c.limiter != nil {
+		go c.sweepRateLimits(ctx)
+	}
+
+	if c.statusAddr != "" {
+		go c.serveStatus(ctx)
+	}
+
+	if c.capture != nil {
+		go c.flushCapture(ctx)
+	}
+
+	var tcp sync.WaitGroup
+	if c.tcpListener != nil {
+		tcp.Add(1)
+		go func() {
+			defer tcp.Done()
+			c.serveTCP(ctx)
+		}()
+	}
+
+	// Read packets until cancelled, then let the workers drain the queue
+	c.readLoop(ctx)
+	cancel()
+	close(c.queue)
+	workers.Wait()
+	tcp.Wait()
+	c.stopForwarders(forwarders, 5*time.Second)
+
+	if c.capture != nil {
+		if err := c.capture.Flush(); err != nil {
+			c.logger.Error("Failed to flush capture file", err, watermill.LogFields{})
+		}
+	}
 
-	// Wait for context cancellation
-	<-ctx.Done()
 	return c.conn.Close()
 }
 
-// readLoop reads UDP packets and publishes them
+// readLoop reads UDP packets into pooled buffers and queues them for the workers
 func (c *Collector) readLoop(ctx context.Context) {
-	buffer := make([]byte, 4096)
-
 	for {
 		select {
 		case <-ctx.Done():
@@ -79,57 +362,149 @@ func (c *Collector) readLoop(ctx context.Context) {
 			continue
 		}
 
-		n, addr, err := c.conn.ReadFromUDP(buffer)
+		// Each packet gets its own buffer so the next read cannot overwrite it
+		buf := bufferPool.Get().(*[]byte)
+
+		n, addr, err := c.conn.ReadFromUDP(*buf)
 		if err != nil {
+			bufferPool.Put(buf)
 			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
 				continue
 			}
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
 			c.logger.Error("Failed to read UDP packet", err, watermill.LogFields{})
 			continue
 		}
 
-		// Parse and publish event
-		go c.handlePacket(buffer[:n], addr)
+		if c.capture != nil {
+			c.capturePacket((*buf)[:n], addr, time.Now())
+		}
+		c.forwardDatagram((*buf)[:n], addr)
+
+		if c.limiter != nil && !c.allowSource(addr) {
+			bufferPool.Put(buf)
+			c.counters.received.Add(1)
+			continue
+		}
+
+		if n > maxPacketSize {
+			bufferPool.Put(buf)
+			c.counters.received.Add(1)
+			c.counters.truncated.Add(1)
+			c.logger.Error("Rejected packet", ErrPacketTruncated, watermill.LogFields{
+				"source": addr.String(),
+			})
+			continue
+		}
+
+		// Queue packet for the worker pool
+		if !c.enqueue(ctx, packet{buf: buf, n: n, addr: addr}) {
+			return
+		}
 	}
 }
 
 // handlePacket processes a single UDP packet
 func (c *Collector) handlePacket(data []byte, addr *net.UDPAddr) {
+	// Native srcds log packets carry their own header
+	if isLogPacket(data) {
+		c.handleLogPacket(data, addr)
+		return
+	}
+
+	// Verify the sender before looking at the payload
+	var server *ServerIdentity
+	if c.auth != nil {
+		var err error
+		server, data, err = c.auth.Verify(data)
+		if err != nil {
+			c.logger.Error("Rejected packet", err, watermill.LogFields{
+				"source": addr.String(),
+			})
+			return
+		}
+	}
+
+	c.handleBody(data, addr, server)
+}
+
+// handleEvent validates a single JSON event and publishes it
+func (c *Collector) handleEvent(data []byte, addr net.Addr, server *ServerIdentity) error {
 	// Parse JSON
-	var rawEvent map[string]interface{}
+	var rawEvent map[string]json.RawMessage
 	if err := json.Unmarshal(data, &rawEvent); err != nil {
-		c.logger.Error("Failed to parse JSON", err, watermill.LogFields{
-			"source": addr.String(),
-			"data":   string(data),
-		})
-		return
+		return c.rejectInvalid(data, addr, server, "", fmt.Errorf("%w: %v", ErrInvalidJSON, err))
 	}
 
 	// Validate required fields
-	eventType, ok := rawEvent["event_type"].(string)
-	if !ok {
-		c.logger.Error("Missing event_type", nil, watermill.LogFields{
-			"source": addr.String(),
-		})
-		return
+	var eventType string
+	if err := json.Unmarshal(rawEvent["event_type"], &eventType); err != nil || eventType == "" {
+		return c.rejectInvalid(data, addr, server, "", ErrMissingEventType)
+	}
+	if isLifecycleEvent(eventType) {
+		return c.rejectInvalid(data, addr, server, eventType, fmt.Errorf("%w: %s", ErrReservedEventType, eventType))
 	}
 
+	if c.limiter != nil && !c.limiter.AllowEvent(net.ParseIP(sourceIP(addr)), eventType) {
+		return fmt.Errorf("%w: %s", ErrRateLimited, eventType)
+	}
+
+	// Check the payload against its typed event before it reaches the broker
+	event, err := validateEvent(data, c.strict)
+	if err != nil {
+		return c.rejectInvalid(data, addr, server, eventType, err)
+	}
+
+	// The verified identity replaces whatever the server reports about itself
+	var serverIP string
+	if server != nil {
+		serverIP = server.ID
+		rawEvent["server_ip"], _ = json.Marshal(server.ID)
+
+		if data, err = json.Marshal(rawEvent); err != nil {
+			return fmt.Errorf("failed to encode event: %w", err)
+		}
+	} else {
+		_ = json.Unmarshal(rawEvent["server_ip"], &serverIP)
+	}
+
+	c.markSeen(serverIP, addr, server)
+
+	// The parsed event has the timestamp upcast from older schema versions
+	var timestamp time.Time
+	if base := event.Base(); base != nil {
+		timestamp = base.Timestamp
+	}
+
+	return c.publishEvent(eventType, data, addr, server, c.correctTimestamp(serverIP, timestamp))
+}
+
+// publishEvent wraps an event payload in a message and publishes it to the
+// topic for its event type. A non-zero corrected timestamp is the event time
+// on the collector's clock.
+func (c *Collector) publishEvent(eventType string, data []byte, addr net.Addr, server *ServerIdentity, corrected time.Time) error {
 	// Create watermill message
 	msg := message.NewMessage(watermill.NewUUID(), data)
 	msg.Metadata.Set("event_type", eventType)
-	msg.Metadata.Set("source_ip", addr.IP.String())
-	msg.Metadata.Set("received_at", time.Now().Format(time.RFC3339))
+	msg.Metadata.Set("source_ip", sourceIP(addr))
+	msg.Metadata.Set("received_at", time.Now().Format(time.RFC3339Nano))
+	if !corrected.IsZero() {
+		msg.Metadata.Set("corrected_timestamp", corrected.Format(time.RFC3339Nano))
+	}
+	if server != nil {
+		msg.Metadata.Set("server_id", server.ID)
+	}
 
 	// Publish to appropriate topic based on event type
 	topic := fmt.Sprintf("events.%s", eventType)
 
-	if err := c.publisher.Publish(topic, msg); err != nil {
-		c.logger.Error("Failed to publish message", err, watermill.LogFields{
-			"topic":      topic,
-			"event_type": eventType,
-			"source":     addr.String(),
-		})
-		return
+	// Mirrors get the event whether or not the primary publish succeeds
+	c.forwardEvent(topic, eventType, data, addr, server, msg.Metadata)
+
+	if err := c.publish(topic, msg); err != nil {
+		return fmt.Errorf("failed to publish to %s: %w", topic, err)
 	}
 
 	c.logger.Debug("Event published", watermill.LogFields{
@@ -137,6 +512,46 @@ func (c *Collector) handlePacket(data []byte, addr *net.UDPAddr) {
 		"event_type": eventType,
 		"source":     addr.String(),
 	})
+
+	return nil
+}
+
+// sourceIP returns the IP address of a UDP or TCP peer
+func sourceIP(addr net.Addr) string {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP.String()
+	case *net.TCPAddr:
+		return a.IP.String()
+	default:
+		host, _, err := net.SplitHostPort(addr.String())
+		if err != nil {
+			return addr.String()
+		}
+		return host
+	}
+}
+
+// publish sends a message to the broker, spooling it to disk when the broker
+// is unavailable
+func (c *Collector) publish(topic string, msg *message.Message) error {
+	if c.spool == nil {
+		return c.publisher.Publish(topic, msg)
+	}
+
+	// While older messages are spooled, new ones queue behind them to keep order
+	if c.spool.Depth() == 0 {
+		err := c.publisher.Publish(topic, msg)
+		if err == nil {
+			return nil
+		}
+
+		c.logger.Error("Failed to publish message, spooling to disk", err, watermill.LogFields{
+			"topic": topic,
+		})
+	}
+
+	return c.spool.Append(topic, msg)
 }
 
 // Stop stops the collector
@@ -0,0 +1,348 @@
+package collector
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// Forwarding
+//
+// Forward targets mirror the collector's traffic to secondary sinks, such as
+// a staging broker or a legacy log listener. Each target has its own queue
+// and worker; events are offered without blocking, so a slow or broken target
+// drops its own events and never delays the primary publish. A target that
+// fails backs off on its own, while the others carry on.
+
+// Forwarded is an event handed to a forward target
+type Forwarded struct {
+	Topic     string
+	EventType string
+	// ServerIP is the verified server ID, or the server_ip the event claims
+	ServerIP string
+	SourceIP string
+	Payload  []byte
+	Metadata message.Metadata
+}
+
+// Sink delivers forwarded events to one destination
+type Sink interface {
+	Forward(f *Forwarded) error
+}
+
+// ForwardTarget configures one mirror of the event stream
+type ForwardTarget struct {
+	Name string
+	Sink Sink
+
+	// EventTypes limits the target to these event types (default all)
+	EventTypes []string
+	// Servers limits the target to these server IPs, server IDs or source IPs
+	// (default all)
+	Servers []string
+
+	// Raw forwards every UDP datagram exactly as received, instead of the
+	// published events. Raw targets can only filter by source IP.
+	Raw bool
+
+	// QueueSize is how many events may wait for the sink (default 1024)
+	QueueSize int
+	// MaxBackoff caps the pause after consecutive failures (default 30s)
+	MaxBackoff time.Duration
+}
+
+// ForwardStats holds the counters of one forward target
+type ForwardStats struct {
+	Name       string `json:"name"`
+	Forwarded  uint64 `json:"forwarded"`
+	Dropped    uint64 `json:"dropped"`
+	Failed     uint64 `json:"failed"`
+	Failing    bool   `json:"failing"`
+	QueueDepth int    `json:"queue_depth"`
+}
+
+// forwarder runs one forward target
+type forwarder struct {
+	target     ForwardTarget
+	eventTypes map[string]bool
+	servers    map[string]bool
+	queue      chan *Forwarded
+	logger     watermill.LoggerAdapter
+
+	forwarded atomic.Uint64
+	dropped   atomic.Uint64
+	failed    atomic.Uint64
+	failing   atomic.Bool
+}
+
+// newForwarder creates the queue and filters of a target
+func newForwarder(target ForwardTarget, logger watermill.LoggerAdapter) *forwarder {
+	if target.QueueSize <= 0 {
+		target.QueueSize = 1024
+	}
+	if target.MaxBackoff <= 0 {
+		target.MaxBackoff = 30 * time.Second
+	}
+
+	return &forwarder{
+		target:     target,
+		eventTypes: toSet(target.EventTypes),
+		servers:    toSet(target.Servers),
+		queue:      make(chan *Forwarded, target.QueueSize),
+		logger:     logger,
+	}
+}
+
+// toSet returns the values as a set, or nil for an empty list
+func toSet(values []string) map[string]bool {
+	if len(values) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[value] = true
+	}
+	return set
+}
+
+// matches reports whether the target wants an event
+func (f *forwarder) matches(fwd *Forwarded) bool {
+	if f.eventTypes != nil && !f.eventTypes[fwd.EventType] {
+		return false
+	}
+	if f.servers != nil && !f.servers[fwd.ServerIP] && !f.servers[fwd.SourceIP] {
+		return false
+	}
+	return true
+}
+
+// offer queues an event without blocking, dropping it when the queue is full
+func (f *forwarder) offer(fwd *Forwarded) {
+	if !f.matches(fwd) {
+		return
+	}
+
+	select {
+	case f.queue <- fwd:
+	default:
+		f.dropped.Add(1)
+	}
+}
+
+// run delivers queued events until the queue is closed. After a failure the
+// worker pauses, doubling the pause while failures continue, and events
+// arriving meanwhile wait in the queue or are dropped.
+func (f *forwarder) run() {
+	backoff := time.Duration(0)
+
+	for fwd := range f.queue {
+		err := f.target.Sink.Forward(fwd)
+		if err == nil {
+			f.forwarded.Add(1)
+			if f.failing.Swap(false) {
+				f.logger.Info("Forward target recovered", watermill.LogFields{
+					"target": f.target.Name,
+				})
+			}
+			backoff = 0
+			continue
+		}
+
+		f.failed.Add(1)
+		if !f.failing.Swap(true) {
+			f.logger.Error("Forward target failing", err, watermill.LogFields{
+				"target": f.target.Name,
+			})
+		}
+
+		backoff = min(max(2*backoff, 100*time.Millisecond), f.target.MaxBackoff)
+		time.Sleep(backoff)
+	}
+}
+
+// stats returns the counters of the target
+func (f *forwarder) stats() ForwardStats {
+	return ForwardStats{
+		Name:       f.target.Name,
+		Forwarded:  f.forwarded.Load(),
+		Dropped:    f.dropped.Load(),
+		Failed:     f.failed.Load(),
+		Failing:    f.failing.Load(),
+		QueueDepth: len(f.queue),
+	}
+}
+
+// startForwarders starts a worker per forward target
+func (c *Collector) startForwarders() *sync.WaitGroup {
+	var wg sync.WaitGroup
+	for _, f := range c.forwarders {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f.run()
+		}()
+	}
+	return &wg
+}
+
+// stopForwarders closes the forward queues and waits up to timeout for them
+// to drain, so a broken target cannot hold up shutdown
+func (c *Collector) stopForwarders(wg *sync.WaitGroup, timeout time.Duration) {
+	for _, f := range c.forwarders {
+		close(f.queue)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		c.logger.Error("Forward targets did not drain", fmt.Errorf("timed out after %s", timeout), watermill.LogFields{})
+	}
+}
+
+// forwardEvent offers a published event to the event forward targets. The
+// payload and metadata are copied, since UDP payloads live in pooled buffers.
+func (c *Collector) forwardEvent(topic, eventType string, data []byte, addr net.Addr, server *ServerIdentity, metadata message.Metadata) {
+	if !c.forwardEvents {
+		return
+	}
+
+	fwd := &Forwarded{
+		Topic:     topic,
+		EventType: eventType,
+		SourceIP:  sourceIP(addr),
+		Payload:   append([]byte(nil), data...),
+		Metadata:  make(message.Metadata, len(metadata)),
+	}
+	for key, value := range metadata {
+		fwd.Metadata[key] = value
+	}
+	if server != nil {
+		fwd.ServerIP = server.ID
+	} else {
+		var base struct {
+			ServerIP string `json:"server_ip"`
+		}
+		_ = json.Unmarshal(data, &base)
+		fwd.ServerIP = base.ServerIP
+	}
+
+	for _, f := range c.forwarders {
+		if !f.target.Raw {
+			f.offer(fwd)
+		}
+	}
+}
+
+// forwardDatagram offers a received datagram to the raw forward targets. The
+// payload is copied, since the read buffer is reused.
+func (c *Collector) forwardDatagram(data []byte, addr *net.UDPAddr) {
+	if !c.forwardRaw {
+		return
+	}
+
+	fwd := &Forwarded{
+		SourceIP: addr.IP.String(),
+		Payload:  append([]byte(nil), data...),
+	}
+
+	for _, f := range c.forwarders {
+		if f.target.Raw {
+			f.offer(fwd)
+		}
+	}
+}
+
+// PublisherSink forwards events to a watermill publisher, such as a second
+// broker, on their original topic
+type PublisherSink struct {
+	Publisher message.Publisher
+}
+
+// Forward publishes a copy of the event
+func (s *PublisherSink) Forward(f *Forwarded) error {
+	if f.Topic == "" {
+		return errors.New("raw datagrams cannot be published")
+	}
+
+	msg := message.NewMessage(watermill.NewUUID(), f.Payload)
+	for key, value := range f.Metadata {
+		msg.Metadata.Set(key, value)
+	}
+
+	return s.Publisher.Publish(f.Topic, msg)
+}
+
+// UDPSink forwards each event or datagram as one UDP datagram
+type UDPSink struct {
+	conn net.Conn
+}
+
+// DialUDPSink creates a UDP sink sending to addr
+func DialUDPSink(addr string) (*UDPSink, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial UDP forward target: %w", err)
+	}
+	return &UDPSink{conn: conn}, nil
+}
+
+// Forward sends the payload
+func (s *UDPSink) Forward(f *Forwarded) error {
+	_, err := s.conn.Write(f.Payload)
+	return err
+}
+
+// Close closes the socket
+func (s *UDPSink) Close() error {
+	return s.conn.Close()
+}
+
+// FileSink appends each event as a line to a file
+type FileSink struct {
+	file *os.File
+	buf  *bufio.Writer
+}
+
+// OpenFileSink opens a file sink, appending to the file if it exists
+func OpenFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600) // #nosec G304 -- path comes from operator configuration
+	if err != nil {
+		return nil, fmt.Errorf("failed to open forward file: %w", err)
+	}
+	return &FileSink{file: file, buf: bufio.NewWriter(file)}, nil
+}
+
+// Forward appends the payload and a newline
+func (s *FileSink) Forward(f *Forwarded) error {
+	if _, err := s.buf.Write(f.Payload); err != nil {
+		return err
+	}
+	if err := s.buf.WriteByte('\n'); err != nil {
+		return err
+	}
+	return s.buf.Flush()
+}
+
+// Close flushes and closes the file
+func (s *FileSink) Close() error {
+	if err := s.buf.Flush(); err != nil {
+		_ = s.file.Close()
+		return err
+	}
+	return s.file.Close()
+}
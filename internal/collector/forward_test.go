@@ -0,0 +1,162 @@
+package collector
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+)
+
+// recordingSink records forwarded events and fails while told to
+type recordingSink struct {
+	mu      sync.Mutex
+	fail    bool
+	block   chan struct{}
+	events  []*Forwarded
+	arrived chan struct{}
+}
+
+func newRecordingSink() *recordingSink {
+	return &recordingSink{arrived: make(chan struct{}, 100)}
+}
+
+func (s *recordingSink) Forward(f *Forwarded) error {
+	if s.block != nil {
+		<-s.block
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer func() { s.arrived <- struct{}{} }()
+
+	if s.fail {
+		return errors.New("mirror unavailable")
+	}
+	s.events = append(s.events, f)
+	return nil
+}
+
+// wait waits for n forward attempts
+func (s *recordingSink) wait(t *testing.T, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		select {
+		case <-s.arrived:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for forward %d", i+1)
+		}
+	}
+}
+
+// TestForwardFilters tests that each target only receives matching events
+// and that raw targets receive datagrams
+func TestForwardFilters(t *testing.T) {
+	all, kills, server, raw := newRecordingSink(), newRecordingSink(), newRecordingSink(), newRecordingSink()
+	pub := &recordingPublisher{failAfter: -1}
+	c := New(Config{
+		Publisher: pub,
+		Logger:    watermill.NopLogger{},
+		Forward: []ForwardTarget{
+			{Name: "all", Sink: all},
+			{Name: "kills", Sink: kills, EventTypes: []string{"airshot"}},
+			{Name: "server", Sink: server, Servers: []string{"10.0.0.9"}},
+			{Name: "raw", Sink: raw, Raw: true},
+		},
+	})
+	wg := c.startForwarders()
+
+	if err := c.handleEvent(benchmarkPayload, testAddr, nil); err != nil {
+		t.Fatalf("handleEvent() error = %v", err)
+	}
+	c.forwardDatagram([]byte("datagram"), testAddr)
+	c.stopForwarders(wg, 5*time.Second)
+
+	if len(all.events) != 1 || all.events[0].EventType != "kill" || all.events[0].ServerIP != "192.168.1.100" {
+		t.Errorf("all target got %+v, want the kill from 192.168.1.100", all.events)
+	}
+	if string(all.events[0].Payload) != string(benchmarkPayload) || all.events[0].Metadata.Get("event_type") != "kill" {
+		t.Errorf("forwarded event = %+v, want the published payload and metadata", all.events[0])
+	}
+	if len(kills.events) != 0 || len(server.events) != 0 {
+		t.Errorf("filtered targets got %d and %d events, want none", len(kills.events), len(server.events))
+	}
+	if len(raw.events) != 1 || string(raw.events[0].Payload) != "datagram" {
+		t.Errorf("raw target got %+v, want the datagram", raw.events)
+	}
+	if len(pub.payloads) != 1 {
+		t.Errorf("primary published %d events, want 1", len(pub.payloads))
+	}
+}
+
+// TestForwardSlowTarget tests that a blocked target drops its own events
+// without holding up the primary publish
+func TestForwardSlowTarget(t *testing.T) {
+	slow := newRecordingSink()
+	slow.block = make(chan struct{})
+	pub := &recordingPublisher{failAfter: -1}
+	c := New(Config{
+		Publisher: pub,
+		Logger:    watermill.NopLogger{},
+		Forward:   []ForwardTarget{{Name: "slow", Sink: slow, QueueSize: 2}},
+	})
+	wg := c.startForwarders()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			if err := c.handleEvent(benchmarkPayload, testAddr, nil); err != nil {
+				t.Errorf("handleEvent() error = %v", err)
+			}
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("primary publish blocked by a slow forward target")
+	}
+
+	stats := c.Stats().Forward[0]
+	if len(pub.payloads) != 10 || stats.Dropped < 7 {
+		t.Errorf("published %d, dropped %d, want 10 published and the overflow dropped", len(pub.payloads), stats.Dropped)
+	}
+
+	close(slow.block)
+	c.stopForwarders(wg, 5*time.Second)
+}
+
+// TestForwardFailure tests that a failing target backs off and recovers
+func TestForwardFailure(t *testing.T) {
+	sink := newRecordingSink()
+	sink.fail = true
+	f := newForwarder(ForwardTarget{Name: "broken", Sink: sink, MaxBackoff: 10 * time.Millisecond}, watermill.NopLogger{})
+	go f.run()
+	defer close(f.queue)
+
+	f.offer(&Forwarded{EventType: "kill"})
+	sink.wait(t, 1)
+	waitForStats(t, f, func(stats ForwardStats) bool { return stats.Failing && stats.Failed == 1 })
+
+	sink.mu.Lock()
+	sink.fail = false
+	sink.mu.Unlock()
+
+	f.offer(&Forwarded{EventType: "kill"})
+	sink.wait(t, 1)
+	waitForStats(t, f, func(stats ForwardStats) bool { return !stats.Failing && stats.Forwarded == 1 })
+}
+
+// waitForStats waits until the forwarder's counters satisfy cond
+func waitForStats(t *testing.T, f *forwarder, cond func(ForwardStats) bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond(f.stats()) {
+		if time.Now().After(deadline) {
+			t.Fatalf("stats() = %+v", f.stats())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,343 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+)
+
+// Framing
+//
+// A datagram body (after the optional signature header) is either a batch or
+// a chunk.
+//
+// A batch is one or more JSON events separated by newlines:
+//
+//	{"event_type":"kill",...}\n{"event_type":"healed",...}
+//
+// A chunk carries one part of a batch that is too large for one datagram:
+//
+//	CHUNK <id> <index> <count>\n<part>
+//
+// The collector concatenates the parts of a chunk set in index order once all
+// count parts have arrived and handles the result as a batch. Chunk IDs only
+// need to be unique per server while a set is in flight.
+const chunkPrefix = "CHUNK "
+
+// maxChunkIDLength bounds chunk IDs so a sender cannot grow the pending map keys
+const maxChunkIDLength = 64
+
+// Framing errors
+var (
+	ErrMalformedChunk     = errors.New("malformed chunk header")
+	ErrTooManyChunks      = errors.New("chunk count above limit")
+	ErrChunkMismatch      = errors.New("chunk does not match its set")
+	ErrEventTooLarge      = errors.New("reassembled event above size limit")
+	ErrTooManyChunkSets   = errors.New("too many incomplete chunk sets")
+	ErrPacketTruncated    = errors.New("packet larger than read buffer")
+	ErrIncompleteChunkSet = errors.New("incomplete chunk set expired")
+)
+
+// ReassemblerConfig holds chunk reassembly limits
+type ReassemblerConfig struct {
+	// Timeout is how long an incomplete chunk set is kept (default 5s)
+	Timeout time.Duration
+	// MaxChunks is the highest chunk count accepted for one set (default 64)
+	MaxChunks int
+	// MaxSize is the largest reassembled batch in bytes (default 256KiB)
+	MaxSize int
+	// MaxPending is how many incomplete sets may be held at once (default 1024)
+	MaxPending int
+}
+
+// chunkKey identifies a chunk set by sender and chunk ID
+type chunkKey struct {
+	source string
+	id     string
+}
+
+// chunkSet holds the parts of a chunk set received so far
+type chunkSet struct {
+	parts    [][]byte
+	received int
+	size     int
+	started  time.Time
+}
+
+// ExpiredChunkSet describes an incomplete chunk set dropped after the timeout
+type ExpiredChunkSet struct {
+	Source   string
+	ID       string
+	Received int
+	Count    int
+}
+
+// Reassembler joins chunked batches back together
+type Reassembler struct {
+	cfg ReassemblerConfig
+	now func() time.Time
+
+	mu   sync.Mutex
+	sets map[chunkKey]*chunkSet
+}
+
+// NewReassembler creates a reassembler
+func NewReassembler(cfg ReassemblerConfig) *Reassembler {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+	if cfg.MaxChunks <= 0 {
+		cfg.MaxChunks = 64
+	}
+	if cfg.MaxSize <= 0 {
+		cfg.MaxSize = 256 << 10
+	}
+	if cfg.MaxPending <= 0 {
+		cfg.MaxPending = 1024
+	}
+
+	return &Reassembler{
+		cfg:  cfg,
+		now:  time.Now,
+		sets: make(map[chunkKey]*chunkSet),
+	}
+}
+
+// Add stores one chunk from source. It returns the reassembled batch once the
+// last chunk of a set arrives, and nil while the set is incomplete.
+func (r *Reassembler) Add(source string, data []byte) ([]byte, error) {
+	header, part, found := bytes.Cut(data, []byte("\n"))
+	if !found {
+		return nil, ErrMalformedChunk
+	}
+
+	fields := bytes.Fields(header)
+	if len(fields) != 4 || string(fields[0]) != strings.TrimSpace(chunkPrefix) {
+		return nil, ErrMalformedChunk
+	}
+
+	id := string(fields[1])
+	index, err := strconv.Atoi(string(fields[2]))
+	if err != nil {
+		return nil, ErrMalformedChunk
+	}
+	count, err := strconv.Atoi(string(fields[3]))
+	if err != nil {
+		return nil, ErrMalformedChunk
+	}
+
+	if len(id) > maxChunkIDLength || count < 1 || index < 0 || index >= count {
+		return nil, ErrMalformedChunk
+	}
+	if count > r.cfg.MaxChunks {
+		return nil, fmt.Errorf("%w: %d > %d", ErrTooManyChunks, count, r.cfg.MaxChunks)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := chunkKey{source: source, id: id}
+	set, ok := r.sets[key]
+	if !ok {
+		if len(r.sets) >= r.cfg.MaxPending {
+			return nil, ErrTooManyChunkSets
+		}
+		set = &chunkSet{parts: make([][]byte, count), started: r.now()}
+		r.sets[key] = set
+	}
+
+	if len(set.parts) != count {
+		delete(r.sets, key)
+		return nil, fmt.Errorf("%w: chunk %s has count %d, set has %d", ErrChunkMismatch, id, count, len(set.parts))
+	}
+
+	// Duplicates are ignored, the first copy wins
+	if set.parts[index] != nil {
+		return nil, nil
+	}
+
+	set.size += len(part)
+	if set.size > r.cfg.MaxSize {
+		delete(r.sets, key)
+		return nil, fmt.Errorf("%w: chunk %s exceeds %d bytes", ErrEventTooLarge, id, r.cfg.MaxSize)
+	}
+
+	// The part points into a pooled read buffer, so keep a copy
+	set.parts[index] = append([]byte{}, part...)
+	set.received++
+
+	if set.received < count {
+		return nil, nil
+	}
+
+	delete(r.sets, key)
+	return bytes.Join(set.parts, nil), nil
+}
+
+// Expire drops incomplete chunk sets older than the timeout and returns them
+func (r *Reassembler) Expire() []ExpiredChunkSet {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cutoff := r.now().Add(-r.cfg.Timeout)
+
+	var expired []ExpiredChunkSet
+	for key, set := range r.sets {
+		if set.started.After(cutoff) {
+			continue
+		}
+		expired = append(expired, ExpiredChunkSet{
+			Source:   key.source,
+			ID:       key.id,
+			Received: set.received,
+			Count:    len(set.parts),
+		})
+		delete(r.sets, key)
+	}
+
+	return expired
+}
+
+// Pending returns the number of incomplete chunk sets
+func (r *Reassembler) Pending() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.sets)
+}
+
+// isChunk reports whether a datagram body is a chunk
+func isChunk(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(chunkPrefix))
+}
+
+// EncodeFrames packs events into datagram bodies of at most maxSize bytes.
+// Events are batched with newlines; a single event larger than maxSize is
+// split into chunks tagged with idPrefix and a counter.
+func EncodeFrames(events [][]byte, maxSize int, idPrefix string) ([][]byte, error) {
+	var frames [][]byte
+	var batch []byte
+	chunkID := 0
+
+	flush := func() {
+		if len(batch) > 0 {
+			frames = append(frames, batch)
+			batch = nil
+		}
+	}
+
+	for _, event := range events {
+		if bytes.IndexByte(event, '\n') >= 0 {
+			return nil, errors.New("event contains a newline")
+		}
+
+		// Fits in the current batch
+		if len(batch) > 0 && len(batch)+1+len(event) <= maxSize {
+			batch = append(batch, '\n')
+			batch = append(batch, event...)
+			continue
+		}
+
+		flush()
+
+		if len(event) <= maxSize {
+			batch = append([]byte{}, event...)
+			continue
+		}
+
+		// Too large for one datagram, split into chunks
+		id := fmt.Sprintf("%s%d", idPrefix, chunkID)
+		chunkID++
+
+		// Leave room for the largest header this set can produce
+		headerSize := len(fmt.Sprintf("%s%s %d %d\n", chunkPrefix, id, len(event), len(event)))
+		partSize := maxSize - headerSize
+		if partSize <= 0 {
+			return nil, fmt.Errorf("max size %d too small for chunk headers", maxSize)
+		}
+
+		count := (len(event) + partSize - 1) / partSize
+		for i := 0; i < count; i++ {
+			part := event[i*partSize : min((i+1)*partSize, len(event))]
+			frame := fmt.Appendf(nil, "%s%s %d %d\n", chunkPrefix, id, i, count)
+			frames = append(frames, append(frame, part...))
+		}
+	}
+
+	flush()
+	return frames, nil
+}
+
+// handleBody handles a verified datagram body, which is either a batch of
+// events or one chunk of a larger batch
+func (c *Collector) handleBody(data []byte, addr *net.UDPAddr, server *ServerIdentity) {
+	if isChunk(data) {
+		source := addr.String()
+		if server != nil {
+			source = server.ID
+		}
+
+		batch, err := c.chunks.Add(source, data)
+		if err != nil {
+			c.counters.chunkErrors.Add(1)
+			c.logger.Error("Rejected chunk", err, watermill.LogFields{
+				"source": addr.String(),
+			})
+			return
+		}
+		if batch == nil {
+			return
+		}
+
+		c.counters.reassembled.Add(1)
+		data = batch
+	}
+
+	for len(data) > 0 {
+		var line []byte
+		line, data, _ = bytes.Cut(data, []byte("\n"))
+
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		// Throttled events are counted, not logged, so a flood does not
+		// move to the logs
+		if err := c.handleEvent(line, addr, server); err != nil && !errors.Is(err, ErrRateLimited) {
+			c.logger.Error("Failed to handle event", err, watermill.LogFields{
+				"source": addr.String(),
+			})
+		}
+	}
+}
+
+// expireChunks periodically drops incomplete chunk sets
+func (c *Collector) expireChunks(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, set := range c.chunks.Expire() {
+				c.counters.chunkErrors.Add(1)
+				c.logger.Error("Dropped chunk set", ErrIncompleteChunkSet, watermill.LogFields{
+					"source":   set.Source,
+					"chunk_id": set.ID,
+					"received": set.Received,
+					"count":    set.Count,
+				})
+			}
+		}
+	}
+}
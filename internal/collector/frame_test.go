@@ -0,0 +1,187 @@
+package collector
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+)
+
+var testAddr = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 27015}
+
+// largeTestEvent builds a weapon_stats event of roughly size bytes
+func largeTestEvent(size int) []byte {
+	padding := strings.Repeat("x", size)
+	return []byte(fmt.Sprintf(`{"timestamp":"2024-02-01T12:00:00Z","server_ip":"192.168.1.100","event_type":"weapon_stats","player":{"steam_id":"76561198012345678","name":"%s","team":2}}`, padding))
+}
+
+// TestEncodeFramesRoundTrip tests that encoded frames reassemble into the original events
+func TestEncodeFramesRoundTrip(t *testing.T) {
+	small := benchmarkPayload
+	large := largeTestEvent(10000)
+
+	frames, err := EncodeFrames([][]byte{small, small, large, small}, maxPacketSize, "t")
+	if err != nil {
+		t.Fatalf("EncodeFrames() error = %v", err)
+	}
+
+	pub := &recordingPublisher{failAfter: -1}
+	c := New(Config{Publisher: pub, Logger: watermill.NopLogger{}})
+
+	for _, frame := range frames {
+		if len(frame) > maxPacketSize {
+			t.Fatalf("frame of %d bytes exceeds %d", len(frame), maxPacketSize)
+		}
+		c.handlePacket(frame, testAddr)
+	}
+
+	want := []string{string(small), string(small), string(large), string(small)}
+	if len(pub.payloads) != len(want) {
+		t.Fatalf("published %d events, want %d", len(pub.payloads), len(want))
+	}
+	for i := range want {
+		if pub.payloads[i] != want[i] {
+			t.Errorf("event %d differs from the original", i)
+		}
+	}
+
+	if stats := c.Stats(); stats.Reassembled != 1 || stats.PendingChunks != 0 {
+		t.Errorf("Stats() = %+v, want 1 reassembled and none pending", stats)
+	}
+}
+
+// TestReassemblerOutOfOrder tests reassembly of chunks arriving out of order and twice
+func TestReassemblerOutOfOrder(t *testing.T) {
+	r := NewReassembler(ReassemblerConfig{})
+
+	chunks := []string{
+		"CHUNK a 2 3\nllo",
+		"CHUNK a 0 3\nhe",
+		"CHUNK a 0 3\nhe",
+	}
+	for _, chunk := range chunks {
+		if batch, err := r.Add("eu-1", []byte(chunk)); err != nil || batch != nil {
+			t.Fatalf("Add(%q) = %q, %v, want incomplete", chunk, batch, err)
+		}
+	}
+
+	// The same ID from another server is a separate set
+	if batch, _ := r.Add("eu-2", []byte("CHUNK a 1 3\n!!")); batch != nil {
+		t.Fatalf("Add() from other source completed a set: %q", batch)
+	}
+
+	batch, err := r.Add("eu-1", []byte("CHUNK a 1 3\n, he"))
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if string(batch) != "he, hello" {
+		t.Errorf("batch = %q, want %q", batch, "he, hello")
+	}
+}
+
+// TestReassemblerErrors tests that invalid chunks and incomplete sets are reported
+func TestReassemblerErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		chunks  []string
+		wantErr error
+	}{
+		{
+			name:    "Missing header fields",
+			chunks:  []string{"CHUNK a 0\ndata"},
+			wantErr: ErrMalformedChunk,
+		},
+		{
+			name:    "Index out of range",
+			chunks:  []string{"CHUNK a 3 3\ndata"},
+			wantErr: ErrMalformedChunk,
+		},
+		{
+			name:    "Too many chunks",
+			chunks:  []string{"CHUNK a 0 1000\ndata"},
+			wantErr: ErrTooManyChunks,
+		},
+		{
+			name:    "Count mismatch",
+			chunks:  []string{"CHUNK a 0 3\ndata", "CHUNK a 1 4\ndata"},
+			wantErr: ErrChunkMismatch,
+		},
+		{
+			name:    "Reassembled too large",
+			chunks:  []string{"CHUNK a 0 2\n" + strings.Repeat("x", 600), "CHUNK a 1 2\n" + strings.Repeat("x", 600)},
+			wantErr: ErrEventTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReassembler(ReassemblerConfig{MaxSize: 1024})
+
+			var err error
+			for _, chunk := range tt.chunks {
+				if _, err = r.Add("eu-1", []byte(chunk)); err != nil {
+					break
+				}
+			}
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Add() error = %v, want %v", err, tt.wantErr)
+			}
+			if pending := r.Pending(); pending != 0 {
+				t.Errorf("Pending() = %d, want 0 after error", pending)
+			}
+		})
+	}
+}
+
+// TestReassemblerExpire tests that incomplete sets are dropped after the timeout
+func TestReassemblerExpire(t *testing.T) {
+	now := time.Unix(1706788800, 0)
+	r := NewReassembler(ReassemblerConfig{Timeout: 5 * time.Second})
+	r.now = func() time.Time { return now }
+
+	if _, err := r.Add("eu-1", []byte("CHUNK a 0 3\nhe")); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	if expired := r.Expire(); len(expired) != 0 {
+		t.Fatalf("Expire() = %v before the timeout", expired)
+	}
+
+	now = now.Add(6 * time.Second)
+	expired := r.Expire()
+	if len(expired) != 1 {
+		t.Fatalf("Expire() returned %d sets, want 1", len(expired))
+	}
+	if got := expired[0]; got.Source != "eu-1" || got.ID != "a" || got.Received != 1 || got.Count != 3 {
+		t.Errorf("expired set = %+v, want eu-1/a with 1 of 3 chunks", got)
+	}
+}
+
+// TestSignedBatch tests that a signed datagram can carry several events
+func TestSignedBatch(t *testing.T) {
+	registry, err := NewRegistry([]ServerIdentity{{ID: "eu-1", Secret: "s3cret"}})
+	if err != nil {
+		t.Fatalf("NewRegistry() error = %v", err)
+	}
+
+	pub := &recordingPublisher{failAfter: -1}
+	c := New(Config{Publisher: pub, Logger: watermill.NopLogger{}, Registry: registry})
+
+	body := bytes.Join([][]byte{benchmarkPayload, benchmarkPayload, benchmarkPayload}, []byte("\n"))
+	c.handlePacket(Sign("eu-1", "s3cret", time.Now(), "n1", body), testAddr)
+
+	if len(pub.payloads) != 3 {
+		t.Fatalf("published %d events, want 3", len(pub.payloads))
+	}
+	for i, metadata := range pub.metadata {
+		if metadata.Get("server_id") != "eu-1" {
+			t.Errorf("event %d server_id = %q, want eu-1", i, metadata.Get("server_id"))
+		}
+	}
+}
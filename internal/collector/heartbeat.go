@@ -0,0 +1,286 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/UDL-TF/UnitedStats/internal/parser"
+	"github.com/UDL-TF/UnitedStats/pkg/events"
+)
+
+// ErrReservedEventType is returned for lifecycle events sent by a server,
+// since only the collector may publish them
+var ErrReservedEventType = errors.New("reserved event type")
+
+// rateWindow is the period over which a server's event rate is measured
+const rateWindow = time.Minute
+
+// forgetAfter is how long an offline server stays listed before it is forgotten
+const forgetAfter = 24 * time.Hour
+
+// ServerStatus describes what the collector knows about one server
+type ServerStatus struct {
+	ServerIP  string    `json:"server_ip"`
+	ServerID  string    `json:"server_id,omitempty"`
+	SourceIP  string    `json:"source_ip"`
+	Online    bool      `json:"online"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Events    uint64    `json:"events"`
+	EventRate float64   `json:"event_rate"`
+	ClockSkew float64   `json:"clock_skew_seconds"`
+}
+
+// heartbeat tracks one server
+type heartbeat struct {
+	status ServerStatus
+
+	windowStart  time.Time
+	windowEvents uint64
+}
+
+// rate returns the event rate of the last complete window, or of the current
+// one once it is older than rateWindow
+func (h *heartbeat) rate(now time.Time) float64 {
+	if elapsed := now.Sub(h.windowStart); elapsed >= rateWindow {
+		return float64(h.windowEvents) / elapsed.Seconds()
+	}
+	return h.status.EventRate
+}
+
+// Heartbeats tracks when each server was last heard from and how many events
+// it sends
+type Heartbeats struct {
+	offlineAfter time.Duration
+	now          func() time.Time
+
+	mu      sync.Mutex
+	servers map[string]*heartbeat
+}
+
+// NewHeartbeats creates a tracker that considers a server offline after
+// offlineAfter without events
+func NewHeartbeats(offlineAfter time.Duration) *Heartbeats {
+	return &Heartbeats{
+		offlineAfter: offlineAfter,
+		now:          time.Now,
+		servers:      make(map[string]*heartbeat),
+	}
+}
+
+// Seen records an event from a server and reports whether the server came
+// online with it
+func (h *Heartbeats) Seen(serverIP string, addr net.Addr, server *ServerIdentity) (ServerStatus, bool) {
+	now := h.now()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	hb, ok := h.servers[serverIP]
+	if !ok {
+		hb = &heartbeat{status: ServerStatus{ServerIP: serverIP}}
+		h.servers[serverIP] = hb
+	}
+
+	cameOnline := !hb.status.Online
+	if cameOnline {
+		hb.status.Online = true
+		hb.status.FirstSeen = now
+		hb.status.Events = 0
+		hb.status.EventRate = 0
+		hb.windowStart = now
+		hb.windowEvents = 0
+	}
+
+	if now.Sub(hb.windowStart) >= rateWindow {
+		hb.status.EventRate = hb.rate(now)
+		hb.windowStart = now
+		hb.windowEvents = 0
+	}
+
+	hb.status.SourceIP = sourceIP(addr)
+	if server != nil {
+		hb.status.ServerID = server.ID
+	}
+	hb.status.LastSeen = now
+	hb.status.Events++
+	hb.windowEvents++
+
+	return hb.snapshot(now), cameOnline
+}
+
+// Expire marks servers that have been quiet for longer than offlineAfter as
+// offline and returns them. Servers offline for a day are forgotten.
+func (h *Heartbeats) Expire() []ServerStatus {
+	now := h.now()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var offline []ServerStatus
+	for serverIP, hb := range h.servers {
+		quiet := now.Sub(hb.status.LastSeen)
+		if !hb.status.Online {
+			if quiet > forgetAfter {
+				delete(h.servers, serverIP)
+			}
+			continue
+		}
+		if quiet <= h.offlineAfter {
+			continue
+		}
+
+		// Report the rate up to the last event rather than decayed to zero
+		hb.status.EventRate = hb.rate(hb.status.LastSeen)
+		hb.status.Online = false
+		offline = append(offline, hb.status)
+	}
+
+	sort.Slice(offline, func(i, j int) bool {
+		return offline[i].ServerIP < offline[j].ServerIP
+	})
+	return offline
+}
+
+// Servers returns every tracked server, sorted by server IP
+func (h *Heartbeats) Servers() []ServerStatus {
+	now := h.now()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	servers := make([]ServerStatus, 0, len(h.servers))
+	for _, hb := range h.servers {
+		servers = append(servers, hb.snapshot(now))
+	}
+
+	sort.Slice(servers, func(i, j int) bool {
+		return servers[i].ServerIP < servers[j].ServerIP
+	})
+	return servers
+}
+
+// Online returns how many servers are online
+func (h *Heartbeats) Online() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	online := 0
+	for _, hb := range h.servers {
+		if hb.status.Online {
+			online++
+		}
+	}
+	return online
+}
+
+// snapshot returns the status with an up-to-date event rate
+func (h *heartbeat) snapshot(now time.Time) ServerStatus {
+	status := h.status
+	if status.Online {
+		status.EventRate = h.rate(now)
+	}
+	return status
+}
+
+// isLifecycleEvent reports whether eventType is reserved for the collector
+func isLifecycleEvent(eventType string) bool {
+	return eventType == string(events.EventTypeServerOnline) || eventType == string(events.EventTypeServerOffline)
+}
+
+// markSeen records an event from a server, publishing server_online when it
+// came online
+func (c *Collector) markSeen(serverIP string, addr net.Addr, server *ServerIdentity) {
+	if serverIP == "" {
+		serverIP = sourceIP(addr)
+	}
+
+	status, cameOnline := c.heartbeats.Seen(serverIP, addr, server)
+	if !cameOnline {
+		return
+	}
+
+	c.logger.Info("Server online", watermill.LogFields{
+		"server_ip": serverIP,
+		"source":    addr.String(),
+	})
+
+	if c.lifecycleEvents {
+		c.publishLifecycle(events.EventTypeServerOnline, status)
+	}
+}
+
+// expireHeartbeats reports servers that went quiet as offline
+func (c *Collector) expireHeartbeats() {
+	for _, status := range c.heartbeats.Expire() {
+		// A server that comes back may have been restarted with another clock
+		c.skew.Forget(status.ServerIP)
+
+		c.logger.Info("Server offline", watermill.LogFields{
+			"server_ip": status.ServerIP,
+			"last_seen": status.LastSeen.Format(time.RFC3339),
+		})
+
+		if c.lifecycleEvents {
+			c.publishLifecycle(events.EventTypeServerOffline, status)
+		}
+	}
+}
+
+// watchHeartbeats periodically checks for servers that went quiet
+func (c *Collector) watchHeartbeats(ctx context.Context) {
+	ticker := time.NewTicker(max(c.heartbeats.offlineAfter/4, time.Second))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.expireHeartbeats()
+		}
+	}
+}
+
+// publishLifecycle publishes a server_online or server_offline event
+func (c *Collector) publishLifecycle(eventType events.EventType, status ServerStatus) {
+	payload, err := json.Marshal(events.ServerStatusEvent{
+		BaseEvent: events.BaseEvent{
+			Timestamp: c.heartbeats.now(),
+			ServerIP:  status.ServerIP,
+			EventType: eventType,
+
+			SchemaVersion: parser.CurrentSchemaVersion,
+		},
+		SourceIP:  status.SourceIP,
+		FirstSeen: status.FirstSeen,
+		LastSeen:  status.LastSeen,
+		Events:    status.Events,
+		EventRate: status.EventRate,
+	})
+	if err != nil {
+		c.logger.Error("Failed to encode event", err, watermill.LogFields{
+			"event_type": string(eventType),
+		})
+		return
+	}
+
+	var server *ServerIdentity
+	if c.auth != nil && status.ServerID != "" {
+		server, _ = c.auth.registry.Lookup(status.ServerID)
+	}
+
+	// The event is timed by the collector's own clock
+	if err := c.publishEvent(string(eventType), payload, peerAddr(status.SourceIP), server, time.Time{}); err != nil {
+		c.logger.Error("Failed to publish message", err, watermill.LogFields{
+			"server_ip":  status.ServerIP,
+			"event_type": string(eventType),
+		})
+	}
+}
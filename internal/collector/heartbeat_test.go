@@ -0,0 +1,113 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/UDL-TF/UnitedStats/internal/parser"
+	"github.com/UDL-TF/UnitedStats/pkg/events"
+)
+
+// TestHeartbeats tests online tracking, event rates and going offline
+func TestHeartbeats(t *testing.T) {
+	now := time.Unix(1706788800, 0)
+	h := NewHeartbeats(2 * time.Minute)
+	h.now = func() time.Time { return now }
+
+	if _, online := h.Seen("10.0.0.1:27015", testAddr, nil); !online {
+		t.Fatal("first event did not bring the server online")
+	}
+
+	// 120 events over the next minute
+	for i := 0; i < 120; i++ {
+		now = now.Add(500 * time.Millisecond)
+		if _, online := h.Seen("10.0.0.1:27015", testAddr, nil); online {
+			t.Fatal("server came online twice")
+		}
+	}
+
+	servers := h.Servers()
+	if len(servers) != 1 || !servers[0].Online || servers[0].Events != 121 {
+		t.Fatalf("Servers() = %+v, want one online server with 121 events", servers)
+	}
+	if rate := servers[0].EventRate; rate < 1.9 || rate > 2.1 {
+		t.Errorf("EventRate = %.2f, want about 2", rate)
+	}
+	if servers[0].SourceIP != "127.0.0.1" {
+		t.Errorf("SourceIP = %q, want 127.0.0.1", servers[0].SourceIP)
+	}
+
+	now = now.Add(time.Minute)
+	if offline := h.Expire(); len(offline) != 0 {
+		t.Errorf("Expire() = %+v before the offline threshold", offline)
+	}
+
+	now = now.Add(2 * time.Minute)
+	offline := h.Expire()
+	if len(offline) != 1 || offline[0].Online || offline[0].ServerIP != "10.0.0.1:27015" {
+		t.Fatalf("Expire() = %+v, want the quiet server offline", offline)
+	}
+	if h.Online() != 0 {
+		t.Errorf("Online() = %d, want 0", h.Online())
+	}
+	if offline := h.Expire(); len(offline) != 0 {
+		t.Errorf("Expire() reported an offline server twice: %+v", offline)
+	}
+
+	status, online := h.Seen("10.0.0.1:27015", testAddr, nil)
+	if !online || status.Events != 1 {
+		t.Errorf("Seen() after going offline = %+v, %v, want a fresh online server", status, online)
+	}
+
+	now = now.Add(forgetAfter + 3*time.Minute)
+	h.Expire()
+	h.Expire()
+	if servers := h.Servers(); len(servers) != 0 {
+		t.Errorf("Servers() = %+v, want long-offline servers forgotten", servers)
+	}
+}
+
+// TestLifecycleEvents tests that the collector publishes server_online and
+// server_offline events
+func TestLifecycleEvents(t *testing.T) {
+	pub := &recordingPublisher{failAfter: -1}
+	c := New(Config{
+		Publisher:       pub,
+		Logger:          watermill.NopLogger{},
+		OfflineAfter:    time.Minute,
+		LifecycleEvents: true,
+	})
+	now := time.Unix(1706788800, 0)
+	c.heartbeats.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if err := c.handleEvent(benchmarkPayload, testAddr, nil); err != nil {
+			t.Fatalf("handleEvent() error = %v", err)
+		}
+	}
+
+	now = now.Add(2 * time.Minute)
+	c.expireHeartbeats()
+
+	wantTopics := []string{"events.server_online", "events.kill", "events.kill", "events.server_offline"}
+	if len(pub.topics) != len(wantTopics) {
+		t.Fatalf("published topics %v, want %v", pub.topics, wantTopics)
+	}
+	for i, topic := range wantTopics {
+		if pub.topics[i] != topic {
+			t.Errorf("topic %d = %s, want %s", i, pub.topics[i], topic)
+		}
+	}
+
+	event, err := parser.ParseLine(pub.payloads[3])
+	if err != nil || event == nil || event.Type != events.EventTypeServerOffline {
+		t.Fatalf("ParseLine(server_offline) = %+v, %v", event, err)
+	}
+	if event.ServerStatus.ServerIP != "192.168.1.100" || event.ServerStatus.Events != 2 {
+		t.Errorf("server_offline = %+v, want server 192.168.1.100 with 2 events", event.ServerStatus)
+	}
+	if !event.ServerStatus.LastSeen.Equal(now.Add(-2 * time.Minute)) {
+		t.Errorf("LastSeen = %v, want the time of the last event", event.ServerStatus.LastSeen)
+	}
+}
@@ -0,0 +1,135 @@
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/UDL-TF/UnitedStats/internal/parser"
+)
+
+// logPacketPrefix starts every out-of-band srcds packet
+var logPacketPrefix = []byte{0xff, 0xff, 0xff, 0xff}
+
+// Log packet errors
+var (
+	ErrMalformedLogPacket = errors.New("malformed log packet")
+	ErrUnknownLogSecret   = errors.New("unknown log secret")
+)
+
+// isLogPacket reports whether data is a native srcds log packet
+func isLogPacket(data []byte) bool {
+	return bytes.HasPrefix(data, logPacketPrefix)
+}
+
+// splitLogPacket splits a srcds log packet into its sv_logsecret (empty for
+// servers without one) and the log text.
+//
+// Servers without a secret send "\xff\xff\xff\xffRL <line>", servers with
+// sv_logsecret set send "\xff\xff\xff\xffS<secret>L <line>".
+func splitLogPacket(data []byte) (secret string, text []byte, err error) {
+	data = bytes.TrimPrefix(data, logPacketPrefix)
+	if len(data) < 2 {
+		return "", nil, ErrMalformedLogPacket
+	}
+
+	switch data[0] {
+	case 'R':
+		text = data[1:]
+	case 'S':
+		i := bytes.Index(data, []byte("L "))
+		if i < 2 {
+			return "", nil, ErrMalformedLogPacket
+		}
+		secret = string(data[1:i])
+		text = data[i:]
+	default:
+		return "", nil, ErrMalformedLogPacket
+	}
+
+	if !bytes.HasPrefix(text, []byte("L ")) {
+		return "", nil, ErrMalformedLogPacket
+	}
+
+	return secret, text, nil
+}
+
+// handleLogPacket parses a native srcds log packet and publishes the events
+// it contains
+func (c *Collector) handleLogPacket(data []byte, addr *net.UDPAddr) {
+	secret, text, err := splitLogPacket(data)
+	if err != nil {
+		c.logger.Error("Rejected log packet", err, watermill.LogFields{
+			"source": addr.String(),
+		})
+		return
+	}
+
+	// With authentication enabled, log packets must carry a registered sv_logsecret
+	var server *ServerIdentity
+	if c.auth != nil {
+		var ok bool
+		if server, ok = c.auth.registry.LookupLogSecret(secret); !ok || secret == "" {
+			c.logger.Error("Rejected log packet", ErrUnknownLogSecret, watermill.LogFields{
+				"source": addr.String(),
+			})
+			return
+		}
+	}
+
+	// Unauthenticated servers are identified by their IP, like the server_ip
+	// the plugin sends, so a server's log and JSON events are one server
+	serverID := sourceIP(addr)
+	if server != nil {
+		serverID = server.ID
+	}
+	logParser := c.logParser(serverID)
+
+	for _, line := range bytes.Split(text, []byte("\n")) {
+		parsed, err := logParser.ParseLogLine(string(line))
+		if err != nil {
+			c.logger.Debug("Failed to parse log line", watermill.LogFields{
+				"source": addr.String(),
+				"error":  err.Error(),
+			})
+			continue
+		}
+
+		for _, event := range parsed {
+			c.markSeen(serverID, addr, server)
+
+			payload, err := json.Marshal(event.Body())
+			if err != nil {
+				c.logger.Error("Failed to encode event", err, watermill.LogFields{
+					"source":     addr.String(),
+					"event_type": string(event.Type),
+				})
+				continue
+			}
+
+			// Log times are in the server's local time, which the skew absorbs
+			corrected := c.correctTimestamp(serverID, event.Base().Timestamp)
+			if err := c.publishEvent(string(event.Type), payload, addr, server, corrected); err != nil {
+				c.logger.Error("Failed to publish message", err, watermill.LogFields{
+					"source":     addr.String(),
+					"event_type": string(event.Type),
+				})
+			}
+		}
+	}
+}
+
+// logParser returns the log parser tracking state for a server
+func (c *Collector) logParser(serverID string) *parser.LogParser {
+	c.logParsersMu.Lock()
+	defer c.logParsersMu.Unlock()
+
+	p, ok := c.logParsers[serverID]
+	if !ok {
+		p = parser.NewLogParser(serverID, c.logGamemode)
+		c.logParsers[serverID] = p
+	}
+	return p
+}
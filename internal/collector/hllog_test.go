@@ -0,0 +1,78 @@
+package collector
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+)
+
+const testKillLine = `L 02/01/2024 - 12:00:00: "Player1<2><[U:1:12345]><Red>" killed "Player2<3><[U:1:67890]><Blue>" with "scattergun"` + "\n\x00"
+
+// TestHandleLogPacket tests log packet headers with and without authentication
+func TestHandleLogPacket(t *testing.T) {
+	registry, err := NewRegistry([]ServerIdentity{{ID: "eu-1", Secret: "s3cret", LogSecret: "12345"}})
+	if err != nil {
+		t.Fatalf("NewRegistry() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		registry   *Registry
+		packet     string
+		wantServer string // empty means the packet is rejected
+	}{
+		{
+			name:       "Plain packet without auth",
+			packet:     "\xff\xff\xff\xffR" + testKillLine,
+			wantServer: "127.0.0.1",
+		},
+		{
+			name:       "Secret packet with auth",
+			registry:   registry,
+			packet:     "\xff\xff\xff\xffS12345" + testKillLine,
+			wantServer: "eu-1",
+		},
+		{
+			name:     "Plain packet with auth",
+			registry: registry,
+			packet:   "\xff\xff\xff\xffR" + testKillLine,
+		},
+		{
+			name:     "Wrong secret",
+			registry: registry,
+			packet:   "\xff\xff\xff\xffS99999" + testKillLine,
+		},
+		{
+			name:   "Malformed header",
+			packet: "\xff\xff\xff\xffX" + testKillLine,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pub := &recordingPublisher{failAfter: -1}
+			c := New(Config{Publisher: pub, Logger: watermill.NopLogger{}, Registry: tt.registry})
+
+			c.handlePacket([]byte(tt.packet), &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 27015})
+
+			if tt.wantServer == "" {
+				if len(pub.payloads) != 0 {
+					t.Fatalf("published %v, want nothing", pub.payloads)
+				}
+				return
+			}
+
+			if len(pub.payloads) != 1 {
+				t.Fatalf("published %d messages, want 1", len(pub.payloads))
+			}
+			if pub.topics[0] != "events.kill" {
+				t.Errorf("topic = %q, want events.kill", pub.topics[0])
+			}
+			if !strings.Contains(pub.payloads[0], `"server_ip":"`+tt.wantServer+`"`) {
+				t.Errorf("payload = %s, want server_ip %s", pub.payloads[0], tt.wantServer)
+			}
+		})
+	}
+}
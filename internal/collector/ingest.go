@@ -0,0 +1,185 @@
+package collector
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/subtle"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/UDL-TF/UnitedStats/internal/parser"
+)
+
+// IngestReport is the response to a batch ingest request
+type IngestReport struct {
+	Accepted int               `json:"accepted"`
+	Rejected int               `json:"rejected"`
+	Errors   []IngestLineError `json:"errors,omitempty"`
+}
+
+// IngestLineError describes why a line of a batch was rejected
+type IngestLineError struct {
+	Line   int    `json:"line"`
+	Reason string `json:"reason"`
+}
+
+// peerAddr is a remote address known only as a string, such as the remote
+// address of an HTTP request
+type peerAddr string
+
+func (a peerAddr) Network() string { return "tcp" }
+func (a peerAddr) String() string  { return string(a) }
+
+// handleIngest accepts a batch of newline-delimited JSON events, optionally
+// gzip-compressed, and publishes every valid line.
+//
+//	POST /ingest
+//	Authorization: Bearer <token>
+//	Content-Encoding: gzip
+//
+// Each line is validated with parser.ParseLine, and with parser.Validate in
+// strict mode. Events keep the server_ip they carry, since a backfill may
+// contain several servers. The response lists how many lines were accepted
+// and why the others were rejected.
+func (c *Collector) handleIngest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	client, ok := c.ingestClient(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid or missing token"})
+		return
+	}
+
+	var body io.Reader = http.MaxBytesReader(w, r.Body, c.maxIngestBytes)
+	if r.Header.Get("Content-Encoding") == "gzip" || r.Header.Get("Content-Type") == "application/gzip" {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid gzip body"})
+			return
+		}
+		defer gz.Close()
+
+		// Limit the decompressed size as well
+		body = io.LimitReader(gz, c.maxIngestBytes+1)
+	}
+
+	// Lines before an oversized or unreadable part are already published, so
+	// the report is returned in every case
+	report := IngestReport{}
+	status := http.StatusOK
+	addr := peerAddr(r.RemoteAddr)
+	reader := bufio.NewReaderSize(body, maxPacketSize)
+	read := int64(0)
+
+	for lineNo := 1; ; lineNo++ {
+		line, err := readLimitedLine(reader, c.chunks.cfg.MaxSize)
+		read += int64(len(line))
+
+		var maxBytesErr *http.MaxBytesError
+		if read > c.maxIngestBytes || errors.As(err, &maxBytesErr) {
+			report.reject(lineNo, "batch too large")
+			status = http.StatusRequestEntityTooLarge
+			break
+		}
+		if errors.Is(err, ErrLineTooLong) {
+			report.reject(lineNo, err.Error())
+			status = http.StatusRequestEntityTooLarge
+			break
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			report.reject(lineNo, "failed to read body: "+err.Error())
+			status = http.StatusBadRequest
+			break
+		}
+
+		if trimmed := strings.TrimSpace(string(line)); trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			c.counters.received.Add(1)
+			if reason := c.ingestLine(trimmed, addr); reason != "" {
+				report.reject(lineNo, reason)
+			} else {
+				c.counters.processed.Add(1)
+				report.Accepted++
+			}
+		}
+
+		if err != nil {
+			break
+		}
+	}
+
+	c.logger.Info("Ingested batch", watermill.LogFields{
+		"client":   client,
+		"source":   r.RemoteAddr,
+		"accepted": report.Accepted,
+		"rejected": report.Rejected,
+	})
+
+	writeJSON(w, status, report)
+}
+
+// ingestLine validates and publishes one line, returning why it was rejected
+func (c *Collector) ingestLine(line string, addr peerAddr) string {
+	if c.limiter != nil && !c.allowSource(addr) {
+		return ErrRateLimited.Error()
+	}
+
+	event, err := parser.ParseLine(line)
+	if err != nil {
+		var parseErr *parser.ParseError
+		if errors.As(err, &parseErr) {
+			return parseErr.Reason
+		}
+		return err.Error()
+	}
+	if event == nil {
+		return "unknown event type"
+	}
+	if c.strict {
+		if err := parser.Validate(event); err != nil {
+			return err.Error()
+		}
+	}
+	if isLifecycleEvent(string(event.Type)) {
+		return ErrReservedEventType.Error()
+	}
+
+	// Backfilled events are historical, so their delay says nothing about skew
+	if err := c.publishEvent(string(event.Type), []byte(line), addr, nil, time.Time{}); err != nil {
+		return err.Error()
+	}
+
+	return ""
+}
+
+// reject records a rejected line
+func (r *IngestReport) reject(line int, reason string) {
+	r.Rejected++
+	r.Errors = append(r.Errors, IngestLineError{Line: line, Reason: reason})
+}
+
+// ingestClient returns the client name for the request's bearer token
+func (c *Collector) ingestClient(r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return "", false
+	}
+
+	// Compare against every token so the timing does not reveal a match
+	client, found := "", false
+	for candidate, name := range c.ingestTokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(candidate)) == 1 {
+			client, found = name, true
+		}
+	}
+
+	return client, found
+}
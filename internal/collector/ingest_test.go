@@ -0,0 +1,184 @@
+package collector
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+)
+
+// TestHandleIngest tests batch validation and the accepted/rejected report
+func TestHandleIngest(t *testing.T) {
+	batch := strings.Join([]string{
+		string(benchmarkPayload),
+		`{"event_type":"kill","killer":"not an object"}`,
+		``,
+		`# backfill from demo 1234`,
+		`{"event_type":"not_a_type"}`,
+		`not json`,
+		`{"timestamp":"2024-02-01T12:01:00Z","server_ip":"10.0.0.2","event_type":"healed","medic":{"steam_id":"76561198012345678","name":"Medic","team":2},"heal_points":300}`,
+	}, "\n")
+
+	var gzipped bytes.Buffer
+	gz := gzip.NewWriter(&gzipped)
+	_, _ = gz.Write([]byte(batch))
+	_ = gz.Close()
+
+	tests := []struct {
+		name         string
+		token        string
+		gzip         bool
+		wantStatus   int
+		wantAccepted int
+		wantRejected []int
+	}{
+		{
+			name:         "Gzip batch",
+			token:        "t0ken",
+			gzip:         true,
+			wantStatus:   http.StatusOK,
+			wantAccepted: 2,
+			wantRejected: []int{2, 5, 6},
+		},
+		{
+			name:         "Plain batch",
+			token:        "t0ken",
+			wantStatus:   http.StatusOK,
+			wantAccepted: 2,
+			wantRejected: []int{2, 5, 6},
+		},
+		{
+			name:       "Wrong token",
+			token:      "wrong",
+			gzip:       true,
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pub := &recordingPublisher{failAfter: -1}
+			c := New(Config{
+				Publisher:    pub,
+				Logger:       watermill.NopLogger{},
+				IngestTokens: map[string]string{"t0ken": "importer"},
+			})
+
+			body := []byte(batch)
+			if tt.gzip {
+				body = gzipped.Bytes()
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/ingest", bytes.NewReader(body))
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			if tt.gzip {
+				req.Header.Set("Content-Encoding", "gzip")
+			}
+			rec := httptest.NewRecorder()
+
+			c.handleIngest(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var report IngestReport
+			if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+				t.Fatalf("failed to decode report: %v", err)
+			}
+
+			if report.Accepted != tt.wantAccepted {
+				t.Errorf("Accepted = %d, want %d", report.Accepted, tt.wantAccepted)
+			}
+			if report.Rejected != len(tt.wantRejected) {
+				t.Fatalf("Rejected = %d, want %d (%+v)", report.Rejected, len(tt.wantRejected), report.Errors)
+			}
+			for i, line := range tt.wantRejected {
+				if report.Errors[i].Line != line || report.Errors[i].Reason == "" {
+					t.Errorf("error %d = %+v, want line %d with a reason", i, report.Errors[i], line)
+				}
+			}
+
+			wantTopics := []string{"events.kill", "events.healed"}
+			for i, topic := range wantTopics {
+				if pub.topics[i] != topic {
+					t.Errorf("topic %d = %q, want %q", i, pub.topics[i], topic)
+				}
+			}
+			if !strings.Contains(pub.payloads[1], `"server_ip":"10.0.0.2"`) {
+				t.Errorf("payload = %s, want the original server_ip", pub.payloads[1])
+			}
+			if got := pub.metadata[0].Get("source_ip"); got != "192.0.2.1" {
+				t.Errorf("source_ip = %q, want 192.0.2.1", got)
+			}
+		})
+	}
+}
+
+// TestHandleIngestTooLarge tests that oversized batches are cut off with a report
+func TestHandleIngestTooLarge(t *testing.T) {
+	pub := &recordingPublisher{failAfter: -1}
+	c := New(Config{
+		Publisher:      pub,
+		Logger:         watermill.NopLogger{},
+		IngestTokens:   map[string]string{"t0ken": "importer"},
+		MaxIngestBytes: int64(len(benchmarkPayload)*2 + 10),
+	})
+
+	body := strings.Repeat(string(benchmarkPayload)+"\n", 5)
+	req := httptest.NewRequest(http.MethodPost, "/ingest", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer t0ken")
+	rec := httptest.NewRecorder()
+
+	c.handleIngest(rec, req)
+
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+
+	var report IngestReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("failed to decode report: %v", err)
+	}
+	if report.Accepted != 2 || len(pub.payloads) != 2 {
+		t.Errorf("Accepted = %d, published = %d, want 2", report.Accepted, len(pub.payloads))
+	}
+}
+
+// TestHandleIngestRateLimited tests that the per-source limit applies to
+// ingest batch lines
+func TestHandleIngestRateLimited(t *testing.T) {
+	pub := &recordingPublisher{failAfter: -1}
+	c := New(Config{
+		Publisher:    pub,
+		Logger:       watermill.NopLogger{},
+		IngestTokens: map[string]string{"t0ken": "importer"},
+		RateLimit:    &RateLimitConfig{Source: Limit{Rate: 0.001, Burst: 2}},
+	})
+
+	body := strings.Repeat(string(benchmarkPayload)+"\n", 3)
+	req := httptest.NewRequest(http.MethodPost, "/ingest", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer t0ken")
+	rec := httptest.NewRecorder()
+
+	c.handleIngest(rec, req)
+
+	var report IngestReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("failed to decode report: %v", err)
+	}
+	if report.Accepted != 2 || len(pub.payloads) != 2 {
+		t.Errorf("Accepted = %d, published = %d, want 2", report.Accepted, len(pub.payloads))
+	}
+	if len(report.Errors) != 1 || report.Errors[0].Line != 3 || report.Errors[0].Reason != ErrRateLimited.Error() {
+		t.Errorf("Errors = %+v, want line 3 rate limited", report.Errors)
+	}
+}
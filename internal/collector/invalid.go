@@ -0,0 +1,89 @@
+package collector
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/UDL-TF/UnitedStats/internal/parser"
+	"github.com/UDL-TF/UnitedStats/pkg/events"
+)
+
+// InvalidTopic is the dead-letter topic for payloads that fail validation
+const InvalidTopic = "events.invalid"
+
+// Validation errors
+var (
+	ErrInvalidEvent     = errors.New("invalid event")
+	ErrUnknownEventType = errors.New("unknown event_type")
+)
+
+// validateEvent decodes a payload into its typed event. Strict validation also
+// checks the event's fields.
+func validateEvent(data []byte, strict bool) (*events.Event, error) {
+	decode := parser.Decode
+	if strict {
+		decode = parser.DecodeStrict
+	}
+
+	event, err := decode(data)
+	if err != nil {
+		var parseErr *parser.ParseError
+		if errors.As(err, &parseErr) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidEvent, parseErr.Reason)
+		}
+		var validationErr *parser.ValidationError
+		if errors.As(err, &validationErr) {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidEvent, validationErr)
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+	}
+	if event == nil {
+		return nil, ErrUnknownEventType
+	}
+	return event, nil
+}
+
+// rejectInvalid publishes a payload that failed validation to the dead-letter
+// topic and returns the validation error.
+//
+// The message payload is the raw bytes as received. The metadata carries the
+// reason, the sender and, when known, the event type and the server the
+// payload claims to come from.
+func (c *Collector) rejectInvalid(data []byte, addr net.Addr, server *ServerIdentity, eventType string, reason error) error {
+	c.counters.invalid.Add(1)
+
+	msg := message.NewMessage(watermill.NewUUID(), append([]byte{}, data...))
+	msg.Metadata.Set("reason", reason.Error())
+	msg.Metadata.Set("source", addr.String())
+	msg.Metadata.Set("source_ip", sourceIP(addr))
+	msg.Metadata.Set("received_at", time.Now().Format(time.RFC3339Nano))
+	if eventType != "" {
+		msg.Metadata.Set("event_type", eventType)
+	}
+
+	// Group by the verified identity, or by what the payload claims
+	if server != nil {
+		msg.Metadata.Set("server_id", server.ID)
+		msg.Metadata.Set("server_ip", server.ID)
+	} else {
+		var claimed struct {
+			ServerIP string `json:"server_ip"`
+		}
+		if json.Unmarshal(data, &claimed) == nil && claimed.ServerIP != "" {
+			msg.Metadata.Set("server_ip", claimed.ServerIP)
+		}
+	}
+
+	if err := c.publish(InvalidTopic, msg); err != nil {
+		c.logger.Error("Failed to publish invalid event", err, watermill.LogFields{
+			"source": addr.String(),
+		})
+	}
+
+	return reason
+}
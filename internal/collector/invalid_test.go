@@ -0,0 +1,107 @@
+package collector
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+)
+
+// TestHandleEventInvalid tests that invalid payloads go to the dead-letter topic
+func TestHandleEventInvalid(t *testing.T) {
+	tests := []struct {
+		name          string
+		payload       string
+		server        *ServerIdentity
+		strict        bool
+		wantErr       error
+		wantEventType string
+		wantServer    string
+	}{
+		{
+			name:    "Invalid JSON",
+			payload: `{"event_type":"kill"`,
+			wantErr: ErrInvalidJSON,
+		},
+		{
+			name:       "Missing event type",
+			payload:    `{"server_ip":"10.0.0.1"}`,
+			wantErr:    ErrMissingEventType,
+			wantServer: "10.0.0.1",
+		},
+		{
+			name:          "Unknown event type",
+			payload:       `{"server_ip":"10.0.0.1","event_type":"teabag"}`,
+			wantErr:       ErrUnknownEventType,
+			wantEventType: "teabag",
+			wantServer:    "10.0.0.1",
+		},
+		{
+			name:          "Wrong field type",
+			payload:       `{"server_ip":"10.0.0.1","event_type":"kill","killer":"Player1"}`,
+			wantErr:       ErrInvalidEvent,
+			wantEventType: "kill",
+			wantServer:    "10.0.0.1",
+		},
+		{
+			name:          "Reserved event type",
+			payload:       `{"server_ip":"10.0.0.1","event_type":"server_offline"}`,
+			wantErr:       ErrReservedEventType,
+			wantEventType: "server_offline",
+			wantServer:    "10.0.0.1",
+		},
+		{
+			name:          "Verified server",
+			payload:       `{"server_ip":"10.0.0.1","event_type":"kill","crit":"yes"}`,
+			server:        &ServerIdentity{ID: "eu-1"},
+			wantErr:       ErrInvalidEvent,
+			wantEventType: "kill",
+			wantServer:    "eu-1",
+		},
+		{
+			name:          "Strict validation",
+			payload:       `{"timestamp":"2024-02-01T12:00:00Z","server_ip":"10.0.0.1","event_type":"match_start","map":""}`,
+			strict:        true,
+			wantErr:       ErrInvalidEvent,
+			wantEventType: "match_start",
+			wantServer:    "10.0.0.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pub := &recordingPublisher{failAfter: -1}
+			c := New(Config{Publisher: pub, Logger: watermill.NopLogger{}, StrictValidation: tt.strict})
+
+			err := c.handleEvent([]byte(tt.payload), testAddr, tt.server)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("handleEvent() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if len(pub.topics) != 1 || pub.topics[0] != InvalidTopic {
+				t.Fatalf("published to %v, want [%s]", pub.topics, InvalidTopic)
+			}
+			if pub.payloads[0] != tt.payload {
+				t.Errorf("payload = %q, want the raw bytes %q", pub.payloads[0], tt.payload)
+			}
+
+			metadata := pub.metadata[0]
+			if metadata.Get("reason") != err.Error() {
+				t.Errorf("reason = %q, want %q", metadata.Get("reason"), err.Error())
+			}
+			if metadata.Get("source") != testAddr.String() {
+				t.Errorf("source = %q, want %q", metadata.Get("source"), testAddr.String())
+			}
+			if metadata.Get("event_type") != tt.wantEventType {
+				t.Errorf("event_type = %q, want %q", metadata.Get("event_type"), tt.wantEventType)
+			}
+			if metadata.Get("server_ip") != tt.wantServer {
+				t.Errorf("server_ip = %q, want %q", metadata.Get("server_ip"), tt.wantServer)
+			}
+
+			if stats := c.Stats(); stats.Invalid != 1 {
+				t.Errorf("Invalid = %d, want 1", stats.Invalid)
+			}
+		})
+	}
+}
@@ -0,0 +1,257 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+)
+
+// maxPacketSize is the largest datagram the collector accepts, signature
+// header included (the plugin's SUPERLOGS_MAX_PACKET_SIZE). Larger events
+// must be chunked by the sender (see Reassembler).
+const maxPacketSize = 4096
+
+// DropPolicy decides what happens to a packet when the intake queue is full
+type DropPolicy string
+
+const (
+	// DropNewest discards the packet that was just read
+	DropNewest DropPolicy = "drop_newest"
+	// DropOldest discards the oldest queued packet to make room
+	DropOldest DropPolicy = "drop_oldest"
+	// Block stalls the read loop until a worker frees a slot.
+	// The kernel socket buffer absorbs bursts and drops once it is full.
+	Block DropPolicy = "block"
+)
+
+// ParseDropPolicy parses a drop policy name
+func ParseDropPolicy(s string) (DropPolicy, error) {
+	switch policy := DropPolicy(s); policy {
+	case DropNewest, DropOldest, Block:
+		return policy, nil
+	case "":
+		return DropNewest, nil
+	default:
+		return "", fmt.Errorf("unknown drop policy %q", s)
+	}
+}
+
+// packet is a datagram waiting for a worker.
+// buf is owned by the packet until it is released back to the pool.
+type packet struct {
+	buf  *[]byte
+	n    int
+	addr *net.UDPAddr
+}
+
+func (p *packet) data() []byte {
+	return (*p.buf)[:p.n]
+}
+
+// bufferPool recycles read buffers between the read loop and the workers
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		// One spare byte detects datagrams the kernel had to truncate
+		buf := make([]byte, maxPacketSize+1)
+		return &buf
+	},
+}
+
+// Stats holds collector intake counters
+type Stats struct {
+	Received   uint64 `json:"received"`
+	Processed  uint64 `json:"processed"`
+	Dropped    uint64 `json:"dropped"`
+	QueueDepth int    `json:"queue_depth"`
+	QueueSize  int    `json:"queue_size"`
+
+	Invalid       uint64 `json:"invalid"`
+	Truncated     uint64 `json:"truncated"`
+	Reassembled   uint64 `json:"reassembled"`
+	ChunkErrors   uint64 `json:"chunk_errors"`
+	PendingChunks int    `json:"pending_chunks"`
+
+	TCPConnections int64 `json:"tcp_connections"`
+	ServersOnline  int   `json:"servers_online"`
+	SkewedServers  int   `json:"skewed_servers"`
+
+	Captured      uint64 `json:"captured,omitempty"`
+	CaptureErrors uint64 `json:"capture_errors,omitempty"`
+
+	Forward   []ForwardStats  `json:"forward,omitempty"`
+	RateLimit *RateLimitStats `json:"rate_limit,omitempty"`
+	Spool     *SpoolStats     `json:"spool,omitempty"`
+}
+
+// intakeCounters are updated by the read loop and the workers
+type intakeCounters struct {
+	received  atomic.Uint64
+	processed atomic.Uint64
+	dropped   atomic.Uint64
+
+	invalid     atomic.Uint64
+	truncated   atomic.Uint64
+	reassembled atomic.Uint64
+	chunkErrors atomic.Uint64
+
+	tcpConnections atomic.Int64
+
+	captured      atomic.Uint64
+	captureErrors atomic.Uint64
+}
+
+// Stats returns a snapshot of the intake counters
+func (c *Collector) Stats() Stats {
+	stats := Stats{
+		Received:   c.counters.received.Load(),
+		Processed:  c.counters.processed.Load(),
+		Dropped:    c.counters.dropped.Load(),
+		QueueDepth: len(c.queue),
+		QueueSize:  cap(c.queue),
+
+		Invalid:       c.counters.invalid.Load(),
+		Truncated:     c.counters.truncated.Load(),
+		Reassembled:   c.counters.reassembled.Load(),
+		ChunkErrors:   c.counters.chunkErrors.Load(),
+		PendingChunks: c.chunks.Pending(),
+
+		TCPConnections: c.counters.tcpConnections.Load(),
+		ServersOnline:  c.heartbeats.Online(),
+		SkewedServers:  c.skew.Skewed(),
+
+		Captured:      c.counters.captured.Load(),
+		CaptureErrors: c.counters.captureErrors.Load(),
+	}
+
+	for _, f := range c.forwarders {
+		stats.Forward = append(stats.Forward, f.stats())
+	}
+
+	if c.limiter != nil {
+		rateLimitStats := c.limiter.Stats()
+		stats.RateLimit = &rateLimitStats
+	}
+
+	if c.spool != nil {
+		spoolStats := c.spool.Stats()
+		stats.Spool = &spoolStats
+	}
+
+	return stats
+}
+
+// enqueue hands a packet to the worker pool according to the drop policy.
+// It returns false if the context was cancelled while blocking.
+func (c *Collector) enqueue(ctx context.Context, p packet) bool {
+	c.counters.received.Add(1)
+
+	switch c.dropPolicy {
+	case Block:
+		select {
+		case c.queue <- p:
+		case <-ctx.Done():
+			c.drop(p)
+			return false
+		}
+
+	case DropOldest:
+		for {
+			select {
+			case c.queue <- p:
+				return true
+			default:
+			}
+
+			// Queue is full, evict the oldest packet and retry
+			select {
+			case old := <-c.queue:
+				c.drop(old)
+			default:
+			}
+		}
+
+	default:
+		select {
+		case c.queue <- p:
+		default:
+			c.drop(p)
+		}
+	}
+
+	return true
+}
+
+// drop discards a packet and counts it
+func (c *Collector) drop(p packet) {
+	c.counters.dropped.Add(1)
+	bufferPool.Put(p.buf)
+}
+
+// startWorkers starts the fixed-size worker pool
+func (c *Collector) startWorkers() *sync.WaitGroup {
+	var wg sync.WaitGroup
+
+	for i := 0; i < c.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range c.queue {
+				c.handlePacket(p.data(), p.addr)
+				bufferPool.Put(p.buf)
+				c.counters.processed.Add(1)
+			}
+		}()
+	}
+
+	return &wg
+}
+
+// reportStats logs the intake counters periodically
+func (c *Collector) reportStats(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			stats := c.Stats()
+			fields := watermill.LogFields{
+				"received":     stats.Received,
+				"processed":    stats.Processed,
+				"dropped":      stats.Dropped,
+				"queue_depth":  stats.QueueDepth,
+				"truncated":    stats.Truncated,
+				"reassembled":  stats.Reassembled,
+				"chunk_errors": stats.ChunkErrors,
+				"servers":      stats.ServersOnline,
+				"skewed":       stats.SkewedServers,
+			}
+			if stats.RateLimit != nil {
+				fields["throttled"] = stats.RateLimit.Throttled
+				fields["throttled_events"] = stats.RateLimit.ThrottledEvents
+				fields["quarantined"] = stats.RateLimit.Quarantined
+			}
+			if c.capture != nil {
+				fields["captured"] = stats.Captured
+				fields["capture_errors"] = stats.CaptureErrors
+			}
+			for _, forward := range stats.Forward {
+				fields["forward_"+forward.Name+"_dropped"] = forward.Dropped
+				fields["forward_"+forward.Name+"_failed"] = forward.Failed
+			}
+			if stats.Spool != nil {
+				fields["spool_depth"] = stats.Spool.Depth
+				fields["spool_bytes"] = stats.Spool.Bytes
+				fields["spool_discarded"] = stats.Spool.Discarded
+			}
+			c.logger.Info("Collector stats", fields)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package collector
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// countingPublisher counts published messages and discards them
+type countingPublisher struct {
+	published atomic.Uint64
+}
+
+func (p *countingPublisher) Publish(topic string, messages ...*message.Message) error {
+	p.published.Add(uint64(len(messages)))
+	return nil
+}
+
+func (p *countingPublisher) Close() error {
+	return nil
+}
+
+var benchmarkPayload = []byte(`{"timestamp":"2024-02-01T12:00:00Z","gamemode":"default","server_ip":"192.168.1.100","event_type":"kill","killer":{"steam_id":"76561198012345678","name":"Player1","team":2},"victim":{"steam_id":"76561198087654321","name":"Player2","team":3},"weapon":{"name":"scattergun"},"crit":false,"airborne":false}`)
+
+func newTestPacket(payload string) packet {
+	buf := bufferPool.Get().(*[]byte)
+	n := copy(*buf, payload)
+	return packet{buf: buf, n: n, addr: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 27015}}
+}
+
+// TestEnqueueDropPolicies tests queue overflow behaviour for each drop policy
+func TestEnqueueDropPolicies(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    DropPolicy
+		wantQueue []string
+	}{
+		{
+			name:      "Drop newest",
+			policy:    DropNewest,
+			wantQueue: []string{"first", "second"},
+		},
+		{
+			name:      "Drop oldest",
+			policy:    DropOldest,
+			wantQueue: []string{"second", "third"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New(Config{
+				Publisher:  &countingPublisher{},
+				Logger:     watermill.NopLogger{},
+				QueueSize:  2,
+				DropPolicy: tt.policy,
+			})
+
+			ctx := context.Background()
+			for _, payload := range []string{"first", "second", "third"} {
+				c.enqueue(ctx, newTestPacket(payload))
+			}
+
+			stats := c.Stats()
+			if stats.Received != 3 {
+				t.Errorf("Received = %d, want 3", stats.Received)
+			}
+			if stats.Dropped != 1 {
+				t.Errorf("Dropped = %d, want 1", stats.Dropped)
+			}
+
+			for _, want := range tt.wantQueue {
+				p := <-c.queue
+				if got := string(p.data()); got != want {
+					t.Errorf("queued packet = %q, want %q", got, want)
+				}
+			}
+		})
+	}
+}
+
+// TestEnqueueBlockCancelled tests that a blocked enqueue gives up on cancellation
+func TestEnqueueBlockCancelled(t *testing.T) {
+	c := New(Config{
+		Publisher:  &countingPublisher{},
+		Logger:     watermill.NopLogger{},
+		QueueSize:  1,
+		DropPolicy: Block,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.enqueue(ctx, newTestPacket("first"))
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	if c.enqueue(ctx, newTestPacket("second")) {
+		t.Error("enqueue() = true, want false after cancellation")
+	}
+}
+
+// TestWorkersDoNotShareBuffers tests that queued packets keep their own data
+func TestWorkersDoNotShareBuffers(t *testing.T) {
+	pub := &countingPublisher{}
+	c := New(Config{
+		Publisher: pub,
+		Logger:    watermill.NopLogger{},
+		Workers:   4,
+		QueueSize: 64,
+	})
+
+	ctx := context.Background()
+	for i := 0; i < 64; i++ {
+		c.enqueue(ctx, newTestPacket(string(benchmarkPayload)))
+	}
+
+	close(c.queue)
+	c.startWorkers().Wait()
+
+	if got := pub.published.Load(); got != 64 {
+		t.Errorf("published = %d, want 64", got)
+	}
+}
+
+// BenchmarkWorkerPool measures intake throughput without the network
+func BenchmarkWorkerPool(b *testing.B) {
+	pub := &countingPublisher{}
+	c := New(Config{
+		Publisher:  pub,
+		Logger:     watermill.NopLogger{},
+		DropPolicy: Block,
+	})
+
+	ctx := context.Background()
+	workers := c.startWorkers()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	start := time.Now()
+
+	for i := 0; i < b.N; i++ {
+		buf := bufferPool.Get().(*[]byte)
+		n := copy(*buf, benchmarkPayload)
+		c.enqueue(ctx, packet{buf: buf, n: n, addr: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}})
+	}
+
+	close(c.queue)
+	workers.Wait()
+
+	b.ReportMetric(float64(pub.published.Load())/time.Since(start).Seconds(), "packets/s")
+}
+
+// BenchmarkUDPThroughput measures end-to-end intake over loopback UDP with
+// an unpaced sender
+func BenchmarkUDPThroughput(b *testing.B) {
+	benchmarkUDP(b, 0)
+}
+
+// BenchmarkUDPSustained10k measures intake with a sender paced at 10k packets/s
+func BenchmarkUDPSustained10k(b *testing.B) {
+	benchmarkUDP(b, 10000)
+}
+
+// BenchmarkUDPSustained50k measures intake with a sender paced at 50k packets/s
+func BenchmarkUDPSustained50k(b *testing.B) {
+	benchmarkUDP(b, 50000)
+}
+
+// benchmarkUDP sends b.N packets over loopback at rate packets/s (0 = unpaced)
+// and reports processed packets/s and the share lost in the kernel
+func benchmarkUDP(b *testing.B, rate int) {
+	pub := &countingPublisher{}
+	c := New(Config{
+		Publisher:  pub,
+		Logger:     watermill.NopLogger{},
+		DropPolicy: Block,
+	})
+
+	if err := c.listen(); err != nil {
+		b.Fatalf("listen() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- c.serve(ctx) }()
+
+	conn, err := net.DialUDP("udp", nil, c.conn.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		b.Fatalf("DialUDP() error = %v", err)
+	}
+	defer conn.Close()
+
+	// Send in 1ms slices so pacing does not depend on timer resolution
+	perTick := b.N
+	if rate > 0 {
+		perTick = max(rate/1000, 1)
+	}
+	ticker := time.NewTicker(time.Millisecond)
+	defer ticker.Stop()
+
+	b.ResetTimer()
+	start := time.Now()
+
+	for sent := 0; sent < b.N; {
+		for i := 0; i < perTick && sent < b.N; i++ {
+			if _, err := conn.Write(benchmarkPayload); err != nil {
+				b.Fatalf("Write() error = %v", err)
+			}
+			sent++
+		}
+		if rate > 0 {
+			<-ticker.C
+		}
+	}
+
+	// Wait until the collector stops making progress
+	for last := uint64(0); ; {
+		time.Sleep(50 * time.Millisecond)
+		received := c.Stats().Received
+		if received >= uint64(b.N) || received == last {
+			break
+		}
+		last = received
+	}
+	elapsed := time.Since(start)
+
+	cancel()
+	<-done
+
+	stats := c.Stats()
+	b.ReportMetric(float64(pub.published.Load())/elapsed.Seconds(), "packets/s")
+	b.ReportMetric(float64(uint64(b.N)-stats.Received)/float64(b.N)*100, "kernel_drop_%")
+}
@@ -0,0 +1,329 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+)
+
+// ErrRateLimited is returned for events above their rate limit
+var ErrRateLimited = errors.New("rate limited")
+
+// Limit is a token bucket rate: Rate tokens per second up to Burst tokens.
+// A zero Rate means no limit.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// RateLimitConfig holds flood protection settings
+type RateLimitConfig struct {
+	// Source limits packets per source IP. Each event line of a TCP
+	// connection or an HTTP ingest batch counts as a packet.
+	Source Limit
+	// Event limits events per source IP and event type
+	Event Limit
+	// EventLimits overrides Event for specific event types
+	EventLimits map[string]Limit
+
+	// QuarantineThreshold is how many packets a source may have throttled in
+	// a row before it is quarantined (default 100)
+	QuarantineThreshold int
+	// QuarantineDuration is how long all packets from a quarantined source
+	// are dropped (default 1m)
+	QuarantineDuration time.Duration
+
+	// Exempt sources are never limited
+	Exempt []*net.IPNet
+}
+
+// RateLimitStats holds throttling counters
+type RateLimitStats struct {
+	Throttled       uint64 `json:"throttled"`
+	ThrottledEvents uint64 `json:"throttled_events"`
+	Quarantines     uint64 `json:"quarantines"`
+	Quarantined     int    `json:"quarantined"`
+}
+
+// bucket is a token bucket
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// allow takes a token if one is available
+func (b *bucket) allow(limit Limit, now time.Time) bool {
+	if b.last.IsZero() {
+		b.tokens = float64(limit.Burst)
+	} else {
+		b.tokens += now.Sub(b.last).Seconds() * limit.Rate
+		if b.tokens > float64(limit.Burst) {
+			b.tokens = float64(limit.Burst)
+		}
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// sourceState tracks one source IP
+type sourceState struct {
+	bucket
+	throttled        int
+	quarantinedUntil time.Time
+}
+
+// eventKey identifies an event bucket
+type eventKey struct {
+	source    string
+	eventType string
+}
+
+// RateLimiter applies token bucket limits per source and per event type
+type RateLimiter struct {
+	cfg RateLimitConfig
+	now func() time.Time
+
+	mu      sync.Mutex
+	sources map[string]*sourceState
+	events  map[eventKey]*bucket
+	stats   RateLimitStats
+}
+
+// NewRateLimiter creates a rate limiter. Bursts default to one second of rate.
+func NewRateLimiter(cfg RateLimitConfig) *RateLimiter {
+	if cfg.QuarantineThreshold <= 0 {
+		cfg.QuarantineThreshold = 100
+	}
+	if cfg.QuarantineDuration <= 0 {
+		cfg.QuarantineDuration = time.Minute
+	}
+	cfg.Source = withDefaultBurst(cfg.Source)
+	cfg.Event = withDefaultBurst(cfg.Event)
+	eventLimits := make(map[string]Limit, len(cfg.EventLimits))
+	for eventType, limit := range cfg.EventLimits {
+		eventLimits[eventType] = withDefaultBurst(limit)
+	}
+	cfg.EventLimits = eventLimits
+
+	return &RateLimiter{
+		cfg:     cfg,
+		now:     time.Now,
+		sources: make(map[string]*sourceState),
+		events:  make(map[eventKey]*bucket),
+	}
+}
+
+// withDefaultBurst sets the burst of a limit to one second of rate if unset
+func withDefaultBurst(limit Limit) Limit {
+	if limit.Rate > 0 && limit.Burst <= 0 {
+		limit.Burst = max(int(limit.Rate), 1)
+	}
+	return limit
+}
+
+// exempt reports whether ip is never limited
+func (r *RateLimiter) exempt(ip net.IP) bool {
+	for _, network := range r.cfg.Exempt {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowSource reports whether a packet from ip may be processed. quarantined
+// is true when this packet put the source into quarantine.
+func (r *RateLimiter) AllowSource(ip net.IP) (allowed, quarantined bool) {
+	if r.cfg.Source.Rate <= 0 || r.exempt(ip) {
+		return true, false
+	}
+
+	now := r.now()
+	key := ip.String()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	state, ok := r.sources[key]
+	if !ok {
+		state = &sourceState{}
+		r.sources[key] = state
+	}
+
+	if now.Before(state.quarantinedUntil) {
+		r.stats.Throttled++
+		return false, false
+	}
+
+	if state.allow(r.cfg.Source, now) {
+		state.throttled = 0
+		return true, false
+	}
+
+	r.stats.Throttled++
+	state.throttled++
+	if state.throttled < r.cfg.QuarantineThreshold {
+		return false, false
+	}
+
+	state.throttled = 0
+	state.quarantinedUntil = now.Add(r.cfg.QuarantineDuration)
+	r.stats.Quarantines++
+	return false, true
+}
+
+// AllowEvent reports whether an event of eventType from ip may be published
+func (r *RateLimiter) AllowEvent(ip net.IP, eventType string) bool {
+	limit, ok := r.cfg.EventLimits[eventType]
+	if !ok {
+		limit = r.cfg.Event
+	}
+	if limit.Rate <= 0 || r.exempt(ip) {
+		return true
+	}
+
+	now := r.now()
+	key := eventKey{source: ip.String(), eventType: eventType}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, ok := r.events[key]
+	if !ok {
+		b = &bucket{}
+		r.events[key] = b
+	}
+
+	if b.allow(limit, now) {
+		return true
+	}
+
+	r.stats.ThrottledEvents++
+	return false
+}
+
+// Sweep forgets sources and event buckets that have been idle for longer
+// than idle and are no longer quarantined
+func (r *RateLimiter) Sweep(idle time.Duration) {
+	cutoff := r.now().Add(-idle)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for key, state := range r.sources {
+		if state.last.Before(cutoff) && state.quarantinedUntil.Before(cutoff) {
+			delete(r.sources, key)
+		}
+	}
+	for key, b := range r.events {
+		if b.last.Before(cutoff) {
+			delete(r.events, key)
+		}
+	}
+}
+
+// Stats returns a snapshot of the throttling counters
+func (r *RateLimiter) Stats() RateLimitStats {
+	now := r.now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats := r.stats
+	for _, state := range r.sources {
+		if now.Before(state.quarantinedUntil) {
+			stats.Quarantined++
+		}
+	}
+	return stats
+}
+
+// ParseLimit parses a "rate" or "rate:burst" limit
+func ParseLimit(s string) (Limit, error) {
+	rateStr, burstStr, hasBurst := strings.Cut(s, ":")
+
+	rate, err := strconv.ParseFloat(rateStr, 64)
+	if err != nil || rate < 0 {
+		return Limit{}, fmt.Errorf("invalid rate %q", rateStr)
+	}
+
+	limit := Limit{Rate: rate}
+	if hasBurst {
+		if limit.Burst, err = strconv.Atoi(burstStr); err != nil || limit.Burst < 0 {
+			return Limit{}, fmt.Errorf("invalid burst %q", burstStr)
+		}
+	}
+	return limit, nil
+}
+
+// ParseNetworks parses a comma-separated list of CIDRs and plain IPs
+func ParseNetworks(s string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", entry)
+			}
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q: %w", entry, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// allowSource applies the per-source limit to a UDP packet, or to an event
+// line of a TCP connection or ingest batch
+func (c *Collector) allowSource(addr net.Addr) bool {
+	ip := sourceIP(addr)
+	allowed, quarantined := c.limiter.AllowSource(net.ParseIP(ip))
+	if quarantined {
+		c.logger.Info("Source quarantined", watermill.LogFields{
+			"source":   ip,
+			"duration": c.limiter.cfg.QuarantineDuration.String(),
+		})
+	}
+	return allowed
+}
+
+// sweepRateLimits periodically forgets idle sources
+func (c *Collector) sweepRateLimits(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.limiter.Sweep(5 * time.Minute)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package collector
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+)
+
+// newTestLimiter creates a rate limiter with a controllable clock
+func newTestLimiter(cfg RateLimitConfig) (*RateLimiter, *time.Time) {
+	now := time.Unix(1706788800, 0)
+	r := NewRateLimiter(cfg)
+	r.now = func() time.Time { return now }
+	return r, &now
+}
+
+// TestRateLimiterSource tests the per-source token bucket and quarantine
+func TestRateLimiterSource(t *testing.T) {
+	r, now := newTestLimiter(RateLimitConfig{
+		Source:              Limit{Rate: 10, Burst: 5},
+		QuarantineThreshold: 3,
+		QuarantineDuration:  time.Minute,
+	})
+	ip := net.IPv4(10, 0, 0, 1)
+
+	// The burst is available immediately
+	for i := 0; i < 5; i++ {
+		if allowed, _ := r.AllowSource(ip); !allowed {
+			t.Fatalf("packet %d throttled within burst", i)
+		}
+	}
+	if allowed, _ := r.AllowSource(ip); allowed {
+		t.Fatal("packet above burst allowed")
+	}
+
+	// Tokens refill at the configured rate
+	*now = now.Add(100 * time.Millisecond)
+	if allowed, _ := r.AllowSource(ip); !allowed {
+		t.Fatal("packet throttled after refill")
+	}
+
+	// Other sources have their own bucket
+	if allowed, _ := r.AllowSource(net.IPv4(10, 0, 0, 2)); !allowed {
+		t.Fatal("other source throttled")
+	}
+
+	// Continued flooding triggers quarantine
+	r.AllowSource(ip)
+	r.AllowSource(ip)
+	if _, quarantined := r.AllowSource(ip); !quarantined {
+		t.Fatal("source not quarantined after threshold")
+	}
+
+	*now = now.Add(30 * time.Second)
+	if allowed, _ := r.AllowSource(ip); allowed {
+		t.Fatal("quarantined source allowed")
+	}
+
+	stats := r.Stats()
+	if stats.Quarantines != 1 || stats.Quarantined != 1 {
+		t.Errorf("Stats() = %+v, want one quarantined source", stats)
+	}
+	if stats.Throttled != 5 {
+		t.Errorf("Throttled = %d, want 5", stats.Throttled)
+	}
+
+	*now = now.Add(31 * time.Second)
+	if allowed, _ := r.AllowSource(ip); !allowed {
+		t.Fatal("source still throttled after quarantine")
+	}
+}
+
+// TestRateLimiterEvents tests per-event-type limits and overrides
+func TestRateLimiterEvents(t *testing.T) {
+	r, _ := newTestLimiter(RateLimitConfig{
+		Event:       Limit{Rate: 1, Burst: 1},
+		EventLimits: map[string]Limit{"weapon_stats": {Rate: 100, Burst: 3}},
+	})
+	ip := net.IPv4(10, 0, 0, 1)
+
+	if !r.AllowEvent(ip, "kill") || r.AllowEvent(ip, "kill") {
+		t.Error("kill events not limited to a burst of 1")
+	}
+	if !r.AllowEvent(ip, "healed") {
+		t.Error("healed event throttled by the kill bucket")
+	}
+
+	for i := 0; i < 3; i++ {
+		if !r.AllowEvent(ip, "weapon_stats") {
+			t.Fatalf("weapon_stats event %d throttled within override burst", i)
+		}
+	}
+	if r.AllowEvent(ip, "weapon_stats") {
+		t.Error("weapon_stats event above override burst allowed")
+	}
+
+	if stats := r.Stats(); stats.ThrottledEvents != 2 {
+		t.Errorf("ThrottledEvents = %d, want 2", stats.ThrottledEvents)
+	}
+}
+
+// TestRateLimiterExempt tests that exempt networks are never limited
+func TestRateLimiterExempt(t *testing.T) {
+	exempt, err := ParseNetworks("10.0.0.0/8, 192.168.1.5")
+	if err != nil {
+		t.Fatalf("ParseNetworks() error = %v", err)
+	}
+
+	r, _ := newTestLimiter(RateLimitConfig{Source: Limit{Rate: 1, Burst: 1}, Exempt: exempt})
+
+	for _, ip := range []net.IP{net.IPv4(10, 1, 2, 3), net.IPv4(192, 168, 1, 5)} {
+		for i := 0; i < 10; i++ {
+			if allowed, _ := r.AllowSource(ip); !allowed {
+				t.Fatalf("exempt source %s throttled", ip)
+			}
+		}
+	}
+
+	ip := net.IPv4(192, 168, 1, 6)
+	r.AllowSource(ip)
+	if allowed, _ := r.AllowSource(ip); allowed {
+		t.Error("non-exempt source not throttled")
+	}
+}
+
+// TestParseLimit tests parsing rate limits from configuration
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Limit
+		wantErr bool
+	}{
+		{input: "100", want: Limit{Rate: 100}},
+		{input: "2.5:10", want: Limit{Rate: 2.5, Burst: 10}},
+		{input: "fast", wantErr: true},
+		{input: "10:-1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseLimit(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLimit() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseLimit() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestHandleEventRateLimited tests that throttled events are not published
+func TestHandleEventRateLimited(t *testing.T) {
+	pub := &recordingPublisher{failAfter: -1}
+	c := New(Config{
+		Publisher: pub,
+		Logger:    watermill.NopLogger{},
+		RateLimit: &RateLimitConfig{Event: Limit{Rate: 1, Burst: 2}},
+	})
+
+	var errs []error
+	for i := 0; i < 3; i++ {
+		errs = append(errs, c.handleEvent(benchmarkPayload, testAddr, nil))
+	}
+
+	if errs[0] != nil || errs[1] != nil || !errors.Is(errs[2], ErrRateLimited) {
+		t.Errorf("handleEvent() errors = %v, want nil, nil, ErrRateLimited", errs)
+	}
+	if len(pub.payloads) != 2 {
+		t.Errorf("published %d events, want 2", len(pub.payloads))
+	}
+}
@@ -0,0 +1,146 @@
+package collector
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+)
+
+// ErrClockSkew is logged when a server's clock drifts past the skew threshold
+var ErrClockSkew = errors.New("server clock skew above threshold")
+
+// SkewConfig holds clock skew estimation settings
+type SkewConfig struct {
+	// Window is how many recent events the skew is the median of (default 64)
+	Window int
+	// Threshold is the skew above which a server is reported (default 10s)
+	Threshold time.Duration
+}
+
+// skewState holds the recent samples of one server
+type skewState struct {
+	samples []time.Duration // ring buffer of received_at - timestamp
+	next    int
+	skew    time.Duration
+	skewed  bool
+}
+
+// SkewEstimator estimates how far each server's clock is from the
+// collector's, as the rolling median of received_at minus the event timestamp.
+// The median ignores events that were delayed in transit, such as ones
+// resent after a reconnect.
+type SkewEstimator struct {
+	cfg SkewConfig
+
+	mu      sync.Mutex
+	servers map[string]*skewState
+	sorted  []time.Duration
+}
+
+// NewSkewEstimator creates a skew estimator
+func NewSkewEstimator(cfg SkewConfig) *SkewEstimator {
+	if cfg.Window <= 0 {
+		cfg.Window = 64
+	}
+	if cfg.Threshold <= 0 {
+		cfg.Threshold = 10 * time.Second
+	}
+
+	return &SkewEstimator{
+		cfg:     cfg,
+		servers: make(map[string]*skewState),
+		sorted:  make([]time.Duration, 0, cfg.Window),
+	}
+}
+
+// Observe adds a sample for a server and returns its estimated skew. changed
+// is true when the sample moved the server across the threshold.
+func (e *SkewEstimator) Observe(serverIP string, timestamp, receivedAt time.Time) (skew time.Duration, changed bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	state, ok := e.servers[serverIP]
+	if !ok {
+		state = &skewState{samples: make([]time.Duration, 0, e.cfg.Window)}
+		e.servers[serverIP] = state
+	}
+
+	sample := receivedAt.Sub(timestamp)
+	if len(state.samples) < e.cfg.Window {
+		state.samples = append(state.samples, sample)
+	} else {
+		state.samples[state.next] = sample
+	}
+	state.next = (state.next + 1) % e.cfg.Window
+
+	e.sorted = append(e.sorted[:0], state.samples...)
+	sort.Slice(e.sorted, func(i, j int) bool { return e.sorted[i] < e.sorted[j] })
+	state.skew = e.sorted[len(e.sorted)/2]
+
+	skewed := state.skew > e.cfg.Threshold || state.skew < -e.cfg.Threshold
+	changed = skewed != state.skewed
+	state.skewed = skewed
+
+	return state.skew, changed
+}
+
+// Skew returns the estimated skew of a server
+func (e *SkewEstimator) Skew(serverIP string) (time.Duration, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	state, ok := e.servers[serverIP]
+	if !ok {
+		return 0, false
+	}
+	return state.skew, true
+}
+
+// Skewed returns how many servers are over the threshold
+func (e *SkewEstimator) Skewed() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	skewed := 0
+	for _, state := range e.servers {
+		if state.skewed {
+			skewed++
+		}
+	}
+	return skewed
+}
+
+// Forget drops the samples of a server, so a restarted server starts afresh
+func (e *SkewEstimator) Forget(serverIP string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	delete(e.servers, serverIP)
+}
+
+// correctTimestamp estimates the skew of a server from an event timestamp and
+// returns the timestamp on the collector's clock
+func (c *Collector) correctTimestamp(serverIP string, timestamp time.Time) time.Time {
+	if timestamp.IsZero() {
+		return timestamp
+	}
+
+	skew, changed := c.skew.Observe(serverIP, timestamp, time.Now())
+	if changed {
+		fields := watermill.LogFields{
+			"server_ip": serverIP,
+			"skew":      skew.Round(time.Millisecond).String(),
+			"threshold": c.skew.cfg.Threshold.String(),
+		}
+		if skew > c.skew.cfg.Threshold || skew < -c.skew.cfg.Threshold {
+			c.logger.Error("Server clock skewed", ErrClockSkew, fields)
+		} else {
+			c.logger.Info("Server clock skew recovered", fields)
+		}
+	}
+
+	return timestamp.Add(skew)
+}
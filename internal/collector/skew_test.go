@@ -0,0 +1,78 @@
+package collector
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+)
+
+// TestSkewEstimator tests the rolling median and threshold crossings
+func TestSkewEstimator(t *testing.T) {
+	e := NewSkewEstimator(SkewConfig{Window: 5, Threshold: 10 * time.Second})
+	now := time.Unix(1706788800, 0)
+
+	// A server 30s behind, with one event that was delayed in transit
+	offsets := []time.Duration{30, 31, 300, 29, 30}
+	var skew time.Duration
+	var changes int
+	for i, offset := range offsets {
+		received := now.Add(time.Duration(i) * time.Second)
+		var changed bool
+		skew, changed = e.Observe("10.0.0.1", received.Add(-offset*time.Second), received)
+		if changed {
+			changes++
+		}
+	}
+
+	if skew != 30*time.Second {
+		t.Errorf("skew = %v, want 30s", skew)
+	}
+	if changes != 1 || e.Skewed() != 1 {
+		t.Errorf("changes = %d, Skewed() = %d, want the server reported once", changes, e.Skewed())
+	}
+
+	// Once the clock is fixed the window fills with good samples
+	for i := 0; i < 5; i++ {
+		received := now.Add(time.Minute + time.Duration(i)*time.Second)
+		skew, _ = e.Observe("10.0.0.1", received.Add(-50*time.Millisecond), received)
+	}
+	if skew != 50*time.Millisecond || e.Skewed() != 0 {
+		t.Errorf("skew = %v, Skewed() = %d after the clock was fixed", skew, e.Skewed())
+	}
+
+	if _, ok := e.Skew("10.0.0.2"); ok {
+		t.Error("Skew() reported an unknown server")
+	}
+	e.Forget("10.0.0.1")
+	if _, ok := e.Skew("10.0.0.1"); ok {
+		t.Error("Skew() reported a forgotten server")
+	}
+}
+
+// TestCorrectedTimestamp tests that events are published with a timestamp on
+// the collector's clock
+func TestCorrectedTimestamp(t *testing.T) {
+	pub := &recordingPublisher{failAfter: -1}
+	c := New(Config{Publisher: pub, Logger: watermill.NopLogger{}})
+
+	// The server's clock is an hour behind
+	timestamp := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	payload := fmt.Sprintf(`{"timestamp":%q,"gamemode":"default","server_ip":"10.0.0.1","event_type":"kill","killer":{"steam_id":"76561198012345678","name":"Player1","team":2},"victim":{"steam_id":"76561198087654321","name":"Player2","team":3},"weapon":{"name":"scattergun"}}`, timestamp)
+
+	if err := c.handleEvent([]byte(payload), testAddr, nil); err != nil {
+		t.Fatalf("handleEvent() error = %v", err)
+	}
+
+	corrected, err := time.Parse(time.RFC3339Nano, pub.metadata[0].Get("corrected_timestamp"))
+	if err != nil {
+		t.Fatalf("corrected_timestamp: %v", err)
+	}
+	if drift := time.Since(corrected); drift < 0 || drift > 5*time.Second {
+		t.Errorf("corrected_timestamp is %v from now, want about now", drift)
+	}
+	if skew, _ := c.skew.Skew("10.0.0.1"); skew < time.Hour || skew > time.Hour+5*time.Second {
+		t.Errorf("skew = %v, want about 1h", skew)
+	}
+}
@@ -0,0 +1,576 @@
+package collector
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+const (
+	segmentExt     = ".seg"
+	cursorFile     = "cursor"
+	recordHeaderSz = 8 // uint32 length + uint32 crc32
+	maxRecordSize  = 16 << 20
+)
+
+// SpoolConfig holds spool configuration
+type SpoolConfig struct {
+	Dir string
+	// MaxBytes caps the total size of all segments. When an append would
+	// exceed it, the oldest segments are discarded (default 1GiB).
+	MaxBytes int64
+	// MaxAge discards segments older than this (default 72h)
+	MaxAge time.Duration
+	// SegmentSize is the size at which a new segment file is started (default 16MiB)
+	SegmentSize int64
+}
+
+// SpoolStats holds spool counters
+type SpoolStats struct {
+	Depth     int   `json:"depth"`
+	Bytes     int64 `json:"bytes"`
+	Segments  int   `json:"segments"`
+	Discarded int64 `json:"discarded"`
+}
+
+// spoolRecord is a message stored on disk
+type spoolRecord struct {
+	Topic    string            `json:"topic"`
+	UUID     string            `json:"uuid"`
+	Metadata map[string]string `json:"metadata"`
+	Payload  []byte            `json:"payload"`
+}
+
+// segment is a spool file on disk
+type segment struct {
+	seq     uint64
+	path    string
+	size    int64
+	records int
+	created time.Time
+}
+
+// Spool is a disk-backed write-ahead queue for messages the publisher could
+// not deliver. Messages are appended to segment files and replayed in order.
+//
+// Each record is stored as a little-endian uint32 length and CRC32 followed by
+// the JSON-encoded message. A cursor file tracks how far the oldest segment
+// has been replayed so restarts do not publish messages twice.
+type Spool struct {
+	cfg SpoolConfig
+
+	mu        sync.Mutex
+	segments  []*segment // oldest first, the last one is written to
+	writer    *os.File
+	offset    int64 // replay position in segments[0]
+	replayed  int   // records of segments[0] before offset
+	depth     int
+	bytes     int64
+	discarded int64
+	dirty     bool
+}
+
+// OpenSpool opens or creates a spool directory and recovers pending records
+func OpenSpool(cfg SpoolConfig) (*Spool, error) {
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = 1 << 30
+	}
+	if cfg.MaxAge <= 0 {
+		cfg.MaxAge = 72 * time.Hour
+	}
+	if cfg.SegmentSize <= 0 {
+		cfg.SegmentSize = 16 << 20
+	}
+
+	if err := os.MkdirAll(cfg.Dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+
+	s := &Spool{cfg: cfg}
+	if err := s.recover(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// recover loads existing segments and the replay cursor
+func (s *Spool) recover() error {
+	entries, err := os.ReadDir(s.cfg.Dir)
+	if err != nil {
+		return fmt.Errorf("failed to read spool directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return fmt.Errorf("failed to stat segment %s: %w", name, err)
+		}
+
+		s.segments = append(s.segments, &segment{
+			seq:     seq,
+			path:    filepath.Join(s.cfg.Dir, name),
+			created: info.ModTime(),
+		})
+	}
+
+	sort.Slice(s.segments, func(i, j int) bool {
+		return s.segments[i].seq < s.segments[j].seq
+	})
+
+	// Restore replay position in the oldest segment
+	if len(s.segments) > 0 {
+		if data, err := os.ReadFile(filepath.Join(s.cfg.Dir, cursorFile)); err == nil {
+			var seq uint64
+			var offset int64
+			if _, err := fmt.Sscanf(string(data), "%d %d", &seq, &offset); err == nil && seq == s.segments[0].seq {
+				s.offset = offset
+			}
+		}
+	}
+
+	// Count records, truncating torn writes at the end of a segment
+	for i, seg := range s.segments {
+		valid, records, before, err := scanSegment(seg.path, s.offsetFor(i))
+		if err != nil {
+			return err
+		}
+		if info, err := os.Stat(seg.path); err == nil && info.Size() > valid {
+			if err := os.Truncate(seg.path, valid); err != nil {
+				return fmt.Errorf("failed to truncate segment %s: %w", seg.path, err)
+			}
+		}
+
+		seg.size = valid
+		seg.records = records
+		s.bytes += valid
+		s.depth += records - before
+		if i == 0 {
+			s.replayed = before
+		}
+	}
+
+	return nil
+}
+
+// offsetFor returns the replay offset of segment i
+func (s *Spool) offsetFor(i int) int64 {
+	if i == 0 {
+		return s.offset
+	}
+	return 0
+}
+
+// scanSegment walks a segment and returns the length of its valid prefix,
+// the number of records in it and how many of them start before offset
+func scanSegment(path string, offset int64) (int64, int, int, error) {
+	f, err := os.Open(path) // #nosec G304 -- path is inside the spool directory
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("failed to open segment: %w", err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var pos int64
+	var records, before int
+
+	for {
+		_, n, err := readRecord(r)
+		if err != nil {
+			// EOF or a torn/corrupt tail ends the valid prefix
+			return pos, records, before, nil
+		}
+		if pos < offset {
+			before++
+		}
+		pos += n
+		records++
+	}
+}
+
+// readRecord reads one record and returns it with its size on disk
+func readRecord(r io.Reader) (*spoolRecord, int64, error) {
+	var header [recordHeaderSz]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, 0, err
+	}
+
+	length := binary.LittleEndian.Uint32(header[0:4])
+	checksum := binary.LittleEndian.Uint32(header[4:8])
+	if length > maxRecordSize {
+		return nil, 0, errors.New("spool record length out of range")
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, 0, err
+	}
+
+	if crc32.ChecksumIEEE(body) != checksum {
+		return nil, 0, errors.New("spool record checksum mismatch")
+	}
+
+	var record spoolRecord
+	if err := json.Unmarshal(body, &record); err != nil {
+		return nil, 0, fmt.Errorf("invalid spool record: %w", err)
+	}
+
+	return &record, int64(recordHeaderSz + len(body)), nil
+}
+
+// Append stores a message that could not be published
+func (s *Spool) Append(topic string, msg *message.Message) error {
+	body, err := json.Marshal(spoolRecord{
+		Topic:    topic,
+		UUID:     msg.UUID,
+		Metadata: msg.Metadata,
+		Payload:  msg.Payload,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode spool record: %w", err)
+	}
+
+	record := make([]byte, recordHeaderSz+len(body))
+	binary.LittleEndian.PutUint32(record[0:4], uint32(len(body))) // #nosec G115 -- datagram sized
+	binary.LittleEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(body))
+	copy(record[recordHeaderSz:], body)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	size := int64(len(record))
+	if size > s.cfg.MaxBytes {
+		return fmt.Errorf("spool record of %d bytes exceeds spool size cap", size)
+	}
+
+	// Make room by discarding the oldest segments
+	for s.bytes+size > s.cfg.MaxBytes && len(s.segments) > 0 {
+		if err := s.discardOldest(); err != nil {
+			return err
+		}
+	}
+
+	if err := s.ensureWriter(size); err != nil {
+		return err
+	}
+
+	if _, err := s.writer.Write(record); err != nil {
+		return fmt.Errorf("failed to write spool record: %w", err)
+	}
+
+	current := s.segments[len(s.segments)-1]
+	current.size += size
+	current.records++
+	s.bytes += size
+	s.depth++
+	s.dirty = true
+
+	return nil
+}
+
+// ensureWriter opens a segment that has room for size more bytes
+func (s *Spool) ensureWriter(size int64) error {
+	if s.writer != nil {
+		current := s.segments[len(s.segments)-1]
+		if current.size+size <= s.cfg.SegmentSize || current.size == 0 {
+			return nil
+		}
+		if err := s.closeWriter(); err != nil {
+			return err
+		}
+	}
+
+	var seq uint64 = 1
+	if n := len(s.segments); n > 0 {
+		seq = s.segments[n-1].seq + 1
+	}
+
+	path := filepath.Join(s.cfg.Dir, fmt.Sprintf("%020d%s", seq, segmentExt))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640) // #nosec G304 -- path is inside the spool directory
+	if err != nil {
+		return fmt.Errorf("failed to create segment: %w", err)
+	}
+
+	s.writer = f
+	s.segments = append(s.segments, &segment{seq: seq, path: path, created: time.Now()})
+	return nil
+}
+
+// closeWriter syncs and closes the segment being written
+func (s *Spool) closeWriter() error {
+	if s.writer == nil {
+		return nil
+	}
+
+	err := s.writer.Sync()
+	if closeErr := s.writer.Close(); err == nil {
+		err = closeErr
+	}
+	s.writer = nil
+	s.dirty = false
+
+	if err != nil {
+		return fmt.Errorf("failed to close segment: %w", err)
+	}
+	return nil
+}
+
+// discardOldest deletes the oldest segment and its pending records
+func (s *Spool) discardOldest() error {
+	oldest := s.segments[0]
+
+	if len(s.segments) == 1 {
+		if err := s.closeWriter(); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Remove(oldest.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove segment: %w", err)
+	}
+
+	pending := oldest.records - s.replayed
+	s.depth -= pending
+	s.discarded += int64(pending)
+	s.bytes -= oldest.size
+	s.segments = s.segments[1:]
+	s.offset = 0
+	s.replayed = 0
+
+	return s.saveCursor()
+}
+
+// Replay publishes pending records in order until publishing fails or the
+// spool is empty. It returns the number of records published.
+func (s *Spool) Replay(publisher message.Publisher) (int, error) {
+	published := 0
+
+	for {
+		s.mu.Lock()
+		if s.depth == 0 {
+			err := s.reset()
+			s.mu.Unlock()
+			return published, err
+		}
+
+		seg := s.segments[0]
+		if s.replayed >= seg.records {
+			// Oldest segment is fully replayed
+			err := s.finishOldest()
+			s.mu.Unlock()
+			if err != nil {
+				return published, err
+			}
+			continue
+		}
+
+		record, size, err := readRecordAt(seg.path, s.offset)
+		s.mu.Unlock()
+		if err != nil {
+			return published, err
+		}
+
+		msg := message.NewMessage(record.UUID, record.Payload)
+		for k, v := range record.Metadata {
+			msg.Metadata.Set(k, v)
+		}
+
+		if err := publisher.Publish(record.Topic, msg); err != nil {
+			return published, err
+		}
+		published++
+
+		s.mu.Lock()
+		// The segment may have been discarded while we were publishing
+		if len(s.segments) > 0 && s.segments[0] == seg {
+			s.offset += size
+			s.replayed++
+			s.depth--
+			err = s.saveCursor()
+		}
+		s.mu.Unlock()
+		if err != nil {
+			return published, err
+		}
+	}
+}
+
+// readRecordAt reads the record starting at offset in a segment file
+func readRecordAt(path string, offset int64) (*spoolRecord, int64, error) {
+	f, err := os.Open(path) // #nosec G304 -- path is inside the spool directory
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open segment: %w", err)
+	}
+	defer f.Close()
+
+	record, size, err := readRecord(io.NewSectionReader(f, offset, 1<<31))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read spool record: %w", err)
+	}
+
+	return record, size, nil
+}
+
+// finishOldest removes a fully replayed segment
+func (s *Spool) finishOldest() error {
+	oldest := s.segments[0]
+
+	if len(s.segments) == 1 {
+		if err := s.closeWriter(); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Remove(oldest.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove segment: %w", err)
+	}
+
+	s.bytes -= oldest.size
+	s.segments = s.segments[1:]
+	s.offset = 0
+	s.replayed = 0
+
+	return s.saveCursor()
+}
+
+// reset removes all segments once everything has been replayed
+func (s *Spool) reset() error {
+	for len(s.segments) > 0 {
+		if err := s.finishOldest(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveCursor persists the replay position
+func (s *Spool) saveCursor() error {
+	path := filepath.Join(s.cfg.Dir, cursorFile)
+
+	if len(s.segments) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove spool cursor: %w", err)
+		}
+		return nil
+	}
+
+	tmp := path + ".tmp"
+	data := fmt.Sprintf("%d %d", s.segments[0].seq, s.offset)
+	if err := os.WriteFile(tmp, []byte(data), 0o640); err != nil {
+		return fmt.Errorf("failed to write spool cursor: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write spool cursor: %w", err)
+	}
+
+	return nil
+}
+
+// EnforceRetention discards segments older than MaxAge and syncs pending writes
+func (s *Spool) EnforceRetention() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := time.Now().Add(-s.cfg.MaxAge)
+	for len(s.segments) > 0 && s.segments[0].created.Before(cutoff) {
+		if err := s.discardOldest(); err != nil {
+			return err
+		}
+	}
+
+	if s.dirty && s.writer != nil {
+		if err := s.writer.Sync(); err != nil {
+			return fmt.Errorf("failed to sync segment: %w", err)
+		}
+		s.dirty = false
+	}
+
+	return nil
+}
+
+// Depth returns the number of records waiting to be replayed
+func (s *Spool) Depth() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.depth
+}
+
+// Stats returns a snapshot of the spool counters
+func (s *Spool) Stats() SpoolStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return SpoolStats{
+		Depth:     s.depth,
+		Bytes:     s.bytes,
+		Segments:  len(s.segments),
+		Discarded: s.discarded,
+	}
+}
+
+// Close syncs and closes the spool
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closeWriter()
+}
+
+// replaySpool periodically enforces retention and replays spooled messages
+func (c *Collector) replaySpool(ctx context.Context) {
+	ticker := time.NewTicker(c.spoolInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := c.spool.EnforceRetention(); err != nil {
+			c.logger.Error("Failed to enforce spool retention", err, watermill.LogFields{})
+		}
+
+		if c.spool.Depth() == 0 {
+			continue
+		}
+
+		published, err := c.spool.Replay(c.publisher)
+		if published > 0 {
+			c.logger.Info("Replayed spooled messages", watermill.LogFields{
+				"published": published,
+				"remaining": c.spool.Depth(),
+			})
+		}
+		if err != nil {
+			c.logger.Error("Spool replay stopped", err, watermill.LogFields{
+				"remaining": c.spool.Depth(),
+			})
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// recordingPublisher records published payloads and can be told to fail
+type recordingPublisher struct {
+	failAfter int // fail once this many messages were published, -1 never
+	payloads  []string
+	topics    []string
+	metadata  []message.Metadata
+}
+
+func (p *recordingPublisher) Publish(topic string, messages ...*message.Message) error {
+	for _, msg := range messages {
+		if p.failAfter >= 0 && len(p.payloads) >= p.failAfter {
+			return errors.New("broker unavailable")
+		}
+		p.payloads = append(p.payloads, string(msg.Payload))
+		p.topics = append(p.topics, topic)
+		p.metadata = append(p.metadata, msg.Metadata)
+	}
+	return nil
+}
+
+func (p *recordingPublisher) Close() error {
+	return nil
+}
+
+func appendTestMessages(t *testing.T, s *Spool, from, to int) {
+	t.Helper()
+	for i := from; i < to; i++ {
+		msg := message.NewMessage(watermill.NewUUID(), []byte(fmt.Sprintf("event-%d", i)))
+		msg.Metadata.Set("event_type", "kill")
+		if err := s.Append("events.kill", msg); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+	}
+}
+
+// TestSpoolReplayInOrder tests that spooled messages survive a reopen and replay in order
+func TestSpoolReplayInOrder(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := OpenSpool(SpoolConfig{Dir: dir, SegmentSize: 256})
+	if err != nil {
+		t.Fatalf("OpenSpool() error = %v", err)
+	}
+	appendTestMessages(t, s, 0, 10)
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	s, err = OpenSpool(SpoolConfig{Dir: dir, SegmentSize: 256})
+	if err != nil {
+		t.Fatalf("OpenSpool() error = %v", err)
+	}
+	defer s.Close()
+
+	if depth := s.Depth(); depth != 10 {
+		t.Fatalf("Depth() = %d, want 10", depth)
+	}
+
+	pub := &recordingPublisher{failAfter: -1}
+	published, err := s.Replay(pub)
+	if err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	if published != 10 {
+		t.Errorf("Replay() published = %d, want 10", published)
+	}
+
+	for i, payload := range pub.payloads {
+		if want := fmt.Sprintf("event-%d", i); payload != want {
+			t.Errorf("payload %d = %q, want %q", i, payload, want)
+		}
+		if pub.topics[i] != "events.kill" {
+			t.Errorf("topic %d = %q, want events.kill", i, pub.topics[i])
+		}
+		if pub.metadata[i].Get("event_type") != "kill" {
+			t.Errorf("metadata %d event_type = %q, want kill", i, pub.metadata[i].Get("event_type"))
+		}
+	}
+
+	if stats := s.Stats(); stats.Depth != 0 || stats.Segments != 0 || stats.Bytes != 0 {
+		t.Errorf("Stats() = %+v, want empty spool", stats)
+	}
+}
+
+// TestSpoolPartialReplay tests that a failed replay resumes where it stopped after a restart
+func TestSpoolPartialReplay(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := OpenSpool(SpoolConfig{Dir: dir, SegmentSize: 256})
+	if err != nil {
+		t.Fatalf("OpenSpool() error = %v", err)
+	}
+	appendTestMessages(t, s, 0, 6)
+
+	pub := &recordingPublisher{failAfter: 4}
+	published, err := s.Replay(pub)
+	if err == nil {
+		t.Fatal("Replay() error = nil, want publish error")
+	}
+	if published != 4 {
+		t.Errorf("Replay() published = %d, want 4", published)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	s, err = OpenSpool(SpoolConfig{Dir: dir, SegmentSize: 256})
+	if err != nil {
+		t.Fatalf("OpenSpool() error = %v", err)
+	}
+	defer s.Close()
+
+	if depth := s.Depth(); depth != 2 {
+		t.Fatalf("Depth() after reopen = %d, want 2", depth)
+	}
+
+	pub = &recordingPublisher{failAfter: -1}
+	if _, err := s.Replay(pub); err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+
+	want := []string{"event-4", "event-5"}
+	if len(pub.payloads) != len(want) {
+		t.Fatalf("replayed %v, want %v", pub.payloads, want)
+	}
+	for i := range want {
+		if pub.payloads[i] != want[i] {
+			t.Errorf("payload %d = %q, want %q", i, pub.payloads[i], want[i])
+		}
+	}
+}
+
+// TestSpoolSizeCap tests that the oldest segments are discarded at the size cap
+func TestSpoolSizeCap(t *testing.T) {
+	s, err := OpenSpool(SpoolConfig{Dir: t.TempDir(), SegmentSize: 256, MaxBytes: 1024})
+	if err != nil {
+		t.Fatalf("OpenSpool() error = %v", err)
+	}
+	defer s.Close()
+
+	appendTestMessages(t, s, 0, 50)
+
+	stats := s.Stats()
+	if stats.Bytes > 1024 {
+		t.Errorf("Bytes = %d, want <= 1024", stats.Bytes)
+	}
+	if stats.Discarded == 0 {
+		t.Error("Discarded = 0, want > 0")
+	}
+	if int64(stats.Depth)+stats.Discarded != 50 {
+		t.Errorf("Depth + Discarded = %d, want 50", int64(stats.Depth)+stats.Discarded)
+	}
+
+	pub := &recordingPublisher{failAfter: -1}
+	if _, err := s.Replay(pub); err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	if last := pub.payloads[len(pub.payloads)-1]; last != "event-49" {
+		t.Errorf("last replayed = %q, want event-49", last)
+	}
+}
+
+// TestCollectorPublishSpoolsOnFailure tests that the collector spools while the
+// broker is down and keeps new messages behind spooled ones
+func TestCollectorPublishSpoolsOnFailure(t *testing.T) {
+	s, err := OpenSpool(SpoolConfig{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("OpenSpool() error = %v", err)
+	}
+	defer s.Close()
+
+	pub := &recordingPublisher{failAfter: 1}
+	c := New(Config{Publisher: pub, Logger: watermill.NopLogger{}, Spool: s})
+
+	for i := 0; i < 3; i++ {
+		msg := message.NewMessage(watermill.NewUUID(), []byte(fmt.Sprintf("event-%d", i)))
+		if err := c.publish("events.kill", msg); err != nil {
+			t.Fatalf("publish() error = %v", err)
+		}
+	}
+
+	if depth := s.Depth(); depth != 2 {
+		t.Fatalf("Depth() = %d, want 2", depth)
+	}
+
+	// Broker recovers, but new messages still queue behind the spool
+	pub.failAfter = -1
+	if err := c.publish("events.kill", message.NewMessage(watermill.NewUUID(), []byte("event-3"))); err != nil {
+		t.Fatalf("publish() error = %v", err)
+	}
+
+	if _, err := s.Replay(pub); err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+
+	want := []string{"event-0", "event-1", "event-2", "event-3"}
+	for i := range want {
+		if pub.payloads[i] != want[i] {
+			t.Errorf("payload %d = %q, want %q", i, pub.payloads[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+)
+
+// serveStatus exposes collector stats, server heartbeats, and batch ingest
+// when configured, over HTTP until the context is cancelled
+func (c *Collector) serveStatus(ctx context.Context) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", c.handleHealth)
+	mux.HandleFunc("/status", c.handleStatus)
+	mux.HandleFunc("/servers", c.handleServers)
+	if len(c.ingestTokens) > 0 {
+		mux.HandleFunc("/ingest", c.handleIngest)
+	}
+
+	server := &http.Server{
+		Addr:              c.statusAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	c.logger.Info("Status server started", watermill.LogFields{
+		"address": c.statusAddr,
+	})
+
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		c.logger.Error("Status server error", err, watermill.LogFields{})
+	}
+}
+
+// handleHealth returns the health status
+func (c *Collector) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":    "ok",
+		"timestamp": time.Now().Unix(),
+	})
+}
+
+// handleStatus returns the collector stats
+func (c *Collector) handleStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, c.Stats())
+}
+
+// handleServers returns the last packet time, event rate and clock skew of
+// every server
+func (c *Collector) handleServers(w http.ResponseWriter, r *http.Request) {
+	servers := c.heartbeats.Servers()
+	for i := range servers {
+		if skew, ok := c.skew.Skew(servers[i].ServerIP); ok {
+			servers[i].ClockSkew = skew.Seconds()
+		}
+	}
+	writeJSON(w, http.StatusOK, servers)
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,241 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+)
+
+// TCP errors
+var (
+	ErrTooManyConnections = errors.New("too many connections")
+	ErrLineTooLong        = errors.New("line too long")
+)
+
+// TCP stream protocol
+//
+// Clients send newline-delimited JSON events over a TCP (optionally TLS)
+// connection. Every line is answered in order with
+//
+//	OK <seq>\n
+//	ERR <seq> <reason>\n
+//
+// where seq counts event lines from 1. OK is only sent once the event was
+// published (or spooled), so a client that keeps unacknowledged events can
+// resend them after a reconnect. Lines are handled one at a time per
+// connection; a slow broker stops the collector from reading, and TCP flow
+// control pushes back on the sender.
+//
+// When authentication is enabled, the first line must be a signature header
+// over an empty body (see Sign), which is answered with "OK 0" or
+// "ERR 0 <reason>" followed by a disconnect.
+
+// listenTCP opens the TCP listener, wrapped in TLS when configured
+func (c *Collector) listenTCP() error {
+	listener, err := net.Listen("tcp", c.tcpAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on TCP: %w", err)
+	}
+
+	if c.tlsConfig != nil {
+		listener = tls.NewListener(listener, c.tlsConfig)
+	}
+	c.tcpListener = listener
+
+	c.logger.Info("TCP collector started", watermill.LogFields{
+		"address":         c.tcpAddr,
+		"tls":             c.tlsConfig != nil,
+		"max_connections": cap(c.tcpSlots),
+	})
+
+	return nil
+}
+
+// serveTCP accepts connections until the context is cancelled and waits for
+// open connections to finish
+func (c *Collector) serveTCP(ctx context.Context) {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	conns := make(map[net.Conn]struct{})
+
+	// Unblock Accept and any pending reads on shutdown
+	go func() {
+		<-ctx.Done()
+		_ = c.tcpListener.Close()
+
+		mu.Lock()
+		for conn := range conns {
+			_ = conn.SetReadDeadline(time.Now())
+		}
+		mu.Unlock()
+	}()
+
+	for {
+		conn, err := c.tcpListener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) || ctx.Err() != nil {
+				break
+			}
+			c.logger.Error("Failed to accept TCP connection", err, watermill.LogFields{})
+			continue
+		}
+
+		select {
+		case c.tcpSlots <- struct{}{}:
+		default:
+			c.logger.Error("Rejected TCP connection", ErrTooManyConnections, watermill.LogFields{
+				"source": conn.RemoteAddr().String(),
+			})
+			_ = conn.SetWriteDeadline(time.Now().Add(time.Second))
+			fmt.Fprintf(conn, "ERR 0 %s\n", ErrTooManyConnections)
+			_ = conn.Close()
+			continue
+		}
+
+		mu.Lock()
+		conns[conn] = struct{}{}
+		mu.Unlock()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-c.tcpSlots }()
+
+			c.handleConn(ctx, conn)
+
+			mu.Lock()
+			delete(conns, conn)
+			mu.Unlock()
+		}()
+	}
+
+	wg.Wait()
+}
+
+// handleConn reads events from one connection and acknowledges each line
+func (c *Collector) handleConn(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+
+	addr := conn.RemoteAddr()
+	c.counters.tcpConnections.Add(1)
+	defer c.counters.tcpConnections.Add(-1)
+
+	reader := bufio.NewReaderSize(conn, maxPacketSize)
+	writer := bufio.NewWriter(conn)
+
+	reply := func(format string, args ...interface{}) error {
+		if err := conn.SetWriteDeadline(time.Now().Add(c.tcpIdleTimeout)); err != nil {
+			return err
+		}
+		fmt.Fprintf(writer, format+"\n", args...)
+		return writer.Flush()
+	}
+
+	var server *ServerIdentity
+	if c.auth != nil {
+		line, err := c.readLine(ctx, conn, reader)
+		if err != nil {
+			return
+		}
+
+		// The handshake is a signature header over an empty body
+		server, _, err = c.auth.Verify(append(bytes.TrimRight(line, "\r\n"), '\n'))
+		if err != nil {
+			c.logger.Error("Rejected TCP connection", err, watermill.LogFields{
+				"source": addr.String(),
+			})
+			_ = reply("ERR 0 %s", err)
+			return
+		}
+		if err := reply("OK 0"); err != nil {
+			return
+		}
+	}
+
+	c.logger.Debug("TCP connection opened", watermill.LogFields{
+		"source": addr.String(),
+	})
+
+	for seq := 1; ctx.Err() == nil; seq++ {
+		line, err := c.readLine(ctx, conn, reader)
+		if errors.Is(err, ErrLineTooLong) {
+			_ = reply("ERR %d %s", seq, err)
+			return
+		}
+		if err != nil {
+			return
+		}
+
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			seq--
+			continue
+		}
+
+		c.counters.received.Add(1)
+		if c.limiter != nil && !c.allowSource(addr) {
+			if err := reply("ERR %d %s", seq, ErrRateLimited); err != nil {
+				return
+			}
+			continue
+		}
+		if err := c.handleEvent(line, addr, server); err != nil {
+			if !errors.Is(err, ErrRateLimited) {
+				c.logger.Error("Failed to handle event", err, watermill.LogFields{
+					"source": addr.String(),
+				})
+			}
+			if err := reply("ERR %d %s", seq, err); err != nil {
+				return
+			}
+			continue
+		}
+		c.counters.processed.Add(1)
+
+		if err := reply("OK %d", seq); err != nil {
+			return
+		}
+	}
+}
+
+// readLine reads one line of at most Reassembly.MaxSize bytes
+func (c *Collector) readLine(ctx context.Context, conn net.Conn, reader *bufio.Reader) ([]byte, error) {
+	if err := conn.SetReadDeadline(time.Now().Add(c.tcpIdleTimeout)); err != nil {
+		return nil, err
+	}
+
+	// Shutdown sets the deadline after cancelling, so checking here cannot
+	// miss it
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return readLimitedLine(reader, c.chunks.cfg.MaxSize)
+}
+
+// readLimitedLine reads one line, failing with ErrLineTooLong once it grows
+// past limit bytes
+func readLimitedLine(reader *bufio.Reader, limit int) ([]byte, error) {
+	var line []byte
+	for {
+		fragment, err := reader.ReadSlice('\n')
+		line = append(line, fragment...)
+		if len(line) > limit {
+			return nil, ErrLineTooLong
+		}
+		if err == nil {
+			return line, nil
+		}
+		if !errors.Is(err, bufio.ErrBufferFull) {
+			return line, err
+		}
+	}
+}
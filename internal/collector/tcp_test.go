@@ -0,0 +1,251 @@
+package collector
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+)
+
+// startTCPCollector starts a collector with only a loopback TCP listener and
+// returns its address and a function that stops it
+func startTCPCollector(t *testing.T, cfg Config) (string, func()) {
+	t.Helper()
+
+	cfg.Logger = watermill.NopLogger{}
+	c := New(cfg)
+	c.addr = "127.0.0.1:0"
+	c.tcpAddr = "127.0.0.1:0"
+
+	if err := c.listen(); err != nil {
+		t.Fatalf("listen() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- c.serve(ctx) }()
+
+	return c.tcpListener.Addr().String(), func() {
+		cancel()
+		<-done
+	}
+}
+
+// sendLines writes lines to a connection and returns one reply per line
+func sendLines(t *testing.T, conn net.Conn, lines ...string) []string {
+	t.Helper()
+
+	reader := bufio.NewReader(conn)
+	var replies []string
+	for _, line := range lines {
+		if _, err := fmt.Fprintf(conn, "%s\n", line); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		reply, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("ReadString() error = %v", err)
+		}
+		replies = append(replies, strings.TrimSpace(reply))
+	}
+	return replies
+}
+
+// TestTCPAcknowledgements tests per-line acknowledgements on a plain connection
+func TestTCPAcknowledgements(t *testing.T) {
+	pub := &recordingPublisher{failAfter: -1}
+	addr, stop := startTCPCollector(t, Config{Publisher: pub})
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+
+	replies := sendLines(t, conn, string(benchmarkPayload), `{"no_type":true}`, `not json`, string(benchmarkPayload))
+	stop()
+
+	want := []string{"OK 1", "ERR 2 missing event_type", "ERR 3 invalid JSON", "OK 4"}
+	for i := range want {
+		if !strings.HasPrefix(replies[i], want[i]) {
+			t.Errorf("reply %d = %q, want %q", i, replies[i], want[i])
+		}
+	}
+
+	// Invalid lines go to the dead-letter topic
+	wantTopics := []string{"events.kill", InvalidTopic, InvalidTopic, "events.kill"}
+	if len(pub.topics) != len(wantTopics) {
+		t.Fatalf("published to %v, want %v", pub.topics, wantTopics)
+	}
+	for i := range wantTopics {
+		if pub.topics[i] != wantTopics[i] {
+			t.Errorf("topic %d = %q, want %q", i, pub.topics[i], wantTopics[i])
+		}
+	}
+	if got := pub.metadata[0].Get("source_ip"); got != "127.0.0.1" {
+		t.Errorf("source_ip = %q, want 127.0.0.1", got)
+	}
+}
+
+// TestTCPPublishFailure tests that events are not acknowledged when publishing fails
+func TestTCPPublishFailure(t *testing.T) {
+	pub := &recordingPublisher{failAfter: 0}
+	addr, stop := startTCPCollector(t, Config{Publisher: pub})
+	defer stop()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+
+	if reply := sendLines(t, conn, string(benchmarkPayload))[0]; !strings.HasPrefix(reply, "ERR 1 ") {
+		t.Errorf("reply = %q, want ERR 1", reply)
+	}
+}
+
+// TestTCPAuthentication tests the signed handshake on authenticated connections
+func TestTCPAuthentication(t *testing.T) {
+	registry, err := NewRegistry([]ServerIdentity{{ID: "eu-1", Secret: "s3cret"}})
+	if err != nil {
+		t.Fatalf("NewRegistry() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		handshake string
+		wantReply string
+	}{
+		{
+			name:      "Valid handshake",
+			handshake: strings.TrimSuffix(string(Sign("eu-1", "s3cret", time.Now(), "n1", nil)), "\n"),
+			wantReply: "OK 0",
+		},
+		{
+			name:      "Wrong secret",
+			handshake: strings.TrimSuffix(string(Sign("eu-1", "wrong", time.Now(), "n2", nil)), "\n"),
+			wantReply: "ERR 0 signature mismatch",
+		},
+		{
+			name:      "No handshake",
+			handshake: string(benchmarkPayload),
+			wantReply: "ERR 0 packet is not signed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pub := &recordingPublisher{failAfter: -1}
+			addr, stop := startTCPCollector(t, Config{Publisher: pub, Registry: registry})
+
+			conn, err := net.Dial("tcp", addr)
+			if err != nil {
+				t.Fatalf("Dial() error = %v", err)
+			}
+			defer conn.Close()
+
+			reply := sendLines(t, conn, tt.handshake)[0]
+			if reply != tt.wantReply {
+				t.Fatalf("handshake reply = %q, want %q", reply, tt.wantReply)
+			}
+			if !strings.HasPrefix(reply, "OK") {
+				stop()
+				return
+			}
+
+			if reply := sendLines(t, conn, string(benchmarkPayload))[0]; reply != "OK 1" {
+				t.Errorf("event reply = %q, want OK 1", reply)
+			}
+			stop()
+
+			if len(pub.metadata) != 1 || pub.metadata[0].Get("server_id") != "eu-1" {
+				t.Errorf("published metadata = %v, want server_id eu-1", pub.metadata)
+			}
+		})
+	}
+}
+
+// TestTCPTLS tests that events can be sent over TLS
+func TestTCPTLS(t *testing.T) {
+	// Borrow a self-signed certificate from httptest
+	srv := httptest.NewUnstartedServer(nil)
+	srv.StartTLS()
+	serverTLS := srv.TLS.Clone()
+	srv.Close()
+
+	pub := &recordingPublisher{failAfter: -1}
+	addr, stop := startTCPCollector(t, Config{Publisher: pub, TLSConfig: serverTLS})
+	defer stop()
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true}) // #nosec G402 -- test certificate
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+
+	if reply := sendLines(t, conn, string(benchmarkPayload))[0]; reply != "OK 1" {
+		t.Errorf("reply = %q, want OK 1", reply)
+	}
+}
+
+// TestTCPConnectionLimit tests that connections above the limit are refused
+func TestTCPConnectionLimit(t *testing.T) {
+	addr, stop := startTCPCollector(t, Config{Publisher: &countingPublisher{}, MaxConnections: 1})
+	defer stop()
+
+	first, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer first.Close()
+
+	// Make sure the first connection holds its slot
+	sendLines(t, first, string(benchmarkPayload))
+
+	second, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer second.Close()
+
+	_ = second.SetReadDeadline(time.Now().Add(5 * time.Second))
+	reply, _ := bufio.NewReader(second).ReadString('\n')
+	if want := "ERR 0 " + ErrTooManyConnections.Error(); strings.TrimSpace(reply) != want {
+		t.Errorf("reply = %q, want %q", reply, want)
+	}
+}
+
+// TestTCPRateLimit tests that the per-source limit applies to TCP event lines
+func TestTCPRateLimit(t *testing.T) {
+	pub := &recordingPublisher{failAfter: -1}
+	addr, stop := startTCPCollector(t, Config{
+		Publisher: pub,
+		RateLimit: &RateLimitConfig{Source: Limit{Rate: 0.001, Burst: 2}},
+	})
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+
+	replies := sendLines(t, conn, string(benchmarkPayload), string(benchmarkPayload), string(benchmarkPayload))
+	stop()
+
+	want := []string{"OK 1", "OK 2", "ERR 3 rate limited"}
+	for i := range want {
+		if replies[i] != want[i] {
+			t.Errorf("reply %d = %q, want %q", i, replies[i], want[i])
+		}
+	}
+	if len(pub.payloads) != 2 {
+		t.Errorf("published %d events, want 2", len(pub.payloads))
+	}
+}
@@ -0,0 +1,266 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/UDL-TF/UnitedStats/pkg/events"
+)
+
+// Decoding
+//
+// Decode reads a payload in a single pass. The envelope's event_type and
+// schema_version are found by scanning the top-level keys of the raw bytes,
+// without decoding them, and the payload is then unmarshalled straight into
+// its typed event, which embeds the envelope (BaseEvent). Only payloads the
+// scanner cannot read cheaply (escaped keys, unusual values, bad syntax) and
+// payloads of older schema versions are decoded more than once.
+
+// Decode decodes a JSON event payload. The returned event's Base holds the
+// envelope fields, decoded in the same pass as the typed event, and its
+// players' SteamIDs are normalized to SteamID64s. Blank payloads and unknown
+// event types yield no event and no error.
+func Decode(data []byte) (*events.Event, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	env, ok := scanEnvelope(data)
+	if !ok {
+		// Let encoding/json read the envelope and report what is wrong
+		var decoded struct {
+			EventType     events.EventType `json:"event_type"`
+			SchemaVersion int              `json:"schema_version"`
+		}
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			return nil, &ParseError{Line: string(data), Reason: fmt.Sprintf("invalid JSON: %v", err)}
+		}
+		env = envelope{eventType: decoded.EventType, schemaVersion: decoded.SchemaVersion}
+	}
+
+	// Look up the parser function for this event type
+	parser, ok := eventParsers[env.eventType]
+	if !ok {
+		// Unknown event type - skip but don't error
+		return nil, nil
+	}
+
+	// Older payloads are migrated to the current structs
+	version := env.schemaVersion
+	if version == 0 {
+		version = 1
+	}
+	if version != CurrentSchemaVersion {
+		var err error
+		if data, err = upcast(data, version); err != nil {
+			return nil, err
+		}
+	}
+
+	event, err := parser(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if base := event.Base(); base != nil {
+		base.SchemaVersion = version
+	}
+	normalizeSteamIDs(event)
+
+	return event, nil
+}
+
+// envelope holds the top-level fields Decode needs before the typed decode
+type envelope struct {
+	eventType     events.EventType
+	schemaVersion int
+}
+
+// scanEnvelope reads event_type and schema_version from the top level of a
+// JSON object without decoding the rest of it. A later key wins, as with
+// encoding/json. It reports false for anything it cannot read cheaply.
+func scanEnvelope(data []byte) (envelope, bool) {
+	var env envelope
+	s := jsonScanner{data: data}
+
+	s.skipSpace()
+	if !s.consume('{') {
+		return env, false
+	}
+
+	s.skipSpace()
+	if !s.consume('}') {
+		for {
+			s.skipSpace()
+			key, ok := s.plainString()
+			if !ok {
+				return env, false
+			}
+
+			s.skipSpace()
+			if !s.consume(':') {
+				return env, false
+			}
+			s.skipSpace()
+
+			switch key {
+			case "event_type":
+				value, ok := s.plainString()
+				if !ok {
+					return env, false
+				}
+				env.eventType = events.EventType(value)
+
+			case "schema_version":
+				start := s.pos
+				if !s.skipLiteral() {
+					return env, false
+				}
+				version, err := strconv.Atoi(string(data[start:s.pos]))
+				if err != nil {
+					return env, false
+				}
+				env.schemaVersion = version
+
+			default:
+				if !s.skipValue() {
+					return env, false
+				}
+			}
+
+			s.skipSpace()
+			if s.consume(',') {
+				continue
+			}
+			if s.consume('}') {
+				break
+			}
+			return env, false
+		}
+	}
+
+	s.skipSpace()
+	return env, s.pos == len(data)
+}
+
+// jsonScanner walks the structure of JSON text without decoding values
+type jsonScanner struct {
+	data []byte
+	pos  int
+}
+
+// skipSpace skips insignificant whitespace
+func (s *jsonScanner) skipSpace() {
+	for s.pos < len(s.data) {
+		switch s.data[s.pos] {
+		case ' ', '\t', '\r', '\n':
+			s.pos++
+		default:
+			return
+		}
+	}
+}
+
+// consume skips c if it is the next byte
+func (s *jsonScanner) consume(c byte) bool {
+	if s.pos < len(s.data) && s.data[s.pos] == c {
+		s.pos++
+		return true
+	}
+	return false
+}
+
+// plainString reads a string without escape sequences
+func (s *jsonScanner) plainString() (string, bool) {
+	if !s.consume('"') {
+		return "", false
+	}
+
+	end := bytes.IndexByte(s.data[s.pos:], '"')
+	if end < 0 {
+		return "", false
+	}
+
+	value := s.data[s.pos : s.pos+end]
+	if bytes.IndexByte(value, '\\') >= 0 {
+		return "", false
+	}
+
+	s.pos += end + 1
+	return string(value), true
+}
+
+// skipString skips a string, escape sequences included
+func (s *jsonScanner) skipString() bool {
+	if !s.consume('"') {
+		return false
+	}
+
+	for s.pos < len(s.data) {
+		switch s.data[s.pos] {
+		case '\\':
+			s.pos += 2
+		case '"':
+			s.pos++
+			return true
+		default:
+			s.pos++
+		}
+	}
+	return false
+}
+
+// skipLiteral skips a number, true, false or null
+func (s *jsonScanner) skipLiteral() bool {
+	start := s.pos
+	for s.pos < len(s.data) {
+		switch s.data[s.pos] {
+		case ',', '}', ']', ' ', '\t', '\r', '\n':
+			return s.pos > start
+		case '"', '{', '[', ':':
+			return false
+		default:
+			s.pos++
+		}
+	}
+	return s.pos > start
+}
+
+// skipValue skips any value, nested objects and arrays included
+func (s *jsonScanner) skipValue() bool {
+	if s.pos >= len(s.data) {
+		return false
+	}
+
+	switch s.data[s.pos] {
+	case '"':
+		return s.skipString()
+	case '{', '[':
+	default:
+		return s.skipLiteral()
+	}
+
+	depth := 0
+	for s.pos < len(s.data) {
+		switch s.data[s.pos] {
+		case '"':
+			if !s.skipString() {
+				return false
+			}
+			continue
+		case '{', '[':
+			depth++
+		case '}', ']':
+			depth--
+			if depth == 0 {
+				s.pos++
+				return true
+			}
+		}
+		s.pos++
+	}
+	return false
+}
@@ -0,0 +1,226 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/UDL-TF/UnitedStats/pkg/events"
+)
+
+// TestScanEnvelope tests that the envelope scanner agrees with encoding/json
+// whenever it reads a payload
+func TestScanEnvelope(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		wantOK bool
+	}{
+		{name: "Event type first", data: `{"event_type":"kill","killer":{"name":"a"}}`, wantOK: true},
+		{name: "Event type last", data: `{"killer":{"name":"a}{\"b"},"weapon":{"name":"x"},"crit":true,"event_type":"kill"}`, wantOK: true},
+		{name: "Nested event type", data: `{"killer":{"event_type":"airshot"},"event_type":"kill"}`, wantOK: true},
+		{name: "Later key wins", data: `{"event_type":"kill","event_type":"deflect"}`, wantOK: true},
+		{name: "Schema version", data: `{"schema_version":1,"event_type":"kill"}`, wantOK: true},
+		{name: "Arrays and literals", data: `{"a":[1,[2,{"b":null}],"]"],"c":-1.5e3,"d":false,"event_type":"kill"}`, wantOK: true},
+		{name: "Whitespace", data: " {\n\t\"event_type\" : \"kill\" ,\r\n\"crit\" : true }\n", wantOK: true},
+		{name: "Empty object", data: `{}`, wantOK: true},
+		{name: "Escaped key", data: `{"event\u005ftype":"kill"}`, wantOK: false},
+		{name: "Escaped event type", data: `{"event_type":"ki\u006cl"}`, wantOK: false},
+		{name: "Event type not a string", data: `{"event_type":7}`, wantOK: false},
+		{name: "Schema version not an integer", data: `{"schema_version":"2","event_type":"kill"}`, wantOK: false},
+		{name: "Unterminated", data: `{"event_type":"kill"`, wantOK: false},
+		{name: "Trailing data", data: `{"event_type":"kill"}{}`, wantOK: false},
+		{name: "Not an object", data: `["event_type","kill"]`, wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env, ok := scanEnvelope([]byte(tt.data))
+			if ok != tt.wantOK {
+				t.Fatalf("scanEnvelope() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+
+			var want struct {
+				EventType     events.EventType `json:"event_type"`
+				SchemaVersion int              `json:"schema_version"`
+			}
+			if err := json.Unmarshal([]byte(tt.data), &want); err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+			if env.eventType != want.EventType || env.schemaVersion != want.SchemaVersion {
+				t.Errorf("scanEnvelope() = %+v, want %+v", env, want)
+			}
+		})
+	}
+}
+
+// TestDecode tests decoding payloads the scanner cannot read
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		wantType events.EventType
+		wantErr  bool
+	}{
+		{name: "Blank", data: " \n"},
+		{name: "Unknown event type", data: `{"event_type":"unknown"}`},
+		{name: "Escaped event type", data: `{"event_type":"match\u005fstart","timestamp":"2024-02-01T12:00:00Z","map":"cp_badlands","schema_version":2}`, wantType: events.EventTypeMatchStart},
+		{name: "Invalid JSON", data: `{"event_type":"kill"`, wantErr: true},
+		{name: "Event type not a string", data: `{"event_type":7}`, wantErr: true},
+		{name: "Invalid body", data: `{"event_type":"kill","schema_version":2,"crit":"yes"}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := Decode([]byte(tt.data))
+			if tt.wantErr {
+				var parseErr *ParseError
+				if !errors.As(err, &parseErr) {
+					t.Fatalf("Decode() error = %v, want ParseError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+
+			if tt.wantType == "" {
+				if event != nil {
+					t.Errorf("Decode() = %+v, want nil", event)
+				}
+				return
+			}
+			if event == nil || event.Type != tt.wantType || event.Base() == nil {
+				t.Fatalf("Decode() = %+v, want a %s event", event, tt.wantType)
+			}
+		})
+	}
+}
+
+// TestDecodeSteamIDs tests that players' SteamIDs are normalized to SteamID64s
+func TestDecodeSteamIDs(t *testing.T) {
+	tests := []struct {
+		name    string
+		steamID string
+		want    string
+	}{
+		{name: "SteamID64", steamID: "76561197960265975", want: "76561197960265975"},
+		{name: "SteamID3", steamID: "[U:1:247]", want: "76561197960265975"},
+		{name: "SteamID2", steamID: "STEAM_0:1:123", want: "76561197960265975"},
+		{name: "Invalid", steamID: "BOT", want: "BOT"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			line := fmt.Sprintf(`{"timestamp":"2024-02-01T12:00:00Z","event_type":"kill","schema_version":2,"killer":{"steam_id":%q,"team":2},"victim":{"steam_id":%q,"team":3},"assister":{"steam_id":%q,"team":2}}`,
+				tt.steamID, tt.steamID, tt.steamID)
+			event, err := Decode([]byte(line))
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+
+			kill := event.Kill
+			for _, got := range []string{kill.Killer.SteamID, kill.Victim.SteamID, kill.Assister.SteamID} {
+				if got != tt.want {
+					t.Errorf("SteamID = %q, want %q", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+// loadFixtureEvents reads the fixture payloads, grouped by event type
+func loadFixtureEvents(b *testing.B) map[events.EventType][][]byte {
+	file, err := os.Open("../../test/fixtures/sample_logs_json.txt")
+	if err != nil {
+		b.Skipf("Skipping fixture benchmark: %v", err)
+	}
+	defer file.Close()
+
+	reader, err := NewReader(file, ReaderConfig{})
+	if err != nil {
+		b.Fatalf("NewReader() error = %v", err)
+	}
+	defer reader.Close()
+
+	byType := make(map[events.EventType][][]byte)
+	for {
+		record, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			b.Fatalf("Error reading fixture file: %v", err)
+		}
+		byType[record.Event.Type] = append(byType[record.Event.Type], record.Raw)
+	}
+
+	return byType
+}
+
+// BenchmarkDecodeFixtures benchmarks decoding the fixtures, one event per
+// op, so allocs/op is the allocations per event. The fixtures have no schema
+// version; "upcast" decodes them as they are, the other benchmarks as
+// payloads of the current version.
+func BenchmarkDecodeFixtures(b *testing.B) {
+	byType := loadFixtureEvents(b)
+
+	var all, upcast [][]byte
+	types := make([]string, 0, len(byType))
+	for eventType, lines := range byType {
+		types = append(types, string(eventType))
+		upcast = append(upcast, lines...)
+
+		for i, line := range lines {
+			lines[i] = append([]byte(fmt.Sprintf(`{"schema_version":%d,`, CurrentSchemaVersion)), line[1:]...)
+		}
+		all = append(all, lines...)
+	}
+	sort.Strings(types)
+
+	run := func(lines [][]byte) func(*testing.B) {
+		return func(b *testing.B) {
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := Decode(lines[i%len(lines)]); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	}
+
+	b.Run("all", run(all))
+	b.Run("upcast", run(upcast))
+	for _, eventType := range types {
+		b.Run(eventType, run(byType[events.EventType(eventType)]))
+	}
+}
+
+// BenchmarkEventKeyFixtures benchmarks deriving deduplication keys for the
+// fixtures, which have no event IDs and are hashed
+func BenchmarkEventKeyFixtures(b *testing.B) {
+	var lines [][]byte
+	var decoded []*events.Event
+	for _, group := range loadFixtureEvents(b) {
+		for _, line := range group {
+			event, _ := Decode(line)
+			lines = append(lines, line)
+			decoded = append(decoded, event)
+		}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		n := i % len(lines)
+		_ = EventKey(decoded[n], lines[n])
+	}
+}
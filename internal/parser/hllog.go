@@ -0,0 +1,534 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/UDL-TF/UnitedStats/pkg/events"
+	"github.com/UDL-TF/UnitedStats/pkg/steamid"
+)
+
+// logTimeLayout is the timestamp format of native Source engine log lines
+const logTimeLayout = "01/02/2006 - 15:04:05"
+
+var (
+	// L 02/01/2024 - 12:00:00: <message>
+	logLineRegex = regexp.MustCompile(`^L (\d{2}/\d{2}/\d{4} - \d{2}:\d{2}:\d{2}): (.*)$`)
+
+	// "Name<uid><steamid><Team>"
+	logPlayerPattern = `"(.*?<\d+><[^>]*><[^>]*>)"`
+	logPlayerRegex   = regexp.MustCompile(`^(.*)<(\d+)><([^>]*)><([^>]*)>$`)
+
+	// (key "value")
+	logPropertyRegex = regexp.MustCompile(`\(([\w]+) "([^"]*)"\)`)
+
+	logKillRegex       = regexp.MustCompile(`^` + logPlayerPattern + ` killed ` + logPlayerPattern + ` with "([^"]*)"(.*)$`)
+	logTriggerRegex    = regexp.MustCompile(`^` + logPlayerPattern + ` triggered "([^"]+)"(?: against ` + logPlayerPattern + `)?(.*)$`)
+	logWorldRegex      = regexp.MustCompile(`^World triggered "([^"]+)"(.*)$`)
+	logRoleRegex       = regexp.MustCompile(`^` + logPlayerPattern + ` changed role to "([^"]+)"`)
+	logSpawnRegex      = regexp.MustCompile(`^` + logPlayerPattern + ` spawned as "([^"]+)"`)
+	logDisconnectRegex = regexp.MustCompile(`^` + logPlayerPattern + ` disconnected(.*)$`)
+	logMapRegex        = regexp.MustCompile(`^(Loading|Started) map "([^"]+)"`)
+	logTeamScoreRegex  = regexp.MustCompile(`^Team "([^"]+)" (?:current|final) score "(\d+)"`)
+)
+
+// LogParser turns native Source engine log lines (as streamed by
+// logaddress_add) into events.
+//
+// Log lines carry less context than plugin events, so the parser tracks the
+// current map, round timing, team scores and player classes of one server.
+// Use one LogParser per server.
+type LogParser struct {
+	serverIP string
+	gamemode string
+
+	mu         sync.Mutex
+	mapName    string
+	matchStart time.Time
+	roundStart time.Time
+	scores     map[int]int
+	classes    map[string]string // steam_id -> class
+}
+
+// NewLogParser creates a log parser for one server
+func NewLogParser(serverIP, gamemode string) *LogParser {
+	return &LogParser{
+		serverIP: serverIP,
+		gamemode: gamemode,
+		scores:   make(map[int]int),
+		classes:  make(map[string]string),
+	}
+}
+
+// ParseLogLine parses a single log line. Most lines yield at most one event,
+// but some (like medic deaths) produce several. Lines that carry no stats
+// return no events and no error.
+func (p *LogParser) ParseLogLine(line string) ([]*events.Event, error) {
+	line = strings.TrimRight(line, "\x00\r\n ")
+	if line == "" {
+		return nil, nil
+	}
+
+	m := logLineRegex.FindStringSubmatch(line)
+	if m == nil {
+		return nil, &ParseError{Line: line, Reason: "not a log line"}
+	}
+
+	timestamp, err := time.Parse(logTimeLayout, m[1])
+	if err != nil {
+		return nil, &ParseError{Line: line, Reason: fmt.Sprintf("invalid timestamp: %v", err)}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	base := func(eventType events.EventType) events.BaseEvent {
+		return events.BaseEvent{
+			Timestamp: timestamp,
+			Gamemode:  p.gamemode,
+			ServerIP:  p.serverIP,
+			EventType: eventType,
+
+			SchemaVersion: CurrentSchemaVersion,
+		}
+	}
+
+	msg := m[2]
+
+	if m := logKillRegex.FindStringSubmatch(msg); m != nil {
+		return p.parseKill(base(events.EventTypeKill), m[1], m[2], m[3], parseLogProperties(m[4])), nil
+	}
+
+	if m := logTriggerRegex.FindStringSubmatch(msg); m != nil {
+		return p.parseTrigger(base, m[1], m[2], m[3], parseLogProperties(m[4])), nil
+	}
+
+	if m := logWorldRegex.FindStringSubmatch(msg); m != nil {
+		return p.parseWorldTrigger(timestamp, base, m[1], parseLogProperties(m[2])), nil
+	}
+
+	if m := logRoleRegex.FindStringSubmatch(msg); m != nil {
+		player, ok := parseLogPlayer(m[1])
+		if !ok {
+			return nil, nil
+		}
+
+		oldClass := p.classes[player.SteamID]
+		p.classes[player.SteamID] = m[2]
+		if oldClass == m[2] {
+			return nil, nil
+		}
+
+		return []*events.Event{{
+			Type: events.EventTypeClassChange,
+			ClassChange: &events.ClassChangeEvent{
+				BaseEvent: base(events.EventTypeClassChange),
+				Player:    player,
+				OldClass:  oldClass,
+				NewClass:  m[2],
+			},
+		}}, nil
+	}
+
+	if m := logSpawnRegex.FindStringSubmatch(msg); m != nil {
+		player, ok := parseLogPlayer(m[1])
+		if !ok {
+			return nil, nil
+		}
+		player.Class = strings.ToLower(m[2])
+
+		return []*events.Event{{
+			Type: events.EventTypePlayerSpawn,
+			PlayerSpawn: &events.PlayerSpawnEvent{
+				BaseEvent: base(events.EventTypePlayerSpawn),
+				Player:    player,
+			},
+		}}, nil
+	}
+
+	if m := logDisconnectRegex.FindStringSubmatch(msg); m != nil {
+		player, ok := parseLogPlayer(m[1])
+		if !ok {
+			return nil, nil
+		}
+		delete(p.classes, player.SteamID)
+
+		return []*events.Event{{
+			Type: events.EventTypePlayerDisconnect,
+			PlayerDisconnect: &events.PlayerDisconnectEvent{
+				BaseEvent: base(events.EventTypePlayerDisconnect),
+				Player:    player,
+				Reason:    parseLogProperties(m[2])["reason"],
+			},
+		}}, nil
+	}
+
+	if m := logMapRegex.FindStringSubmatch(msg); m != nil {
+		p.mapName = m[2]
+		if m[1] != "Started" {
+			return nil, nil
+		}
+
+		// A new map starts a new match
+		p.matchStart = timestamp
+		p.roundStart = time.Time{}
+		p.scores = make(map[int]int)
+
+		return []*events.Event{{
+			Type: events.EventTypeMatchStart,
+			MatchStart: &events.MatchStartEvent{
+				BaseEvent: base(events.EventTypeMatchStart),
+				Map:       p.mapName,
+			},
+		}}, nil
+	}
+
+	if m := logTeamScoreRegex.FindStringSubmatch(msg); m != nil {
+		if score, err := strconv.Atoi(m[2]); err == nil {
+			p.scores[logTeam(m[1])] = score
+		}
+		return nil, nil
+	}
+
+	// Not a stats line (chat, cvars, connections, ...)
+	return nil, nil
+}
+
+// parseKill parses a "killed ... with" line
+func (p *LogParser) parseKill(base events.BaseEvent, killerStr, victimStr, weapon string, props map[string]string) []*events.Event {
+	killer, ok := parseLogPlayer(killerStr)
+	if !ok {
+		return nil
+	}
+	victim, ok := parseLogPlayer(victimStr)
+	if !ok {
+		return nil
+	}
+
+	kill := &events.KillEvent{
+		BaseEvent: base,
+		Killer:    killer,
+		Victim:    victim,
+		Weapon:    events.Weapon{Name: weapon},
+		Crit:      props["crit"] == "crit",
+		Headshot:  props["customkill"] == "headshot",
+		Backstab:  props["customkill"] == "backstab",
+		KillerPos: parseLogPosition(props["attacker_position"]),
+		VictimPos: parseLogPosition(props["victim_position"]),
+	}
+
+	return []*events.Event{{Type: events.EventTypeKill, Kill: kill}}
+}
+
+// parseTrigger parses a player "triggered" line
+func (p *LogParser) parseTrigger(base func(events.EventType) events.BaseEvent, playerStr, action, targetStr string, props map[string]string) []*events.Event {
+	player, ok := parseLogPlayer(playerStr)
+	if !ok {
+		return nil
+	}
+
+	var target events.Player
+	hasTarget := false
+	if targetStr != "" {
+		target, hasTarget = parseLogPlayer(targetStr)
+	}
+
+	switch action {
+	case "kill assist":
+		if !hasTarget {
+			return nil
+		}
+
+		return []*events.Event{{
+			Type: events.EventTypeAssist,
+			Assist: &events.AssistEvent{
+				BaseEvent:   base(events.EventTypeAssist),
+				Assister:    player,
+				Victim:      target,
+				AssisterPos: parseLogPosition(props["assister_position"]),
+			},
+		}}
+
+	case "domination", "revenge":
+		if !hasTarget {
+			return nil
+		}
+
+		eventType := events.EventType(action)
+		return []*events.Event{{
+			Type: eventType,
+			Domination: &events.DominationEvent{
+				BaseEvent: base(eventType),
+				Player:    player,
+				Victim:    target,
+				Assist:    props["assist"] == "1",
+			},
+		}}
+
+	case "object_detonated":
+		return []*events.Event{{
+			Type: events.EventTypeObjectDestroyed,
+			Building: &events.BuildingEvent{
+				BaseEvent: base(events.EventTypeObjectDestroyed),
+				Player:    player,
+				Object:    events.ObjectInfo{Type: logObjectType(props["object"])},
+				Position:  parseLogPosition(props["attacker_position"]),
+			},
+		}}
+
+	case "chargedeployed":
+		return []*events.Event{{
+			Type: events.EventTypeUberDeployed,
+			Medic: &events.MedicEvent{
+				BaseEvent:  base(events.EventTypeUberDeployed),
+				Medic:      player,
+				ActionType: string(events.EventTypeUberDeployed),
+				UberCharge: 1,
+			},
+		}}
+
+	case "medic_death":
+		if !hasTarget {
+			return nil
+		}
+
+		var result []*events.Event
+		if healing, err := strconv.Atoi(props["healing"]); err == nil && healing > 0 {
+			result = append(result, &events.Event{
+				Type: events.EventTypeHealed,
+				Healed: &events.HealedEvent{
+					BaseEvent:  base(events.EventTypeHealed),
+					Medic:      target,
+					HealPoints: healing,
+					Reason:     "death",
+				},
+			})
+		}
+		if props["ubercharge"] == "1" {
+			result = append(result, &events.Event{
+				Type: events.EventTypeUberDropped,
+				Medic: &events.MedicEvent{
+					BaseEvent:  base(events.EventTypeUberDropped),
+					Medic:      target,
+					ActionType: string(events.EventTypeUberDropped),
+					UberCharge: 1,
+				},
+			})
+		}
+		return result
+
+	case "jarate_attack", "milk_attack":
+		if !hasTarget {
+			return nil
+		}
+
+		jarType := "jarate"
+		if action == "milk_attack" {
+			jarType = "mad_milk"
+		}
+
+		return []*events.Event{{
+			Type: events.EventTypeJarate,
+			Jarate: &events.JarateEvent{
+				BaseEvent: base(events.EventTypeJarate),
+				Attacker:  player,
+				Victim:    target,
+				JarType:   jarType,
+			},
+		}}
+
+	case "shield_blocked":
+		if !hasTarget {
+			return nil
+		}
+
+		return []*events.Event{{
+			Type: events.EventTypeShieldBlocked,
+			ShieldBlock: &events.ShieldBlockEvent{
+				BaseEvent: base(events.EventTypeShieldBlocked),
+				Blocker:   player,
+				Attacker:  target,
+			},
+		}}
+
+	case "player_builtobject":
+		return []*events.Event{{
+			Type: events.EventTypeBuiltObject,
+			Building: &events.BuildingEvent{
+				BaseEvent: base(events.EventTypeBuiltObject),
+				Player:    player,
+				Object:    events.ObjectInfo{Type: logObjectType(props["object"])},
+				Position:  parseLogPosition(props["position"]),
+			},
+		}}
+
+	case "killedobject":
+		owner, ok := parseLogPlayer(props["objectowner"])
+		if !ok {
+			return nil
+		}
+
+		return []*events.Event{{
+			Type: events.EventTypeKilledObject,
+			KilledObject: &events.KilledObjectEvent{
+				BaseEvent: base(events.EventTypeKilledObject),
+				Attacker:  player,
+				Owner:     owner,
+				Object:    events.ObjectInfo{Type: logObjectType(props["object"])},
+				Weapon:    events.Weapon{Name: props["weapon"]},
+				Position:  parseLogPosition(props["attacker_position"]),
+			},
+		}}
+	}
+
+	return nil
+}
+
+// parseWorldTrigger parses a "World triggered" line
+func (p *LogParser) parseWorldTrigger(timestamp time.Time, base func(events.EventType) events.BaseEvent, action string, props map[string]string) []*events.Event {
+	switch action {
+	case "Round_Start":
+		p.roundStart = timestamp
+		if p.matchStart.IsZero() {
+			p.matchStart = timestamp
+		}
+
+		return []*events.Event{{
+			Type: events.EventTypeRoundStart,
+			MatchStart: &events.MatchStartEvent{
+				BaseEvent: base(events.EventTypeRoundStart),
+				Map:       p.mapName,
+			},
+		}}
+
+	case "Round_Win", "Round_Stalemate":
+		winner := 0
+		if action == "Round_Win" {
+			winner = logTeam(props["winner"])
+		}
+
+		return []*events.Event{{
+			Type: events.EventTypeRoundEnd,
+			MatchEnd: &events.MatchEndEvent{
+				BaseEvent:  base(events.EventTypeRoundEnd),
+				WinnerTeam: winner,
+				Duration:   secondsSince(p.roundStart, timestamp),
+			},
+		}}
+
+	case "Game_Over":
+		winner := 0
+		if red, blu := p.scores[2], p.scores[3]; red > blu {
+			winner = 2
+		} else if blu > red {
+			winner = 3
+		}
+
+		event := &events.Event{
+			Type: events.EventTypeMatchEnd,
+			MatchEnd: &events.MatchEndEvent{
+				BaseEvent:  base(events.EventTypeMatchEnd),
+				WinnerTeam: winner,
+				Duration:   secondsSince(p.matchStart, timestamp),
+			},
+		}
+
+		p.matchStart = time.Time{}
+		p.scores = make(map[int]int)
+
+		return []*events.Event{event}
+	}
+
+	return nil
+}
+
+// parseLogPlayer parses a "Name<uid><steamid><Team>" player token. The
+// SteamID is normalized to a SteamID64. Bots, the console and players without
+// a Steam account are not players and are rejected.
+func parseLogPlayer(s string) (events.Player, bool) {
+	m := logPlayerRegex.FindStringSubmatch(s)
+	if m == nil {
+		return events.Player{}, false
+	}
+
+	steamID, err := steamid.Normalize(m[3])
+	if err != nil {
+		return events.Player{}, false
+	}
+
+	return events.Player{
+		SteamID: steamID,
+		Name:    m[1],
+		Team:    logTeam(m[4]),
+	}, true
+}
+
+// parseLogProperties parses trailing (key "value") pairs
+func parseLogProperties(s string) map[string]string {
+	props := make(map[string]string)
+	for _, m := range logPropertyRegex.FindAllStringSubmatch(s, -1) {
+		props[m[1]] = m[2]
+	}
+	return props
+}
+
+// parseLogPosition parses an "x y z" position property
+func parseLogPosition(s string) *events.Position {
+	fields := strings.Fields(s)
+	if len(fields) != 3 {
+		return nil
+	}
+
+	var coords [3]float64
+	for i, f := range fields {
+		v, err := strconv.ParseFloat(f, 64)
+		if err != nil {
+			return nil
+		}
+		coords[i] = v
+	}
+
+	return &events.Position{X: coords[0], Y: coords[1], Z: coords[2]}
+}
+
+// logTeam maps a log team name to a team number (2=RED, 3=BLU)
+func logTeam(name string) int {
+	switch strings.ToLower(name) {
+	case "red":
+		return 2
+	case "blue":
+		return 3
+	case "spectator":
+		return 1
+	default:
+		return 0
+	}
+}
+
+// logObjectType maps a log object name (OBJ_SENTRYGUN) to an object type
+func logObjectType(name string) string {
+	switch strings.ToUpper(name) {
+	case "OBJ_SENTRYGUN", "OBJ_SENTRYGUN_MINI":
+		return "sentry"
+	case "OBJ_DISPENSER":
+		return "dispenser"
+	case "OBJ_TELEPORTER":
+		return "teleporter"
+	case "OBJ_ATTACHMENT_SAPPER":
+		return "sapper"
+	default:
+		return strings.ToLower(strings.TrimPrefix(strings.ToUpper(name), "OBJ_"))
+	}
+}
+
+// secondsSince returns the whole seconds between start and end, or 0 if start is unknown
+func secondsSince(start, end time.Time) int {
+	if start.IsZero() || end.Before(start) {
+		return 0
+	}
+	return int(end.Sub(start) / time.Second)
+}
@@ -0,0 +1,188 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/UDL-TF/UnitedStats/pkg/events"
+)
+
+// TestParseLogKill tests parsing a native kill line
+func TestParseLogKill(t *testing.T) {
+	p := NewLogParser("eu-1", "default")
+
+	line := `L 02/01/2024 - 12:00:00: "Player1<2><[U:1:12345]><Red>" killed "Player2<3><[U:1:67890]><Blue>" with "tf_projectile_rocket" (crit "crit") (attacker_position "100 200 -50") (victim_position "150 250 -50")`
+
+	parsed, err := p.ParseLogLine(line)
+	if err != nil {
+		t.Fatalf("ParseLogLine() error = %v", err)
+	}
+	if len(parsed) != 1 || parsed[0].Kill == nil {
+		t.Fatalf("ParseLogLine() = %v, want one kill event", parsed)
+	}
+
+	kill := parsed[0].Kill
+	if kill.ServerIP != "eu-1" {
+		t.Errorf("ServerIP = %v, want eu-1", kill.ServerIP)
+	}
+	if kill.Killer.SteamID != "76561197960278073" || kill.Killer.Team != 2 {
+		t.Errorf("Killer = %+v, want 76561197960278073 ([U:1:12345]) on RED", kill.Killer)
+	}
+	if kill.Victim.Name != "Player2" || kill.Victim.Team != 3 {
+		t.Errorf("Victim = %+v, want Player2 on BLU", kill.Victim)
+	}
+	if kill.Weapon.Name != "tf_projectile_rocket" {
+		t.Errorf("Weapon.Name = %v, want tf_projectile_rocket", kill.Weapon.Name)
+	}
+	if !kill.Crit {
+		t.Error("Crit = false, want true")
+	}
+	if kill.KillerPos == nil || kill.KillerPos.X != 100 || kill.KillerPos.Z != -50 {
+		t.Errorf("KillerPos = %+v, want {100 200 -50}", kill.KillerPos)
+	}
+}
+
+// TestParseLogLines tests the event types produced by native log lines
+func TestParseLogLines(t *testing.T) {
+	tests := []struct {
+		name      string
+		line      string
+		wantTypes []events.EventType
+	}{
+		{
+			name:      "Headshot",
+			line:      `L 02/01/2024 - 12:00:00: "Sniper<2><[U:1:1]><Blue>" killed "Scout<3><[U:1:2]><Red>" with "sniperrifle" (customkill "headshot")`,
+			wantTypes: []events.EventType{events.EventTypeKill},
+		},
+		{
+			name:      "Medic death with uber",
+			line:      `L 02/01/2024 - 12:00:00: "Soldier<2><[U:1:1]><Blue>" triggered "medic_death" against "Medic<3><[U:1:2]><Red>" (healing "1200") (ubercharge "1")`,
+			wantTypes: []events.EventType{events.EventTypeHealed, events.EventTypeUberDropped},
+		},
+		{
+			name:      "Medic death without healing",
+			line:      `L 02/01/2024 - 12:00:00: "Soldier<2><[U:1:1]><Blue>" triggered "medic_death" against "Medic<3><[U:1:2]><Red>" (healing "0") (ubercharge "0")`,
+			wantTypes: nil,
+		},
+		{
+			name:      "Uber deployed",
+			line:      `L 02/01/2024 - 12:00:00: "Medic<3><[U:1:2]><Red>" triggered "chargedeployed" (medigun "medigun")`,
+			wantTypes: []events.EventType{events.EventTypeUberDeployed},
+		},
+		{
+			name:      "Built object",
+			line:      `L 02/01/2024 - 12:00:00: "Engi<4><[U:1:3]><Red>" triggered "player_builtobject" (object "OBJ_SENTRYGUN") (position "10 20 30")`,
+			wantTypes: []events.EventType{events.EventTypeBuiltObject},
+		},
+		{
+			name:      "Kill assist",
+			line:      `L 02/01/2024 - 12:00:00: "Medic<3><[U:1:2]><Red>" triggered "kill assist" against "Scout<4><[U:1:4]><Blue>" (assister_position "1 2 3")`,
+			wantTypes: []events.EventType{events.EventTypeAssist},
+		},
+		{
+			name:      "Domination",
+			line:      `L 02/01/2024 - 12:00:00: "Soldier<2><[U:1:1]><Blue>" triggered "domination" against "Medic<3><[U:1:2]><Red>"`,
+			wantTypes: []events.EventType{events.EventTypeDomination},
+		},
+		{
+			name:      "Revenge",
+			line:      `L 02/01/2024 - 12:00:00: "Medic<3><[U:1:2]><Red>" triggered "revenge" against "Soldier<2><[U:1:1]><Blue>" (assist "1")`,
+			wantTypes: []events.EventType{events.EventTypeRevenge},
+		},
+		{
+			name:      "Object detonated",
+			line:      `L 02/01/2024 - 12:00:00: "Engi<4><[U:1:3]><Red>" triggered "object_detonated" (object "OBJ_DISPENSER") (attacker_position "10 20 30")`,
+			wantTypes: []events.EventType{events.EventTypeObjectDestroyed},
+		},
+		{
+			name:      "Spawn",
+			line:      `L 02/01/2024 - 12:00:00: "Player1<2><[U:1:12345]><Red>" spawned as "Soldier"`,
+			wantTypes: []events.EventType{events.EventTypePlayerSpawn},
+		},
+		{
+			name:      "Disconnect",
+			line:      `L 02/01/2024 - 12:00:00: "Player1<2><[U:1:12345]><Red>" disconnected (reason "Disconnect by user.")`,
+			wantTypes: []events.EventType{events.EventTypePlayerDisconnect},
+		},
+		{
+			name:      "Round win",
+			line:      `L 02/01/2024 - 12:05:00: World triggered "Round_Win" (winner "Red")`,
+			wantTypes: []events.EventType{events.EventTypeRoundEnd},
+		},
+		{
+			name:      "Class change",
+			line:      `L 02/01/2024 - 12:00:00: "Player1<2><[U:1:12345]><Red>" changed role to "scout"`,
+			wantTypes: []events.EventType{events.EventTypeClassChange},
+		},
+		{
+			name:      "Bot kill",
+			line:      `L 02/01/2024 - 12:00:00: "Bot<5><BOT><Red>" killed "Player2<3><[U:1:67890]><Blue>" with "scattergun"`,
+			wantTypes: nil,
+		},
+		{
+			name:      "Chat",
+			line:      `L 02/01/2024 - 12:00:00: "Player1<2><[U:1:12345]><Red>" say "gg"`,
+			wantTypes: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := NewLogParser("eu-1", "default").ParseLogLine(tt.line)
+			if err != nil {
+				t.Fatalf("ParseLogLine() error = %v", err)
+			}
+
+			if len(parsed) != len(tt.wantTypes) {
+				t.Fatalf("ParseLogLine() returned %d events, want %d", len(parsed), len(tt.wantTypes))
+			}
+			for i, want := range tt.wantTypes {
+				if parsed[i].Type != want {
+					t.Errorf("event %d Type = %v, want %v", i, parsed[i].Type, want)
+				}
+				if parsed[i].Body() == nil {
+					t.Errorf("event %d has no body", i)
+				}
+			}
+		})
+	}
+}
+
+// TestParseLogMatch tests that match state carries across lines
+func TestParseLogMatch(t *testing.T) {
+	p := NewLogParser("eu-1", "default")
+
+	lines := []string{
+		`L 02/01/2024 - 12:00:00: Started map "cp_process_final" (CRC "abc")`,
+		`L 02/01/2024 - 12:00:30: World triggered "Round_Start"`,
+		`L 02/01/2024 - 12:29:30: Team "Red" final score "5" with "6" players`,
+		`L 02/01/2024 - 12:29:30: Team "Blue" final score "3" with "6" players`,
+	}
+	for _, line := range lines {
+		if _, err := p.ParseLogLine(line); err != nil {
+			t.Fatalf("ParseLogLine(%q) error = %v", line, err)
+		}
+	}
+
+	parsed, err := p.ParseLogLine(`L 02/01/2024 - 12:30:00: World triggered "Game_Over" reason "Reached Win Limit"`)
+	if err != nil {
+		t.Fatalf("ParseLogLine() error = %v", err)
+	}
+	if len(parsed) != 1 || parsed[0].MatchEnd == nil {
+		t.Fatalf("ParseLogLine() = %v, want one match_end event", parsed)
+	}
+
+	end := parsed[0].MatchEnd
+	if end.WinnerTeam != 2 {
+		t.Errorf("WinnerTeam = %d, want 2", end.WinnerTeam)
+	}
+	if end.Duration != 1800 {
+		t.Errorf("Duration = %d, want 1800", end.Duration)
+	}
+}
+
+// TestParseLogInvalid tests that non-log lines are rejected
+func TestParseLogInvalid(t *testing.T) {
+	if _, err := NewLogParser("eu-1", "default").ParseLogLine(`{"event_type":"kill"}`); err == nil {
+		t.Error("ParseLogLine() error = nil, want error")
+	}
+}
@@ -0,0 +1,43 @@
+package parser
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/UDL-TF/UnitedStats/pkg/events"
+)
+
+// maxEventIDLength is the longest event ID stored as is. Longer IDs are
+// hashed so every key fits the events.event_key column.
+const maxEventIDLength = 64
+
+// EventKey returns the key an event is deduplicated on: the event ID the
+// plugin generated, or for events without one (older plugins, log files) a
+// hash of the payload. Identical payloads without an ID are treated as one
+// event.
+func EventKey(event *events.Event, payload []byte) string {
+	if id := event.Base().EventID; id != "" {
+		if len(id) <= maxEventIDLength {
+			return id
+		}
+		return hashKey([]byte(id))
+	}
+
+	// Hash the fields in a fixed order, so the key does not depend on how
+	// the payload was formatted
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &fields); err == nil {
+		if canonical, err := json.Marshal(fields); err == nil {
+			payload = canonical
+		}
+	}
+
+	return hashKey(payload)
+}
+
+// hashKey returns the hex SHA-256 of data
+func hashKey(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
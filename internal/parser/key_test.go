@@ -0,0 +1,71 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestEventKey tests which events share a deduplication key
+func TestEventKey(t *testing.T) {
+	const kill = `{"timestamp":"2024-02-01T12:00:00Z","gamemode":"default","server_ip":"10.0.0.1","event_type":"kill","killer":{"steam_id":"76561198012345678","name":"Player1","team":2},"victim":{"steam_id":"76561198087654321","name":"Player2","team":3},"weapon":{"name":"scattergun"}}`
+
+	tests := []struct {
+		name     string
+		a        string
+		b        string
+		wantSame bool
+	}{
+		{
+			name:     "Same payload",
+			a:        kill,
+			b:        kill,
+			wantSame: true,
+		},
+		{
+			name:     "Same fields in another order",
+			a:        kill,
+			b:        `{"event_type":"kill","server_ip":"10.0.0.1","gamemode":"default","timestamp":"2024-02-01T12:00:00Z","weapon":{"name":"scattergun"},"victim":{"steam_id":"76561198087654321","name":"Player2","team":3},"killer":{"steam_id":"76561198012345678","name":"Player1","team":2}}`,
+			wantSame: true,
+		},
+		{
+			name:     "Different payload",
+			a:        kill,
+			b:        strings.Replace(kill, "12:00:00Z", "12:00:01Z", 1),
+			wantSame: false,
+		},
+		{
+			name:     "Same event ID",
+			a:        strings.Replace(kill, `"kill"`, `"kill","event_id":"a1b2c3"`, 1),
+			b:        strings.Replace(kill, `"kill"`, `"kill","event_id":"a1b2c3","schema_version":2`, 1),
+			wantSame: true,
+		},
+		{
+			name:     "Different event IDs",
+			a:        strings.Replace(kill, `"kill"`, `"kill","event_id":"a1b2c3"`, 1),
+			b:        strings.Replace(kill, `"kill"`, `"kill","event_id":"d4e5f6"`, 1),
+			wantSame: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := ParseLine(tt.a)
+			if err != nil {
+				t.Fatalf("ParseLine() error = %v", err)
+			}
+			b, err := ParseLine(tt.b)
+			if err != nil {
+				t.Fatalf("ParseLine() error = %v", err)
+			}
+
+			keyA := EventKey(a, []byte(tt.a))
+			keyB := EventKey(b, []byte(tt.b))
+			if (keyA == keyB) != tt.wantSame {
+				t.Errorf("EventKey() = %q and %q, want same = %v", keyA, keyB, tt.wantSame)
+			}
+			if len(keyA) > maxEventIDLength {
+				t.Errorf("EventKey() length = %d, want at most %d", len(keyA), maxEventIDLength)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package parser
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/UDL-TF/UnitedStats/pkg/events"
@@ -19,12 +20,18 @@ func (e *ParseError) Error() string {
 }
 
 // eventParserFunc is a type for event parser functions
-type eventParserFunc func(string) (*events.Event, error)
+type eventParserFunc func([]byte) (*events.Event, error)
 
 // eventParsers maps event types to their parser functions
 var eventParsers = map[events.EventType]eventParserFunc{
 	// Combat events
 	events.EventTypeKill:          parseKillEvent,
+	events.EventTypeAssist:        parseAssistEvent,
+	events.EventTypeDomination:    parseDominationEvent,
+	events.EventTypeRevenge:       parseDominationEvent,
+	events.EventTypeHeadshot:      parseSpecialKillEvent,
+	events.EventTypeBackstab:      parseSpecialKillEvent,
+	events.EventTypeFirstBlood:    parseSpecialKillEvent,
 	events.EventTypeAirshot:       parseAirshotEvent,
 	events.EventTypeDeflect:       parseDeflectEvent,
 	events.EventTypeStun:          parseStunEvent,
@@ -40,8 +47,9 @@ var eventParsers = map[events.EventType]eventParserFunc{
 	events.EventTypeTeleportUsed:   parseTeleportEvent,
 
 	// Building events
-	events.EventTypeBuiltObject:  parseBuildingEvent,
-	events.EventTypeKilledObject: parseKilledObjectEvent,
+	events.EventTypeBuiltObject:     parseBuildingEvent,
+	events.EventTypeObjectDestroyed: parseBuildingEvent,
+	events.EventTypeKilledObject:    parseKilledObjectEvent,
 
 	// Medic events
 	events.EventTypeHealed:        parseHealedEvent,
@@ -65,65 +73,104 @@ var eventParsers = map[events.EventType]eventParserFunc{
 	events.EventTypeMVP3:       parseMVPEvent,
 
 	// Player events
-	events.EventTypePlayerLoadout: parsePlayerLoadoutEvent,
-	events.EventTypeWeaponStats:   parseWeaponStatsEvent,
-	events.EventTypeClassChange:   parseClassChangeEvent,
+	events.EventTypePlayerLoadout:    parsePlayerLoadoutEvent,
+	events.EventTypeWeaponStats:      parseWeaponStatsEvent,
+	events.EventTypeClassChange:      parseClassChangeEvent,
+	events.EventTypePlayerSpawn:      parsePlayerSpawnEvent,
+	events.EventTypePlayerDisconnect: parsePlayerDisconnectEvent,
+
+	// Server events
+	events.EventTypeServerOnline:  parseServerStatusEvent,
+	events.EventTypeServerOffline: parseServerStatusEvent,
 }
 
-// ParseLine parses a single JSON log line into an Event
+// EventTypes returns the event types the parser understands, sorted by name
+func EventTypes() []events.EventType {
+	types := make([]events.EventType, 0, len(eventParsers))
+	for eventType := range eventParsers {
+		types = append(types, eventType)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
+// ParseLine parses a single JSON log line into an Event. Empty lines,
+// comments and unknown event types yield no event and no error. Use a Reader
+// to read a whole file.
 func ParseLine(line string) (*events.Event, error) {
 	// Trim whitespace
 	line = strings.TrimSpace(line)
 
-	// Skip empty lines
-	if line == "" {
-		return nil, nil
-	}
-
 	// Skip comment lines
 	if strings.HasPrefix(line, "#") {
 		return nil, nil
 	}
 
-	// First, parse just to get the event_type
-	var baseEvent struct {
-		EventType events.EventType `json:"event_type"`
+	return Decode([]byte(line))
+}
+
+// parseKillEvent parses a kill event JSON
+func parseKillEvent(data []byte) (*events.Event, error) {
+	var killEvent events.KillEvent
+
+	if err := json.Unmarshal(data, &killEvent); err != nil {
+		return nil, &ParseError{Line: string(data), Reason: fmt.Sprintf("invalid kill event: %v", err)}
 	}
 
-	if err := json.Unmarshal([]byte(line), &baseEvent); err != nil {
-		return nil, &ParseError{Line: line, Reason: fmt.Sprintf("invalid JSON: %v", err)}
+	return &events.Event{
+		Type: events.EventTypeKill,
+		Kill: &killEvent,
+	}, nil
+}
+
+// parseAssistEvent parses a kill assist event JSON
+func parseAssistEvent(data []byte) (*events.Event, error) {
+	var assistEvent events.AssistEvent
+
+	if err := json.Unmarshal(data, &assistEvent); err != nil {
+		return nil, &ParseError{Line: string(data), Reason: fmt.Sprintf("invalid assist event: %v", err)}
 	}
 
-	// Look up the parser function for this event type
-	parser, ok := eventParsers[baseEvent.EventType]
-	if !ok {
-		// Unknown event type - skip but don't error
-		return nil, nil
+	return &events.Event{
+		Type:   events.EventTypeAssist,
+		Assist: &assistEvent,
+	}, nil
+}
+
+// parseDominationEvent parses a domination or revenge event JSON
+func parseDominationEvent(data []byte) (*events.Event, error) {
+	var dominationEvent events.DominationEvent
+
+	if err := json.Unmarshal(data, &dominationEvent); err != nil {
+		return nil, &ParseError{Line: string(data), Reason: fmt.Sprintf("invalid domination event: %v", err)}
 	}
 
-	return parser(line)
+	return &events.Event{
+		Type:       dominationEvent.EventType,
+		Domination: &dominationEvent,
+	}, nil
 }
 
-// parseKillEvent parses a kill event JSON
-func parseKillEvent(line string) (*events.Event, error) {
-	var killEvent events.KillEvent
+// parseSpecialKillEvent parses a headshot, backstab or first blood event JSON
+func parseSpecialKillEvent(data []byte) (*events.Event, error) {
+	var specialKillEvent events.SpecialKillEvent
 
-	if err := json.Unmarshal([]byte(line), &killEvent); err != nil {
-		return nil, &ParseError{Line: line, Reason: fmt.Sprintf("invalid kill event: %v", err)}
+	if err := json.Unmarshal(data, &specialKillEvent); err != nil {
+		return nil, &ParseError{Line: string(data), Reason: fmt.Sprintf("invalid special kill event: %v", err)}
 	}
 
 	return &events.Event{
-		Type: events.EventTypeKill,
-		Kill: &killEvent,
+		Type:        specialKillEvent.EventType,
+		SpecialKill: &specialKillEvent,
 	}, nil
 }
 
 // parseAirshotEvent parses an airshot event JSON
-func parseAirshotEvent(line string) (*events.Event, error) {
+func parseAirshotEvent(data []byte) (*events.Event, error) {
 	var airshotEvent events.AirshotEvent
 
-	if err := json.Unmarshal([]byte(line), &airshotEvent); err != nil {
-		return nil, &ParseError{Line: line, Reason: fmt.Sprintf("invalid airshot event: %v", err)}
+	if err := json.Unmarshal(data, &airshotEvent); err != nil {
+		return nil, &ParseError{Line: string(data), Reason: fmt.Sprintf("invalid airshot event: %v", err)}
 	}
 
 	return &events.Event{
@@ -133,11 +180,11 @@ func parseAirshotEvent(line string) (*events.Event, error) {
 }
 
 // parseDeflectEvent parses a deflect event JSON
-func parseDeflectEvent(line string) (*events.Event, error) {
+func parseDeflectEvent(data []byte) (*events.Event, error) {
 	var deflectEvent events.DeflectEvent
 
-	if err := json.Unmarshal([]byte(line), &deflectEvent); err != nil {
-		return nil, &ParseError{Line: line, Reason: fmt.Sprintf("invalid deflect event: %v", err)}
+	if err := json.Unmarshal(data, &deflectEvent); err != nil {
+		return nil, &ParseError{Line: string(data), Reason: fmt.Sprintf("invalid deflect event: %v", err)}
 	}
 
 	return &events.Event{
@@ -147,11 +194,11 @@ func parseDeflectEvent(line string) (*events.Event, error) {
 }
 
 // parseStunEvent parses a stun event JSON
-func parseStunEvent(line string) (*events.Event, error) {
+func parseStunEvent(data []byte) (*events.Event, error) {
 	var stunEvent events.StunEvent
 
-	if err := json.Unmarshal([]byte(line), &stunEvent); err != nil {
-		return nil, &ParseError{Line: line, Reason: fmt.Sprintf("invalid stun event: %v", err)}
+	if err := json.Unmarshal(data, &stunEvent); err != nil {
+		return nil, &ParseError{Line: string(data), Reason: fmt.Sprintf("invalid stun event: %v", err)}
 	}
 
 	return &events.Event{
@@ -161,11 +208,11 @@ func parseStunEvent(line string) (*events.Event, error) {
 }
 
 // parseJarateEvent parses a jarate/mad milk event JSON
-func parseJarateEvent(line string) (*events.Event, error) {
+func parseJarateEvent(data []byte) (*events.Event, error) {
 	var jarateEvent events.JarateEvent
 
-	if err := json.Unmarshal([]byte(line), &jarateEvent); err != nil {
-		return nil, &ParseError{Line: line, Reason: fmt.Sprintf("invalid jarate event: %v", err)}
+	if err := json.Unmarshal(data, &jarateEvent); err != nil {
+		return nil, &ParseError{Line: string(data), Reason: fmt.Sprintf("invalid jarate event: %v", err)}
 	}
 
 	return &events.Event{
@@ -175,11 +222,11 @@ func parseJarateEvent(line string) (*events.Event, error) {
 }
 
 // parseShieldBlockEvent parses a shield block event JSON
-func parseShieldBlockEvent(line string) (*events.Event, error) {
+func parseShieldBlockEvent(data []byte) (*events.Event, error) {
 	var shieldBlockEvent events.ShieldBlockEvent
 
-	if err := json.Unmarshal([]byte(line), &shieldBlockEvent); err != nil {
-		return nil, &ParseError{Line: line, Reason: fmt.Sprintf("invalid shield_block event: %v", err)}
+	if err := json.Unmarshal(data, &shieldBlockEvent); err != nil {
+		return nil, &ParseError{Line: string(data), Reason: fmt.Sprintf("invalid shield_block event: %v", err)}
 	}
 
 	return &events.Event{
@@ -189,11 +236,11 @@ func parseShieldBlockEvent(line string) (*events.Event, error) {
 }
 
 // parseJumpEvent parses a rocket/sticky jump event JSON
-func parseJumpEvent(line string) (*events.Event, error) {
+func parseJumpEvent(data []byte) (*events.Event, error) {
 	var jumpEvent events.JumpEvent
 
-	if err := json.Unmarshal([]byte(line), &jumpEvent); err != nil {
-		return nil, &ParseError{Line: line, Reason: fmt.Sprintf("invalid jump event: %v", err)}
+	if err := json.Unmarshal(data, &jumpEvent); err != nil {
+		return nil, &ParseError{Line: string(data), Reason: fmt.Sprintf("invalid jump event: %v", err)}
 	}
 
 	return &events.Event{
@@ -203,11 +250,11 @@ func parseJumpEvent(line string) (*events.Event, error) {
 }
 
 // parseJumpKillEvent parses a jump kill event JSON
-func parseJumpKillEvent(line string) (*events.Event, error) {
+func parseJumpKillEvent(data []byte) (*events.Event, error) {
 	var jumpKillEvent events.JumpKillEvent
 
-	if err := json.Unmarshal([]byte(line), &jumpKillEvent); err != nil {
-		return nil, &ParseError{Line: line, Reason: fmt.Sprintf("invalid jump_kill event: %v", err)}
+	if err := json.Unmarshal(data, &jumpKillEvent); err != nil {
+		return nil, &ParseError{Line: string(data), Reason: fmt.Sprintf("invalid jump_kill event: %v", err)}
 	}
 
 	return &events.Event{
@@ -217,11 +264,11 @@ func parseJumpKillEvent(line string) (*events.Event, error) {
 }
 
 // parseTeleportEvent parses a teleport event JSON
-func parseTeleportEvent(line string) (*events.Event, error) {
+func parseTeleportEvent(data []byte) (*events.Event, error) {
 	var teleportEvent events.TeleportEvent
 
-	if err := json.Unmarshal([]byte(line), &teleportEvent); err != nil {
-		return nil, &ParseError{Line: line, Reason: fmt.Sprintf("invalid teleport event: %v", err)}
+	if err := json.Unmarshal(data, &teleportEvent); err != nil {
+		return nil, &ParseError{Line: string(data), Reason: fmt.Sprintf("invalid teleport event: %v", err)}
 	}
 
 	return &events.Event{
@@ -230,26 +277,26 @@ func parseTeleportEvent(line string) (*events.Event, error) {
 	}, nil
 }
 
-// parseBuildingEvent parses a building built event JSON
-func parseBuildingEvent(line string) (*events.Event, error) {
+// parseBuildingEvent parses a building built or destroyed event JSON
+func parseBuildingEvent(data []byte) (*events.Event, error) {
 	var buildingEvent events.BuildingEvent
 
-	if err := json.Unmarshal([]byte(line), &buildingEvent); err != nil {
-		return nil, &ParseError{Line: line, Reason: fmt.Sprintf("invalid building event: %v", err)}
+	if err := json.Unmarshal(data, &buildingEvent); err != nil {
+		return nil, &ParseError{Line: string(data), Reason: fmt.Sprintf("invalid building event: %v", err)}
 	}
 
 	return &events.Event{
-		Type:     events.EventTypeBuiltObject,
+		Type:     buildingEvent.EventType,
 		Building: &buildingEvent,
 	}, nil
 }
 
 // parseKilledObjectEvent parses a killed object event JSON
-func parseKilledObjectEvent(line string) (*events.Event, error) {
+func parseKilledObjectEvent(data []byte) (*events.Event, error) {
 	var killedObjectEvent events.KilledObjectEvent
 
-	if err := json.Unmarshal([]byte(line), &killedObjectEvent); err != nil {
-		return nil, &ParseError{Line: line, Reason: fmt.Sprintf("invalid killed_object event: %v", err)}
+	if err := json.Unmarshal(data, &killedObjectEvent); err != nil {
+		return nil, &ParseError{Line: string(data), Reason: fmt.Sprintf("invalid killed_object event: %v", err)}
 	}
 
 	return &events.Event{
@@ -259,11 +306,11 @@ func parseKilledObjectEvent(line string) (*events.Event, error) {
 }
 
 // parseHealedEvent parses a healed event JSON
-func parseHealedEvent(line string) (*events.Event, error) {
+func parseHealedEvent(data []byte) (*events.Event, error) {
 	var healedEvent events.HealedEvent
 
-	if err := json.Unmarshal([]byte(line), &healedEvent); err != nil {
-		return nil, &ParseError{Line: line, Reason: fmt.Sprintf("invalid healed event: %v", err)}
+	if err := json.Unmarshal(data, &healedEvent); err != nil {
+		return nil, &ParseError{Line: string(data), Reason: fmt.Sprintf("invalid healed event: %v", err)}
 	}
 
 	return &events.Event{
@@ -273,11 +320,11 @@ func parseHealedEvent(line string) (*events.Event, error) {
 }
 
 // parseMedicEvent parses a medic event JSON
-func parseMedicEvent(line string) (*events.Event, error) {
+func parseMedicEvent(data []byte) (*events.Event, error) {
 	var medicEvent events.MedicEvent
 
-	if err := json.Unmarshal([]byte(line), &medicEvent); err != nil {
-		return nil, &ParseError{Line: line, Reason: fmt.Sprintf("invalid medic event: %v", err)}
+	if err := json.Unmarshal(data, &medicEvent); err != nil {
+		return nil, &ParseError{Line: string(data), Reason: fmt.Sprintf("invalid medic event: %v", err)}
 	}
 
 	return &events.Event{
@@ -287,11 +334,11 @@ func parseMedicEvent(line string) (*events.Event, error) {
 }
 
 // parseBuffEvent parses a buff deployed event JSON
-func parseBuffEvent(line string) (*events.Event, error) {
+func parseBuffEvent(data []byte) (*events.Event, error) {
 	var buffEvent events.BuffEvent
 
-	if err := json.Unmarshal([]byte(line), &buffEvent); err != nil {
-		return nil, &ParseError{Line: line, Reason: fmt.Sprintf("invalid buff event: %v", err)}
+	if err := json.Unmarshal(data, &buffEvent); err != nil {
+		return nil, &ParseError{Line: string(data), Reason: fmt.Sprintf("invalid buff event: %v", err)}
 	}
 
 	return &events.Event{
@@ -301,11 +348,11 @@ func parseBuffEvent(line string) (*events.Event, error) {
 }
 
 // parseFoodEvent parses a food event JSON
-func parseFoodEvent(line string) (*events.Event, error) {
+func parseFoodEvent(data []byte) (*events.Event, error) {
 	var foodEvent events.FoodEvent
 
-	if err := json.Unmarshal([]byte(line), &foodEvent); err != nil {
-		return nil, &ParseError{Line: line, Reason: fmt.Sprintf("invalid food event: %v", err)}
+	if err := json.Unmarshal(data, &foodEvent); err != nil {
+		return nil, &ParseError{Line: string(data), Reason: fmt.Sprintf("invalid food event: %v", err)}
 	}
 
 	return &events.Event{
@@ -315,11 +362,11 @@ func parseFoodEvent(line string) (*events.Event, error) {
 }
 
 // parseMatchStartEvent parses a match_start event JSON
-func parseMatchStartEvent(line string) (*events.Event, error) {
+func parseMatchStartEvent(data []byte) (*events.Event, error) {
 	var matchStartEvent events.MatchStartEvent
 
-	if err := json.Unmarshal([]byte(line), &matchStartEvent); err != nil {
-		return nil, &ParseError{Line: line, Reason: fmt.Sprintf("invalid match_start event: %v", err)}
+	if err := json.Unmarshal(data, &matchStartEvent); err != nil {
+		return nil, &ParseError{Line: string(data), Reason: fmt.Sprintf("invalid match_start event: %v", err)}
 	}
 
 	return &events.Event{
@@ -329,11 +376,11 @@ func parseMatchStartEvent(line string) (*events.Event, error) {
 }
 
 // parseMatchEndEvent parses a match_end event JSON
-func parseMatchEndEvent(line string) (*events.Event, error) {
+func parseMatchEndEvent(data []byte) (*events.Event, error) {
 	var matchEndEvent events.MatchEndEvent
 
-	if err := json.Unmarshal([]byte(line), &matchEndEvent); err != nil {
-		return nil, &ParseError{Line: line, Reason: fmt.Sprintf("invalid match_end event: %v", err)}
+	if err := json.Unmarshal(data, &matchEndEvent); err != nil {
+		return nil, &ParseError{Line: string(data), Reason: fmt.Sprintf("invalid match_end event: %v", err)}
 	}
 
 	return &events.Event{
@@ -343,11 +390,11 @@ func parseMatchEndEvent(line string) (*events.Event, error) {
 }
 
 // parseMVPEvent parses an MVP event JSON
-func parseMVPEvent(line string) (*events.Event, error) {
+func parseMVPEvent(data []byte) (*events.Event, error) {
 	var mvpEvent events.MVPEvent
 
-	if err := json.Unmarshal([]byte(line), &mvpEvent); err != nil {
-		return nil, &ParseError{Line: line, Reason: fmt.Sprintf("invalid mvp event: %v", err)}
+	if err := json.Unmarshal(data, &mvpEvent); err != nil {
+		return nil, &ParseError{Line: string(data), Reason: fmt.Sprintf("invalid mvp event: %v", err)}
 	}
 
 	return &events.Event{
@@ -357,11 +404,11 @@ func parseMVPEvent(line string) (*events.Event, error) {
 }
 
 // parsePlayerLoadoutEvent parses a player loadout event JSON
-func parsePlayerLoadoutEvent(line string) (*events.Event, error) {
+func parsePlayerLoadoutEvent(data []byte) (*events.Event, error) {
 	var playerLoadoutEvent events.PlayerLoadoutEvent
 
-	if err := json.Unmarshal([]byte(line), &playerLoadoutEvent); err != nil {
-		return nil, &ParseError{Line: line, Reason: fmt.Sprintf("invalid player_loadout event: %v", err)}
+	if err := json.Unmarshal(data, &playerLoadoutEvent); err != nil {
+		return nil, &ParseError{Line: string(data), Reason: fmt.Sprintf("invalid player_loadout event: %v", err)}
 	}
 
 	return &events.Event{
@@ -371,11 +418,11 @@ func parsePlayerLoadoutEvent(line string) (*events.Event, error) {
 }
 
 // parseWeaponStatsEvent parses a weapon stats event JSON
-func parseWeaponStatsEvent(line string) (*events.Event, error) {
+func parseWeaponStatsEvent(data []byte) (*events.Event, error) {
 	var weaponStatsEvent events.WeaponStatsEvent
 
-	if err := json.Unmarshal([]byte(line), &weaponStatsEvent); err != nil {
-		return nil, &ParseError{Line: line, Reason: fmt.Sprintf("invalid weapon_stats event: %v", err)}
+	if err := json.Unmarshal(data, &weaponStatsEvent); err != nil {
+		return nil, &ParseError{Line: string(data), Reason: fmt.Sprintf("invalid weapon_stats event: %v", err)}
 	}
 
 	return &events.Event{
@@ -385,11 +432,11 @@ func parseWeaponStatsEvent(line string) (*events.Event, error) {
 }
 
 // parseClassChangeEvent parses a class change event JSON
-func parseClassChangeEvent(line string) (*events.Event, error) {
+func parseClassChangeEvent(data []byte) (*events.Event, error) {
 	var classChangeEvent events.ClassChangeEvent
 
-	if err := json.Unmarshal([]byte(line), &classChangeEvent); err != nil {
-		return nil, &ParseError{Line: line, Reason: fmt.Sprintf("invalid class_change event: %v", err)}
+	if err := json.Unmarshal(data, &classChangeEvent); err != nil {
+		return nil, &ParseError{Line: string(data), Reason: fmt.Sprintf("invalid class_change event: %v", err)}
 	}
 
 	return &events.Event{
@@ -397,3 +444,45 @@ func parseClassChangeEvent(line string) (*events.Event, error) {
 		ClassChange: &classChangeEvent,
 	}, nil
 }
+
+// parsePlayerSpawnEvent parses a player spawn event JSON
+func parsePlayerSpawnEvent(data []byte) (*events.Event, error) {
+	var playerSpawnEvent events.PlayerSpawnEvent
+
+	if err := json.Unmarshal(data, &playerSpawnEvent); err != nil {
+		return nil, &ParseError{Line: string(data), Reason: fmt.Sprintf("invalid player_spawn event: %v", err)}
+	}
+
+	return &events.Event{
+		Type:        events.EventTypePlayerSpawn,
+		PlayerSpawn: &playerSpawnEvent,
+	}, nil
+}
+
+// parsePlayerDisconnectEvent parses a player disconnect event JSON
+func parsePlayerDisconnectEvent(data []byte) (*events.Event, error) {
+	var playerDisconnectEvent events.PlayerDisconnectEvent
+
+	if err := json.Unmarshal(data, &playerDisconnectEvent); err != nil {
+		return nil, &ParseError{Line: string(data), Reason: fmt.Sprintf("invalid player_disconnect event: %v", err)}
+	}
+
+	return &events.Event{
+		Type:             events.EventTypePlayerDisconnect,
+		PlayerDisconnect: &playerDisconnectEvent,
+	}, nil
+}
+
+// parseServerStatusEvent parses a server_online or server_offline event JSON
+func parseServerStatusEvent(data []byte) (*events.Event, error) {
+	var serverStatusEvent events.ServerStatusEvent
+
+	if err := json.Unmarshal(data, &serverStatusEvent); err != nil {
+		return nil, &ParseError{Line: string(data), Reason: fmt.Sprintf("invalid server status event: %v", err)}
+	}
+
+	return &events.Event{
+		Type:         serverStatusEvent.EventType,
+		ServerStatus: &serverStatusEvent,
+	}, nil
+}
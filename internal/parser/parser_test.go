@@ -1,7 +1,8 @@
 package parser
 
 import (
-	"bufio"
+	"errors"
+	"io"
 	"os"
 	"strings"
 	"testing"
@@ -355,64 +356,44 @@ func TestParseAllFixtures(t *testing.T) {
 	}
 	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-	lineNum := 0
-	validEvents := 0
-	skippedLines := 0
-	errorCount := 0
-
-	for scanner.Scan() {
-		lineNum++
-		line := scanner.Text()
-
-		event, err := ParseLine(line)
+	reader, err := NewReader(file, ReaderConfig{})
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+	defer reader.Close()
 
-		if err != nil {
-			t.Logf("Line %d error: %v", lineNum, err)
-			errorCount++
-			continue
+	validEvents := 0
+	for {
+		record, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
 		}
-
-		if event == nil {
-			// Skipped line (comment, empty, unknown type)
-			skippedLines++
-			continue
+		if err != nil {
+			t.Fatalf("Error reading fixture file: %v", err)
 		}
 
 		validEvents++
 
 		// Basic validation: all events should have gamemode and server_ip
-		var gamemode, serverIP string
-		switch event.Type {
-		case events.EventTypeKill:
-			gamemode = event.Kill.Gamemode
-			serverIP = event.Kill.ServerIP
-		case events.EventTypeDeflect:
-			gamemode = event.Deflect.Gamemode
-			serverIP = event.Deflect.ServerIP
-		case events.EventTypeMatchStart:
-			gamemode = event.MatchStart.Gamemode
-			serverIP = event.MatchStart.ServerIP
-		case events.EventTypeMatchEnd:
-			gamemode = event.MatchEnd.Gamemode
-			serverIP = event.MatchEnd.ServerIP
+		base := record.Event.Base()
+		if base == nil {
+			t.Errorf("Line %d: %s event has no body", record.Line, record.Event.Type)
+			continue
 		}
 
-		if gamemode == "" {
-			t.Errorf("Line %d: event has empty gamemode", lineNum)
+		if base.Gamemode == "" {
+			t.Errorf("Line %d: event has empty gamemode", record.Line)
 		}
 
-		if serverIP == "" {
-			t.Errorf("Line %d: event has empty server IP", lineNum)
+		if base.ServerIP == "" {
+			t.Errorf("Line %d: event has empty server IP", record.Line)
 		}
 	}
 
-	if err := scanner.Err(); err != nil {
-		t.Fatalf("Error reading fixture file: %v", err)
+	for _, lineErr := range reader.Errors() {
+		t.Logf("%v", lineErr)
 	}
-
-	t.Logf("Parsed %d lines: %d valid events, %d skipped, %d errors",
-		lineNum, validEvents, skippedLines, errorCount)
+	t.Logf("Parsed %d valid events, %d errors", validEvents, len(reader.Errors()))
 
 	// We expect a good number of valid events
 	if validEvents < 20 {
@@ -420,10 +401,95 @@ func TestParseAllFixtures(t *testing.T) {
 	}
 }
 
+// TestParseFixtureEventTypes tests the fixtures of event types that are
+// also recorded on the kill event, and of player sessions
+func TestParseFixtureEventTypes(t *testing.T) {
+	file, err := os.Open("../../test/fixtures/sample_logs_json.txt")
+	if err != nil {
+		t.Skipf("Skipping fixture test: %v", err)
+		return
+	}
+	defer file.Close()
+
+	// The steam ID of the player each event is about
+	subjects := make(map[events.EventType]string)
+
+	reader, err := NewReader(file, ReaderConfig{})
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+	defer reader.Close()
+
+	for {
+		record, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Error reading fixture file: %v", err)
+		}
+		event := record.Event
+
+		switch {
+		case event.Assist != nil:
+			subjects[event.Type] = event.Assist.Assister.SteamID
+		case event.Domination != nil:
+			subjects[event.Type] = event.Domination.Player.SteamID
+		case event.SpecialKill != nil:
+			subjects[event.Type] = event.SpecialKill.Player.SteamID
+		case event.PlayerSpawn != nil:
+			subjects[event.Type] = event.PlayerSpawn.Player.SteamID
+		case event.PlayerDisconnect != nil:
+			subjects[event.Type] = event.PlayerDisconnect.Player.SteamID
+		case event.Building != nil:
+			subjects[event.Type] = event.Building.Player.SteamID
+		}
+	}
+
+	for _, eventType := range []events.EventType{
+		events.EventTypeAssist,
+		events.EventTypeDomination,
+		events.EventTypeRevenge,
+		events.EventTypeHeadshot,
+		events.EventTypeBackstab,
+		events.EventTypeFirstBlood,
+		events.EventTypePlayerSpawn,
+		events.EventTypePlayerDisconnect,
+		events.EventTypeObjectDestroyed,
+	} {
+		subject, ok := subjects[eventType]
+		if !ok {
+			t.Errorf("no %s event parsed from the fixtures", eventType)
+			continue
+		}
+		if subject == "" {
+			t.Errorf("%s event has no player", eventType)
+		}
+	}
+}
+
+// TestEventTypes tests that every registered event type is listed once, in order
+func TestEventTypes(t *testing.T) {
+	types := EventTypes()
+	if len(types) != len(eventParsers) {
+		t.Fatalf("EventTypes() returned %d types, want %d", len(types), len(eventParsers))
+	}
+
+	for i, eventType := range types {
+		if _, ok := eventParsers[eventType]; !ok {
+			t.Errorf("EventTypes() returned unregistered type %q", eventType)
+		}
+		if i > 0 && types[i-1] >= eventType {
+			t.Errorf("EventTypes() not sorted: %q before %q", types[i-1], eventType)
+		}
+	}
+}
+
 // BenchmarkParseKillEvent benchmarks KILL event parsing
 func BenchmarkParseKillEvent(b *testing.B) {
 	line := `{"timestamp":"2024-02-01T12:00:00Z","gamemode":"default","server_ip":"192.168.1.100","event_type":"kill","killer":{"steam_id":"76561198012345678","name":"Player1","team":2},"victim":{"steam_id":"76561198087654321","name":"Player2","team":3},"weapon":{"name":"scattergun"},"crit":false,"airborne":false}`
 
+	b.ReportAllocs()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		_, _ = ParseLine(line)
@@ -434,6 +500,7 @@ func BenchmarkParseKillEvent(b *testing.B) {
 func BenchmarkParseDeflectEvent(b *testing.B) {
 	line := `{"timestamp":"2024-02-01T12:05:00Z","gamemode":"dodgeball","server_ip":"192.168.1.100","event_type":"deflect","player":{"steam_id":"76561198012345678","name":"DodgeballPro","team":2},"rocket_speed":1500.5,"deflect_angle":1.0000,"timing_ms":50,"distance":100.0}`
 
+	b.ReportAllocs()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		_, _ = ParseLine(line)
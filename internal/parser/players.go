@@ -0,0 +1,93 @@
+package parser
+
+import (
+	"github.com/UDL-TF/UnitedStats/pkg/events"
+	"github.com/UDL-TF/UnitedStats/pkg/steamid"
+)
+
+// forEachPlayer calls fn with every player an event names, and the field
+// that names it. Optional players that are absent are skipped.
+func forEachPlayer(event *events.Event, fn func(field string, p *events.Player)) {
+	optional := func(field string, p *events.Player) {
+		if p != nil {
+			fn(field, p)
+		}
+	}
+
+	switch {
+	case event.Kill != nil:
+		fn("killer", &event.Kill.Killer)
+		fn("victim", &event.Kill.Victim)
+		optional("assister", event.Kill.Assister)
+	case event.Assist != nil:
+		fn("assister", &event.Assist.Assister)
+		optional("killer", event.Assist.Killer)
+		fn("victim", &event.Assist.Victim)
+	case event.Domination != nil:
+		fn("player", &event.Domination.Player)
+		fn("victim", &event.Domination.Victim)
+	case event.SpecialKill != nil:
+		fn("player", &event.SpecialKill.Player)
+		fn("victim", &event.SpecialKill.Victim)
+	case event.Airshot != nil:
+		fn("player", &event.Airshot.Player)
+		fn("victim", &event.Airshot.Victim)
+	case event.Deflect != nil:
+		fn("player", &event.Deflect.Player)
+		optional("owner", event.Deflect.Owner)
+	case event.Stun != nil:
+		fn("stunner", &event.Stun.Stunner)
+		fn("victim", &event.Stun.Victim)
+	case event.Jump != nil:
+		fn("player", &event.Jump.Player)
+	case event.JumpKill != nil:
+		fn("player", &event.JumpKill.Player)
+		fn("victim", &event.JumpKill.Victim)
+	case event.Teleport != nil:
+		fn("builder", &event.Teleport.Builder)
+		optional("user", event.Teleport.User)
+	case event.Building != nil:
+		fn("player", &event.Building.Player)
+	case event.KilledObject != nil:
+		fn("attacker", &event.KilledObject.Attacker)
+		fn("owner", &event.KilledObject.Owner)
+	case event.Healed != nil:
+		fn("medic", &event.Healed.Medic)
+	case event.Medic != nil:
+		fn("medic", &event.Medic.Medic)
+		optional("patient", event.Medic.Patient)
+	case event.Buff != nil:
+		fn("player", &event.Buff.Player)
+	case event.Food != nil:
+		fn("player", &event.Food.Player)
+	case event.Jarate != nil:
+		fn("attacker", &event.Jarate.Attacker)
+		fn("victim", &event.Jarate.Victim)
+	case event.ShieldBlock != nil:
+		fn("blocker", &event.ShieldBlock.Blocker)
+		fn("attacker", &event.ShieldBlock.Attacker)
+	case event.MVP != nil:
+		fn("player", &event.MVP.Player)
+	case event.PlayerLoadout != nil:
+		fn("player", &event.PlayerLoadout.Player)
+	case event.WeaponStats != nil:
+		fn("player", &event.WeaponStats.Player)
+	case event.PlayerSpawn != nil:
+		fn("player", &event.PlayerSpawn.Player)
+	case event.PlayerDisconnect != nil:
+		fn("player", &event.PlayerDisconnect.Player)
+	case event.ClassChange != nil:
+		fn("player", &event.ClassChange.Player)
+	}
+}
+
+// normalizeSteamIDs rewrites the SteamIDs of an event's players as
+// SteamID64s, so a player is the same whichever format a server sends. IDs
+// that do not parse are left for Validate and the store to reject.
+func normalizeSteamIDs(event *events.Event) {
+	forEachPlayer(event, func(_ string, p *events.Player) {
+		if id, err := steamid.Normalize(p.SteamID); err == nil {
+			p.SteamID = id
+		}
+	})
+}
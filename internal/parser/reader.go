@@ -0,0 +1,321 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/UDL-TF/UnitedStats/pkg/events"
+)
+
+// DefaultMaxLineSize is the longest line a Reader accepts by default
+const DefaultMaxLineSize = 16 << 20
+
+// ReaderConfig configures a Reader
+type ReaderConfig struct {
+	// MaxLineSize caps the length of a line (default DefaultMaxLineSize).
+	// Longer lines are reported as errors and skipped.
+	MaxLineSize int
+	// Workers is how many lines are decoded in parallel (default 1). Events
+	// are returned in input order either way.
+	Workers int
+	// Strict validates each event; events that fail are reported as
+	// LineErrors wrapping a *ValidationError.
+	Strict bool
+}
+
+// Record is an event read from a stream and where it was found
+type Record struct {
+	Event *events.Event
+	// Raw is the line the event was decoded from, without its line ending
+	Raw []byte
+	// Line is the 1-based line number
+	Line int
+	// Offset is the byte offset of the line in the (decompressed) stream
+	Offset int64
+}
+
+// LineError is a *ParseError or *ValidationError and the position of its line
+type LineError struct {
+	Line   int
+	Offset int64
+	Err    error
+}
+
+func (e *LineError) Error() string {
+	reason := e.Err.Error()
+	var parseErr *ParseError
+	if errors.As(e.Err, &parseErr) {
+		// The position replaces the line's text
+		reason = parseErr.Reason
+	}
+	return fmt.Sprintf("line %d (offset %d): %s", e.Line, e.Offset, reason)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// Reader reads newline-delimited JSON events, such as plugin log files or
+// ingest batches, from a stream that may be gzip-compressed. Lines that do not
+// parse (or, in strict mode, validate) are collected as LineErrors and
+// skipped; empty lines, comments and unknown event types are skipped silently.
+type Reader struct {
+	r           *bufio.Reader
+	gz          *gzip.Reader
+	maxLineSize int
+	strict      bool
+
+	line   int
+	offset int64
+	buf    []byte
+	errs   []*LineError
+
+	// Parallel decoding
+	results chan chan decoded
+	done    chan struct{}
+	stop    sync.Once
+	wg      sync.WaitGroup
+	readErr error
+}
+
+// rawLine is a line read from the stream, not yet decoded
+type rawLine struct {
+	data   []byte
+	line   int
+	offset int64
+	err    *ParseError
+}
+
+// decoded is the outcome of decoding a line
+type decoded struct {
+	record Record
+	err    *LineError
+	skip   bool
+}
+
+// NewReader reads events from in, which may be gzip-compressed
+func NewReader(in io.Reader, cfg ReaderConfig) (*Reader, error) {
+	if cfg.MaxLineSize <= 0 {
+		cfg.MaxLineSize = DefaultMaxLineSize
+	}
+
+	r := &Reader{
+		r:           bufio.NewReaderSize(in, 64<<10),
+		maxLineSize: cfg.MaxLineSize,
+		strict:      cfg.Strict,
+	}
+
+	// gzip streams start with 0x1f 0x8b
+	if prefix, err := r.r.Peek(2); err == nil && prefix[0] == 0x1f && prefix[1] == 0x8b {
+		gz, err := gzip.NewReader(r.r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open gzip stream: %w", err)
+		}
+		r.gz = gz
+		r.r = bufio.NewReaderSize(gz, 64<<10)
+	}
+
+	if cfg.Workers > 1 {
+		r.startWorkers(cfg.Workers)
+	}
+
+	return r, nil
+}
+
+// Next returns the next event, or io.EOF at the end of the stream. Lines that
+// do not parse do not stop the reader; see Errors. Any other error is from
+// reading the stream and ends it.
+func (r *Reader) Next() (Record, error) {
+	for {
+		var result decoded
+
+		if r.results == nil {
+			line, err := r.readLine()
+			if err != nil {
+				return Record{}, err
+			}
+			result = decodeLine(line, r.strict)
+			// The line's buffer is reused by the next read
+			result.record.Raw = append([]byte(nil), result.record.Raw...)
+		} else {
+			pending, ok := <-r.results
+			if !ok {
+				if r.readErr != nil {
+					return Record{}, r.readErr
+				}
+				return Record{}, io.EOF
+			}
+			result = <-pending
+		}
+
+		if result.err != nil {
+			r.errs = append(r.errs, result.err)
+			continue
+		}
+		if result.skip {
+			continue
+		}
+		return result.record, nil
+	}
+}
+
+// Errors returns the lines that failed so far, in input order
+func (r *Reader) Errors() []*LineError {
+	return r.errs
+}
+
+// Close stops the decoding workers and releases the gzip stream. It waits for
+// a read in progress, and does not close the underlying reader.
+func (r *Reader) Close() error {
+	if r.done != nil {
+		r.stop.Do(func() { close(r.done) })
+
+		// Unblock the reading goroutine, then wait for it and the workers
+		for pending := range r.results {
+			<-pending
+		}
+		r.wg.Wait()
+	}
+
+	if r.gz != nil {
+		return r.gz.Close()
+	}
+	return nil
+}
+
+// startWorkers decodes lines on a pool of goroutines. The reading goroutine
+// queues one result channel per line in input order, so Next receives the
+// results in order however the workers finish.
+func (r *Reader) startWorkers(workers int) {
+	r.results = make(chan chan decoded, workers*4)
+	r.done = make(chan struct{})
+	jobs := make(chan struct {
+		line   rawLine
+		result chan decoded
+	}, workers*4)
+
+	for i := 0; i < workers; i++ {
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			for job := range jobs {
+				job.result <- decodeLine(job.line, r.strict)
+			}
+		}()
+	}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		defer close(r.results)
+		defer close(jobs)
+
+		for {
+			line, err := r.readLine()
+			if err != nil {
+				if !errors.Is(err, io.EOF) {
+					r.readErr = err
+				}
+				return
+			}
+
+			// Each line gets its own buffer, since workers outlive the read
+			line.data = append([]byte(nil), line.data...)
+			result := make(chan decoded, 1)
+
+			select {
+			case r.results <- result:
+			case <-r.done:
+				return
+			}
+			jobs <- struct {
+				line   rawLine
+				result chan decoded
+			}{line, result}
+		}
+	}()
+}
+
+// readLine reads the next line. The returned data is only valid until the
+// next call.
+func (r *Reader) readLine() (rawLine, error) {
+	r.buf = r.buf[:0]
+	line := rawLine{line: r.line + 1, offset: r.offset}
+	tooLong := false
+
+	for {
+		chunk, err := r.r.ReadSlice('\n')
+		r.offset += int64(len(chunk))
+
+		if !tooLong {
+			if len(r.buf)+len(chunk) > r.maxLineSize+2 {
+				// Keep reading to the end of the line, without keeping it
+				tooLong = true
+				r.buf = r.buf[:0]
+			} else {
+				r.buf = append(r.buf, chunk...)
+			}
+		}
+
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return rawLine{}, fmt.Errorf("failed to read line %d: %w", line.line, err)
+		}
+		if errors.Is(err, io.EOF) && len(chunk) == 0 && len(r.buf) == 0 && !tooLong {
+			return rawLine{}, io.EOF
+		}
+		break
+	}
+
+	r.line++
+	line.data = bytes.TrimRight(r.buf, "\r\n")
+	if tooLong || len(line.data) > r.maxLineSize {
+		line.err = &ParseError{
+			Reason: fmt.Sprintf("line longer than %d bytes", r.maxLineSize),
+		}
+		line.data = nil
+		return line, nil
+	}
+
+	return line, nil
+}
+
+// decodeLine decodes one line into a record, an error, or nothing for lines
+// without an event
+func decodeLine(line rawLine, strict bool) decoded {
+	if line.err != nil {
+		return decoded{err: &LineError{Line: line.line, Offset: line.offset, Err: line.err}}
+	}
+
+	trimmed := bytes.TrimSpace(line.data)
+	if len(trimmed) == 0 || trimmed[0] == '#' {
+		return decoded{skip: true}
+	}
+
+	decode := Decode
+	if strict {
+		decode = DecodeStrict
+	}
+
+	event, err := decode(trimmed)
+	if err != nil {
+		return decoded{err: &LineError{Line: line.line, Offset: line.offset, Err: err}}
+	}
+	if event == nil {
+		return decoded{skip: true}
+	}
+
+	return decoded{record: Record{
+		Event:  event,
+		Raw:    line.data,
+		Line:   line.line,
+		Offset: line.offset,
+	}}
+}
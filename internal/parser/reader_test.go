@@ -0,0 +1,223 @@
+package parser
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+const (
+	readerMatchStart = `{"timestamp":"2024-02-01T12:00:00Z","gamemode":"default","server_ip":"10.0.0.1","event_type":"match_start","map":"cp_badlands","schema_version":2}`
+	readerMatchEnd   = `{"timestamp":"2024-02-01T12:30:00Z","gamemode":"default","server_ip":"10.0.0.1","event_type":"match_end","map":"cp_badlands","schema_version":2}`
+)
+
+// readAll reads every record from r, failing the test on read errors
+func readAll(t *testing.T, r *Reader) []Record {
+	t.Helper()
+
+	var records []Record
+	for {
+		record, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return records
+		}
+		if err != nil {
+			t.Fatalf("Next() error = %v", err)
+		}
+		records = append(records, record)
+	}
+}
+
+// gzipped compresses data
+func gzipped(t *testing.T, data string) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte(data)); err != nil {
+		t.Fatalf("gzip write error = %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("gzip close error = %v", err)
+	}
+	return buf.String()
+}
+
+// TestReader tests the positions of events and errors read from a stream
+func TestReader(t *testing.T) {
+	badKill := `{"event_type":"kill","schema_version":2,"crit":"yes"}`
+	// A match_start padded past bufio's default 64KiB token limit
+	longLine := readerMatchStart[:len(readerMatchStart)-1] + `,"padding":"` + strings.Repeat("x", 100<<10) + `"}`
+
+	tests := []struct {
+		name        string
+		input       string
+		maxLineSize int
+		strict      bool
+		wantLines   []int
+		wantOffsets []int64
+		wantErrors  []int
+	}{
+		{
+			name:        "Events",
+			input:       readerMatchStart + "\n" + readerMatchEnd + "\n",
+			wantLines:   []int{1, 2},
+			wantOffsets: []int64{0, int64(len(readerMatchStart) + 1)},
+		},
+		{
+			name:        "No trailing newline",
+			input:       readerMatchStart + "\n" + readerMatchEnd,
+			wantLines:   []int{1, 2},
+			wantOffsets: []int64{0, int64(len(readerMatchStart) + 1)},
+		},
+		{
+			name:        "CRLF line endings",
+			input:       readerMatchStart + "\r\n" + readerMatchEnd + "\r\n",
+			wantLines:   []int{1, 2},
+			wantOffsets: []int64{0, int64(len(readerMatchStart) + 2)},
+		},
+		{
+			name:        "Skipped lines",
+			input:       "# comment\n\n" + `{"event_type":"unknown"}` + "\n" + readerMatchStart + "\n",
+			wantLines:   []int{4},
+			wantOffsets: []int64{36},
+		},
+		{
+			name:        "Errors",
+			input:       "not json\n" + readerMatchStart + "\n" + badKill + "\n" + readerMatchEnd + "\n",
+			wantLines:   []int{2, 4},
+			wantOffsets: []int64{9, int64(9 + len(readerMatchStart) + 1 + len(badKill) + 1)},
+			wantErrors:  []int{1, 3},
+		},
+		{
+			name:        "Long line",
+			input:       longLine + "\n" + readerMatchEnd + "\n",
+			wantLines:   []int{1, 2},
+			wantOffsets: []int64{0, int64(len(longLine) + 1)},
+		},
+		{
+			name:        "Line too long",
+			input:       longLine + "\n" + readerMatchEnd + "\n",
+			maxLineSize: 64 << 10,
+			wantLines:   []int{2},
+			wantOffsets: []int64{int64(len(longLine) + 1)},
+			wantErrors:  []int{1},
+		},
+		{
+			name:        "Gzip",
+			input:       gzipped(t, readerMatchStart+"\n"+readerMatchEnd+"\n"),
+			wantLines:   []int{1, 2},
+			wantOffsets: []int64{0, int64(len(readerMatchStart) + 1)},
+		},
+		{
+			name:        "Strict",
+			input:       readerMatchStart + "\n" + `{"timestamp":"2024-02-01T12:00:00Z","event_type":"match_start","map":""}` + "\n",
+			strict:      true,
+			wantLines:   []int{1},
+			wantOffsets: []int64{0},
+			wantErrors:  []int{2},
+		},
+		{
+			name:  "Empty",
+			input: "",
+		},
+	}
+
+	for _, tt := range tests {
+		for _, workers := range []int{1, 4} {
+			name := tt.name
+			if workers > 1 {
+				name += " in parallel"
+			}
+
+			t.Run(name, func(t *testing.T) {
+				r, err := NewReader(strings.NewReader(tt.input), ReaderConfig{MaxLineSize: tt.maxLineSize, Workers: workers, Strict: tt.strict})
+				if err != nil {
+					t.Fatalf("NewReader() error = %v", err)
+				}
+				defer r.Close()
+
+				records := readAll(t, r)
+				if len(records) != len(tt.wantLines) {
+					t.Fatalf("read %d events, want %d", len(records), len(tt.wantLines))
+				}
+				for i, record := range records {
+					if record.Line != tt.wantLines[i] || record.Offset != tt.wantOffsets[i] {
+						t.Errorf("event %d at line %d offset %d, want line %d offset %d",
+							i, record.Line, record.Offset, tt.wantLines[i], tt.wantOffsets[i])
+					}
+					if bytes.ContainsAny(record.Raw, "\r\n") {
+						t.Errorf("event %d raw line %q has a line ending", i, record.Raw)
+					}
+				}
+
+				errs := r.Errors()
+				if len(errs) != len(tt.wantErrors) {
+					t.Fatalf("Errors() = %v, want errors on lines %v", errs, tt.wantErrors)
+				}
+				for i, lineErr := range errs {
+					if lineErr.Line != tt.wantErrors[i] {
+						t.Errorf("error %d on line %d, want line %d", i, lineErr.Line, tt.wantErrors[i])
+					}
+					var parseErr *ParseError
+					var validationErr *ValidationError
+					if !errors.As(lineErr, &parseErr) && !errors.As(lineErr, &validationErr) {
+						t.Errorf("error %d wraps neither a ParseError nor a ValidationError", i)
+					}
+				}
+			})
+		}
+	}
+}
+
+// TestReaderParallelOrder tests that parallel decoding returns the fixtures
+// in the same order as sequential decoding
+func TestReaderParallelOrder(t *testing.T) {
+	data, err := os.ReadFile("../../test/fixtures/sample_logs_json.txt")
+	if err != nil {
+		t.Skipf("Skipping fixture test: %v", err)
+	}
+	// Repeat the fixtures so the workers have a backlog
+	data = bytes.Repeat(data, 20)
+
+	read := func(workers int) []Record {
+		r, err := NewReader(bytes.NewReader(data), ReaderConfig{Workers: workers})
+		if err != nil {
+			t.Fatalf("NewReader() error = %v", err)
+		}
+		defer r.Close()
+		return readAll(t, r)
+	}
+
+	want := read(1)
+	got := read(8)
+	if len(got) != len(want) {
+		t.Fatalf("read %d events in parallel, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Line != want[i].Line || got[i].Offset != want[i].Offset || got[i].Event.Type != want[i].Event.Type {
+			t.Fatalf("event %d is line %d (%s), want line %d (%s)",
+				i, got[i].Line, got[i].Event.Type, want[i].Line, want[i].Event.Type)
+		}
+	}
+}
+
+// TestReaderClose tests closing a parallel reader before the end of the stream
+func TestReaderClose(t *testing.T) {
+	input := strings.Repeat(readerMatchStart+"\n", 1000)
+
+	r, err := NewReader(strings.NewReader(input), ReaderConfig{Workers: 4})
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+	if _, err := r.Next(); err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// CurrentSchemaVersion is the payload schema the pkg/events structs describe.
+// Plugins send it as schema_version; payloads without one are version 1.
+const CurrentSchemaVersion = 2
+
+// upcaster migrates the top-level fields of a payload from one schema version
+// to the next, in place
+type upcaster func(fields map[string]json.RawMessage) error
+
+// upcasters maps each old schema version to the upcaster that lifts it to the
+// next version. Changing a field in pkg/events means bumping
+// CurrentSchemaVersion and adding the upcaster for the previous version here.
+var upcasters = map[int]upcaster{
+	1: upcastV1,
+}
+
+// Compatibility statuses of a schema version
+const (
+	// CompatibilityCurrent payloads match the current structs
+	CompatibilityCurrent = "current"
+	// CompatibilityUpcast payloads are migrated to the current structs
+	CompatibilityUpcast = "upcast"
+	// CompatibilityUnsupported payloads are rejected
+	CompatibilityUnsupported = "unsupported"
+)
+
+// Compatibility reports how the parser handles payloads of a schema version
+func Compatibility(schemaVersion int) string {
+	switch {
+	case schemaVersion == CurrentSchemaVersion:
+		return CompatibilityCurrent
+	case schemaVersion > 0 && schemaVersion < CurrentSchemaVersion && canUpcast(schemaVersion):
+		return CompatibilityUpcast
+	default:
+		return CompatibilityUnsupported
+	}
+}
+
+// canUpcast reports whether every step from a version to the current one has
+// an upcaster
+func canUpcast(version int) bool {
+	for v := version; v < CurrentSchemaVersion; v++ {
+		if upcasters[v] == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// upcast migrates a payload of an older schema version to the current one
+func upcast(data []byte, version int) ([]byte, error) {
+	if Compatibility(version) == CompatibilityUnsupported {
+		return nil, &ParseError{Line: string(data), Reason: fmt.Sprintf("unsupported schema version %d", version)}
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, &ParseError{Line: string(data), Reason: fmt.Sprintf("invalid JSON: %v", err)}
+	}
+
+	for v := version; v < CurrentSchemaVersion; v++ {
+		if err := upcasters[v](fields); err != nil {
+			return nil, &ParseError{Line: string(data), Reason: fmt.Sprintf("failed to upcast schema version %d: %v", v, err)}
+		}
+	}
+
+	upcast, err := json.Marshal(fields)
+	if err != nil {
+		return nil, &ParseError{Line: string(data), Reason: fmt.Sprintf("failed to encode upcast payload: %v", err)}
+	}
+
+	return upcast, nil
+}
+
+// upcastV1 migrates payloads of plugins before 2.1.0, which sent timestamps
+// without a UTC offset. They are read as UTC; the collector's clock skew
+// correction absorbs the server's actual offset.
+func upcastV1(fields map[string]json.RawMessage) error {
+	var timestamp string
+	if err := json.Unmarshal(fields["timestamp"], &timestamp); err != nil {
+		// Leave missing or malformed timestamps to the event parser
+		return nil
+	}
+
+	if _, err := time.Parse(time.RFC3339Nano, timestamp); err == nil {
+		return nil
+	}
+
+	parsed, err := time.Parse("2006-01-02T15:04:05", timestamp)
+	if err != nil {
+		return nil
+	}
+
+	fields["timestamp"], err = json.Marshal(parsed.UTC().Format(time.RFC3339))
+	return err
+}
@@ -0,0 +1,93 @@
+package parser
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestUpcast tests that older payloads are migrated to the current structs
+func TestUpcast(t *testing.T) {
+	tests := []struct {
+		name              string
+		line              string
+		wantErr           bool
+		wantTimestamp     time.Time
+		wantSchemaVersion int
+		wantPluginVersion string
+	}{
+		{
+			name:              "Version 1 without offset",
+			line:              `{"timestamp":"2024-02-01T12:00:00","gamemode":"default","server_ip":"10.0.0.1","event_type":"match_start","map":"cp_badlands"}`,
+			wantTimestamp:     time.Date(2024, 2, 1, 12, 0, 0, 0, time.UTC),
+			wantSchemaVersion: 1,
+		},
+		{
+			name:              "Version 1 with offset",
+			line:              `{"timestamp":"2024-02-01T13:00:00+01:00","gamemode":"default","server_ip":"10.0.0.1","event_type":"match_start","map":"cp_badlands"}`,
+			wantTimestamp:     time.Date(2024, 2, 1, 12, 0, 0, 0, time.UTC),
+			wantSchemaVersion: 1,
+		},
+		{
+			name:              "Current version",
+			line:              `{"timestamp":"2024-02-01T12:00:00Z","gamemode":"default","server_ip":"10.0.0.1","event_type":"match_start","map":"cp_badlands","schema_version":2,"plugin_version":"2.1.0"}`,
+			wantTimestamp:     time.Date(2024, 2, 1, 12, 0, 0, 0, time.UTC),
+			wantSchemaVersion: 2,
+			wantPluginVersion: "2.1.0",
+		},
+		{
+			name:    "Newer version",
+			line:    `{"timestamp":"2024-02-01T12:00:00Z","gamemode":"default","server_ip":"10.0.0.1","event_type":"match_start","map":"cp_badlands","schema_version":3}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := ParseLine(tt.line)
+			if tt.wantErr {
+				var parseErr *ParseError
+				if !errors.As(err, &parseErr) {
+					t.Fatalf("ParseLine() error = %v, want ParseError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseLine() error = %v", err)
+			}
+
+			base := event.Base()
+			if !base.Timestamp.Equal(tt.wantTimestamp) {
+				t.Errorf("Timestamp = %v, want %v", base.Timestamp, tt.wantTimestamp)
+			}
+			if base.SchemaVersion != tt.wantSchemaVersion {
+				t.Errorf("SchemaVersion = %d, want %d", base.SchemaVersion, tt.wantSchemaVersion)
+			}
+			if base.PluginVersion != tt.wantPluginVersion {
+				t.Errorf("PluginVersion = %q, want %q", base.PluginVersion, tt.wantPluginVersion)
+			}
+			if event.MatchStart.Map != "cp_badlands" {
+				t.Errorf("Map = %q, want cp_badlands", event.MatchStart.Map)
+			}
+		})
+	}
+}
+
+// TestCompatibility tests the compatibility status of schema versions
+func TestCompatibility(t *testing.T) {
+	tests := []struct {
+		version int
+		want    string
+	}{
+		{version: 0, want: CompatibilityUnsupported},
+		{version: 1, want: CompatibilityUpcast},
+		{version: CurrentSchemaVersion, want: CompatibilityCurrent},
+		{version: CurrentSchemaVersion + 1, want: CompatibilityUnsupported},
+	}
+
+	for _, tt := range tests {
+		if got := Compatibility(tt.version); got != tt.want {
+			t.Errorf("Compatibility(%d) = %q, want %q", tt.version, got, tt.want)
+		}
+	}
+}
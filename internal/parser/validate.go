@@ -0,0 +1,170 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/UDL-TF/UnitedStats/pkg/events"
+	"github.com/UDL-TF/UnitedStats/pkg/steamid"
+)
+
+// Validation
+//
+// Decode only checks that a payload fits its struct, so a kill with an empty
+// steam_id, team 7 or an unknown class decodes fine. Validate checks the
+// fields the processor relies on: players have a SteamID and are on RED or
+// BLU, classes are TF2 classes, timestamps are plausible, and events have the
+// fields they are recorded by (a kill's weapon, a match's map). Validation is
+// opt-in; use DecodeStrict or ReaderConfig.Strict.
+
+// minTimestamp is the earliest plausible event time, TF2's release
+var minTimestamp = time.Date(2007, 10, 10, 0, 0, 0, 0, time.UTC)
+
+// maxTimestampAhead is how far past now an event time may be. Server clocks
+// are corrected by the collector, so this only catches nonsense.
+const maxTimestampAhead = 24 * time.Hour
+
+// validClasses are the class names the plugin sends
+var validClasses = map[string]bool{
+	"scout":    true,
+	"soldier":  true,
+	"pyro":     true,
+	"demoman":  true,
+	"heavy":    true,
+	"engineer": true,
+	"medic":    true,
+	"sniper":   true,
+	"spy":      true,
+}
+
+// Violation is a field that failed validation
+type Violation struct {
+	Field  string
+	Reason string
+}
+
+// ValidationError lists every field of an event that failed validation
+type ValidationError struct {
+	EventType  events.EventType
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	fields := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		fields[i] = v.Field + ": " + v.Reason
+	}
+	return fmt.Sprintf("invalid %s event: %s", e.EventType, strings.Join(fields, "; "))
+}
+
+// DecodeStrict decodes a payload like Decode and validates the event
+func DecodeStrict(data []byte) (*events.Event, error) {
+	event, err := Decode(data)
+	if err != nil || event == nil {
+		return event, err
+	}
+
+	if err := Validate(event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// Validate checks the fields of a decoded event. It returns a
+// *ValidationError listing every violation, or nil.
+func Validate(event *events.Event) error {
+	v := &validator{now: time.Now()}
+
+	base := event.Base()
+	if base == nil {
+		v.fail("event_type", "event has no body")
+	} else {
+		v.timestamp("timestamp", base.Timestamp)
+	}
+
+	forEachPlayer(event, v.player)
+
+	switch {
+	case event.Kill != nil:
+		v.required("weapon.name", event.Kill.Weapon.Name)
+	case event.Airshot != nil:
+		v.required("weapon_type", event.Airshot.WeaponType)
+	case event.MatchStart != nil:
+		v.required("map", event.MatchStart.Map)
+	case event.MatchEnd != nil:
+		e := event.MatchEnd
+		if e.WinnerTeam != 0 && e.WinnerTeam != 2 && e.WinnerTeam != 3 {
+			v.fail("winner_team", fmt.Sprintf("must be 0 (tie), 2 (RED) or 3 (BLU), got %d", e.WinnerTeam))
+		}
+		if e.Duration < 0 {
+			v.fail("duration", fmt.Sprintf("must not be negative, got %d", e.Duration))
+		}
+	case event.MVP != nil:
+		if p := event.MVP.Position; p < 1 || p > 3 {
+			v.fail("position", fmt.Sprintf("must be 1, 2 or 3, got %d", p))
+		}
+	case event.ClassChange != nil:
+		e := event.ClassChange
+		v.class("old_class", e.OldClass)
+		v.required("new_class", e.NewClass)
+		v.class("new_class", e.NewClass)
+	}
+
+	if len(v.violations) == 0 {
+		return nil
+	}
+	return &ValidationError{EventType: event.Type, Violations: v.violations}
+}
+
+// validator collects the violations of an event
+type validator struct {
+	now        time.Time
+	violations []Violation
+}
+
+// fail records a violation
+func (v *validator) fail(field, reason string) {
+	v.violations = append(v.violations, Violation{Field: field, Reason: reason})
+}
+
+// required checks that a string field is set
+func (v *validator) required(field, value string) {
+	if value == "" {
+		v.fail(field, "required")
+	}
+}
+
+// timestamp checks that an event time is set and plausible
+func (v *validator) timestamp(field string, t time.Time) {
+	switch {
+	case t.IsZero():
+		v.fail(field, "required")
+	case t.Before(minTimestamp):
+		v.fail(field, fmt.Sprintf("before %s", minTimestamp.Format(time.DateOnly)))
+	case t.After(v.now.Add(maxTimestampAhead)):
+		v.fail(field, fmt.Sprintf("more than %s in the future", maxTimestampAhead))
+	}
+}
+
+// class checks that a class, if set, is a TF2 class
+func (v *validator) class(field, class string) {
+	if class != "" && !validClasses[class] {
+		v.fail(field, fmt.Sprintf("unknown class %q", class))
+	}
+}
+
+// player checks a player the event names
+func (v *validator) player(field string, p *events.Player) {
+	if p.SteamID == "" {
+		v.fail(field+".steam_id", "required")
+	} else if _, err := steamid.Parse(p.SteamID); err != nil {
+		v.fail(field+".steam_id", err.Error())
+	}
+
+	if p.Team != 2 && p.Team != 3 {
+		v.fail(field+".team", fmt.Sprintf("must be 2 (RED) or 3 (BLU), got %d", p.Team))
+	}
+
+	v.class(field+".class", p.Class)
+}
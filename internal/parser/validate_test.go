@@ -0,0 +1,102 @@
+package parser
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// TestValidate tests that strict decoding lists every violated field
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		line       string
+		wantFields []string
+	}{
+		{
+			name: "Valid kill",
+			line: `{"timestamp":"2024-02-01T12:00:00Z","server_ip":"10.0.0.1","event_type":"kill","schema_version":2,"killer":{"steam_id":"76561198012345678","name":"a","team":2,"class":"soldier"},"victim":{"steam_id":"76561198087654321","name":"b","team":3},"weapon":{"name":"tf_projectile_rocket"}}`,
+		},
+		{
+			name: "SteamID3",
+			line: `{"timestamp":"2024-02-01T12:00:00Z","server_ip":"10.0.0.1","event_type":"player_spawn","schema_version":2,"player":{"steam_id":"[U:1:12345]","name":"a","team":3}}`,
+		},
+		{
+			name:       "Invalid kill",
+			line:       `{"server_ip":"10.0.0.1","event_type":"kill","schema_version":2,"killer":{"steam_id":"","name":"a","team":7,"class":"wizard"},"victim":{"steam_id":"STEAM_0:2:1","name":"b","team":3},"assister":{"steam_id":"76561198012345678","team":0},"weapon":{"name":"tf_projectile_rocket"}}`,
+			wantFields: []string{"timestamp", "killer.steam_id", "killer.team", "killer.class", "victim.steam_id", "assister.team"},
+		},
+		{
+			name:       "Timestamp too old",
+			line:       `{"timestamp":"2001-01-01T00:00:00Z","event_type":"match_start","schema_version":2,"map":"cp_badlands"}`,
+			wantFields: []string{"timestamp"},
+		},
+		{
+			name:       "Timestamp in the future",
+			line:       `{"timestamp":"2999-01-01T00:00:00Z","event_type":"match_start","schema_version":2,"map":"cp_badlands"}`,
+			wantFields: []string{"timestamp"},
+		},
+		{
+			name:       "Match end",
+			line:       `{"timestamp":"2024-02-01T12:00:00Z","event_type":"match_end","schema_version":2,"winner_team":5,"duration":-1}`,
+			wantFields: []string{"winner_team", "duration"},
+		},
+		{
+			name:       "Class change",
+			line:       `{"timestamp":"2024-02-01T12:00:00Z","event_type":"class_change","schema_version":2,"player":{"steam_id":"76561198012345678","name":"a","team":2},"old_class":"civilian","new_class":""}`,
+			wantFields: []string{"old_class", "new_class"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := DecodeStrict([]byte(tt.line))
+			if len(tt.wantFields) == 0 {
+				if err != nil {
+					t.Fatalf("DecodeStrict() error = %v", err)
+				}
+				if event == nil {
+					t.Fatal("DecodeStrict() returned no event")
+				}
+				return
+			}
+
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("DecodeStrict() error = %v, want ValidationError", err)
+			}
+			if event != nil {
+				t.Errorf("DecodeStrict() = %+v, want no event", event)
+			}
+
+			fields := make([]string, len(validationErr.Violations))
+			for i, v := range validationErr.Violations {
+				fields[i] = v.Field
+			}
+			if !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("violated fields = %v, want %v (%v)", fields, tt.wantFields, err)
+			}
+		})
+	}
+}
+
+// TestValidateFixtures tests that the plugin fixtures pass strict validation
+func TestValidateFixtures(t *testing.T) {
+	file, err := os.Open("../../test/fixtures/sample_logs_json.txt")
+	if err != nil {
+		t.Skipf("Skipping fixture test: %v", err)
+	}
+	defer file.Close()
+
+	reader, err := NewReader(file, ReaderConfig{Strict: true})
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+	defer reader.Close()
+
+	readAll(t, reader)
+	for _, lineErr := range reader.Errors() {
+		t.Errorf("%v", lineErr)
+	}
+}
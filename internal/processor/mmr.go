@@ -6,13 +6,14 @@ import (
 
 	"github.com/ThreeDotsLabs/watermill"
 	"github.com/UDL-TF/UnitedStats/internal/mmr"
+	"github.com/UDL-TF/UnitedStats/internal/store"
 	"github.com/UDL-TF/UnitedStats/pkg/events"
 )
 
 // processMatchEndEvent processes a match end event and calculates MMR
-func (p *Processor) processMatchEndEvent(ctx context.Context, matchEnd *events.MatchEndEvent) error {
+func (p *Processor) processMatchEndEvent(ctx context.Context, tx *store.Store, matchEnd *events.MatchEndEvent) error {
 	// Get active match
-	match, err := p.store.GetOrCreateActiveMatch(ctx, matchEnd.ServerIP, "", matchEnd.Gamemode)
+	match, err := tx.GetOrCreateActiveMatch(ctx, matchEnd.ServerIP, "", matchEnd.Gamemode)
 	if err != nil {
 		return err
 	}
@@ -25,12 +26,12 @@ func (p *Processor) processMatchEndEvent(ctx context.Context, matchEnd *events.M
 	}
 
 	// Get players from both teams
-	winnerIDs, winnerMMRs, err := p.store.GetMatchTeamPlayers(ctx, match.ID, winnerTeam)
+	winnerIDs, winnerMMRs, err := tx.GetMatchTeamPlayers(ctx, match.ID, winnerTeam)
 	if err != nil {
 		return fmt.Errorf("failed to get winner team: %w", err)
 	}
 
-	loserIDs, loserMMRs, err := p.store.GetMatchTeamPlayers(ctx, match.ID, loserTeam)
+	loserIDs, loserMMRs, err := tx.GetMatchTeamPlayers(ctx, match.ID, loserTeam)
 	if err != nil {
 		return fmt.Errorf("failed to get loser team: %w", err)
 	}
@@ -38,7 +39,7 @@ func (p *Processor) processMatchEndEvent(ctx context.Context, matchEnd *events.M
 	// Skip MMR calculation if teams are empty
 	if len(winnerIDs) == 0 || len(loserIDs) == 0 {
 		p.logger.Info("Skipping MMR calculation - empty teams", nil)
-		return p.store.EndMatch(ctx, match.ID, winnerTeam, 0, 0)
+		return tx.EndMatch(ctx, match.ID, winnerTeam, 0, 0)
 	}
 
 	// Calculate MMR changes
@@ -46,40 +47,34 @@ func (p *Processor) processMatchEndEvent(ctx context.Context, matchEnd *events.M
 	winnerChanges, loserChanges := calc.CalculateTeamMatch(winnerMMRs, loserMMRs)
 
 	// Update winner MMRs
-	if err := p.updateTeamMMR(ctx, match.ID, winnerIDs, winnerMMRs, winnerChanges, "winner"); err != nil {
+	if err := p.updateTeamMMR(ctx, tx, match.ID, winnerIDs, winnerMMRs, winnerChanges, "winner"); err != nil {
 		return err
 	}
 
 	// Update loser MMRs
-	if err := p.updateTeamMMR(ctx, match.ID, loserIDs, loserMMRs, loserChanges, "loser"); err != nil {
+	if err := p.updateTeamMMR(ctx, tx, match.ID, loserIDs, loserMMRs, loserChanges, "loser"); err != nil {
 		return err
 	}
 
 	// End the match
-	return p.store.EndMatch(ctx, match.ID, winnerTeam, 0, 0)
+	return tx.EndMatch(ctx, match.ID, winnerTeam, 0, 0)
 }
 
-// updateTeamMMR updates MMR for all players on a team
-func (p *Processor) updateTeamMMR(ctx context.Context, matchID int64, playerIDs []int64, oldMMRs, changes []int, team string) error {
+// updateTeamMMR updates MMR for all players on a team. Any failure fails
+// the match end, so no player's MMR changes without the others.
+func (p *Processor) updateTeamMMR(ctx context.Context, tx *store.Store, matchID int64, playerIDs []int64, oldMMRs, changes []int, team string) error {
 	for i, playerID := range playerIDs {
 		oldMMR := oldMMRs[i]
 		newMMR := oldMMR + changes[i]
 
 		// Update player MMR
-		if err := p.store.UpdatePlayerMMR(ctx, playerID, newMMR); err != nil {
-			p.logger.Error("Failed to update player MMR", err, watermill.LogFields{
-				"team":      team,
-				"player_id": playerID,
-			})
-			continue
+		if err := tx.UpdatePlayerMMR(ctx, playerID, newMMR); err != nil {
+			return fmt.Errorf("failed to update %s MMR of player %d: %w", team, playerID, err)
 		}
 
 		// Update match_player MMR tracking
-		if err := p.store.UpdateMatchPlayerMMR(ctx, matchID, playerID, oldMMR, newMMR); err != nil {
-			p.logger.Error("Failed to update match player MMR", err, watermill.LogFields{
-				"team":      team,
-				"player_id": playerID,
-			})
+		if err := tx.UpdateMatchPlayerMMR(ctx, matchID, playerID, oldMMR, newMMR); err != nil {
+			return fmt.Errorf("failed to update %s match MMR of player %d: %w", team, playerID, err)
 		}
 
 		p.logger.Debug("Team MMR updated", watermill.LogFields{
@@ -3,100 +3,124 @@ package processor
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/ThreeDotsLabs/watermill"
 	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/UDL-TF/UnitedStats/internal/parser"
 	"github.com/UDL-TF/UnitedStats/internal/store"
 	"github.com/UDL-TF/UnitedStats/pkg/events"
+	"github.com/UDL-TF/UnitedStats/pkg/steamid"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
+// invalidTopic receives payloads that failed validation in the collector
+const invalidTopic = "events.invalid"
+
 // Processor consumes events from the message queue and stores them in PostgreSQL
 type Processor struct {
 	store      *store.Store
 	subscriber message.Subscriber
+	publisher  message.Publisher
 	logger     watermill.LoggerAdapter
+
+	retry          RetryConfig
+	poison         poisonStore
+	handlerTimeout time.Duration
+	drainTimeout   time.Duration
+	throttle       int64
+	metrics        prometheus.Registerer
+	reorderWindow  time.Duration
+	maxPending     int
 }
 
 // Config holds processor configuration
 type Config struct {
 	Store      *store.Store
 	Subscriber message.Subscriber
-	Logger     watermill.LoggerAdapter
+	// Publisher announces quarantined messages on PoisonTopic (optional)
+	Publisher message.Publisher
+	Logger    watermill.LoggerAdapter
+
+	Retry RetryConfig
+
+	// HandlerTimeout cancels an attempt that takes longer (default 30s)
+	HandlerTimeout time.Duration
+	// DrainTimeout is how long messages in flight may take to finish after
+	// Start's context is cancelled (default 30s)
+	DrainTimeout time.Duration
+	// Throttle limits the messages processed per second across all topics
+	// (default unlimited)
+	Throttle int64
+	// Metrics registers Prometheus metrics for the handlers (optional)
+	Metrics prometheus.Registerer
+
+	// ReorderWindow is how long an event waits for earlier events of its
+	// server, so each server's events are processed in timestamp order
+	// (default 0, events are processed as they arrive). Buffered events are
+	// acknowledged before they are processed and are lost if the processor
+	// crashes; see the sequencer.
+	ReorderWindow time.Duration
+	// MaxPending caps the events waiting in reorder windows; intake blocks
+	// while it is reached (default 10000)
+	MaxPending int
 }
 
 // New creates a new processor
 func New(cfg Config) *Processor {
+	if cfg.HandlerTimeout <= 0 {
+		cfg.HandlerTimeout = 30 * time.Second
+	}
+	if cfg.DrainTimeout <= 0 {
+		cfg.DrainTimeout = 30 * time.Second
+	}
+	if cfg.MaxPending <= 0 {
+		cfg.MaxPending = 10000
+	}
+
 	return &Processor{
 		store:      cfg.Store,
 		subscriber: cfg.Subscriber,
+		publisher:  cfg.Publisher,
 		logger:     cfg.Logger,
+		retry:      cfg.Retry.withDefaults(),
+		poison:     cfg.Store,
+
+		handlerTimeout: cfg.HandlerTimeout,
+		drainTimeout:   cfg.DrainTimeout,
+		throttle:       cfg.Throttle,
+		metrics:        cfg.Metrics,
+		reorderWindow:  cfg.ReorderWindow,
+		maxPending:     cfg.MaxPending,
 	}
 }
 
-// Start starts processing events
-func (p *Processor) Start(ctx context.Context) error {
-	// Subscribe to all event topics
-	eventTypes := []string{
-		"kill", "airshot", "deflect", "stun", "jarate", "shield_blocked",
-		"rocket_jump", "sticky_jump", "rocket_jump_kill", "sticky_jump_kill",
-		"teleport", "teleport_used",
-		"built_object", "killed_object",
-		"healed", "uber_deployed", "uber_dropped", "defended_medic",
-		"buff_deployed", "sandvich", "dalokohs", "steak",
-		"match_start", "match_end", "round_start", "round_end",
-		"mvp1", "mvp2", "mvp3",
-		"player_loadout", "weapon_stats", "class_change",
-	}
+// decodedEventKey is the message context key of the event decoded from the
+// message's payload
+type decodedEventKey struct{}
 
-	for _, eventType := range eventTypes {
-		topic := fmt.Sprintf("events.%s", eventType)
-		messages, err := p.subscriber.Subscribe(ctx, topic)
-		if err != nil {
-			return fmt.Errorf("failed to subscribe to %s: %w", topic, err)
-		}
-
-		// Start handler for this topic
-		go p.handleMessages(ctx, messages)
+// decodeEvent decodes the event in a message's payload. The event is kept on
+// the message's context, so ordering and processing decode the payload once.
+func decodeEvent(msg *message.Message) (*events.Event, error) {
+	if event, ok := msg.Context().Value(decodedEventKey{}).(*events.Event); ok {
+		return event, nil
 	}
 
-	p.logger.Info("Event processor started", watermill.LogFields{
-		"event_types": len(eventTypes),
-	})
-
-	// Wait for context cancellation
-	<-ctx.Done()
-	return nil
-}
-
-// handleMessages processes messages for a specific event type
-func (p *Processor) handleMessages(ctx context.Context, messages <-chan *message.Message) {
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case msg := <-messages:
-			if msg == nil {
-				return
-			}
-
-			if err := p.processMessage(ctx, msg); err != nil {
-				p.logger.Error("Failed to process message", err, watermill.LogFields{
-					"message_id": msg.UUID,
-				})
-				msg.Nack()
-			} else {
-				msg.Ack()
-			}
-		}
+	event, err := parser.Decode(msg.Payload)
+	if err != nil {
+		return nil, err
 	}
+
+	msg.SetContext(context.WithValue(msg.Context(), decodedEventKey{}, event))
+	return event, nil
 }
 
 // processMessage processes a single message
 func (p *Processor) processMessage(ctx context.Context, msg *message.Message) error {
 	// Parse the event
-	event, err := parser.ParseLine(string(msg.Payload))
+	event, err := decodeEvent(msg)
 	if err != nil {
 		return fmt.Errorf("failed to parse event: %w", err)
 	}
@@ -106,38 +130,111 @@ func (p *Processor) processMessage(ctx context.Context, msg *message.Message) er
 		return nil
 	}
 
-	// Store raw event first
-	eventID, err := p.storeRawEvent(ctx, event, msg.Payload)
-	if err != nil {
-		return fmt.Errorf("failed to store raw event: %w", err)
+	// The collector corrects the server's clock skew, which keeps events
+	// inside their match windows
+	if corrected := msg.Metadata.Get("corrected_timestamp"); corrected != "" {
+		timestamp, err := time.Parse(time.RFC3339Nano, corrected)
+		if err != nil {
+			return fmt.Errorf("failed to parse corrected timestamp: %w", err)
+		}
+		event.Base().Timestamp = timestamp
+	}
+
+	// Bots and players Steam has not assigned an ID yet have no account to
+	// record stats for. The event is skipped rather than quarantined.
+	if role := anonymousPlayer(event); role != "" {
+		p.logger.Debug("Skipping event of a player without a SteamID", watermill.LogFields{
+			"event_type": event.Type,
+			"player":     role,
+		})
+		return nil
 	}
 
-	// Process based on event type
-	if err := p.processTypedEvent(ctx, event, eventID); err != nil {
-		return fmt.Errorf("failed to process typed event: %w", err)
+	// Everything an event changes commits or rolls back together, so a
+	// failed attempt leaves nothing behind for the next one to count twice
+	var eventID int64
+	var processed bool
+	err = p.store.InTx(ctx, func(tx *store.Store) error {
+		var err error
+		eventID, processed, err = p.storeRawEvent(ctx, tx, event, msg.Payload)
+		if err != nil {
+			return fmt.Errorf("failed to store raw event: %w", err)
+		}
+
+		if processed {
+			return nil
+		}
+
+		// Process based on event type
+		if err := p.processTypedEvent(ctx, tx, event, eventID); err != nil {
+			return fmt.Errorf("failed to process typed event: %w", err)
+		}
+
+		// Mark event as processed
+		if err := tx.MarkEventProcessed(ctx, eventID); err != nil {
+			return fmt.Errorf("failed to mark event as processed: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	// Mark event as processed
-	if err := p.store.MarkEventProcessed(ctx, eventID); err != nil {
-		p.logger.Error("Failed to mark event as processed", err, watermill.LogFields{
-			"event_id": eventID,
+	// Retransmitted or redelivered events are processed once
+	if processed {
+		p.logger.Debug("Skipping duplicate event", watermill.LogFields{
+			"event_id":   eventID,
+			"event_type": event.Type,
 		})
+		return nil
+	}
+
+	// Track which plugin and schema versions each server sends. Lifecycle
+	// events come from the collector, not the server's plugin. This is
+	// bookkeeping outside the event's transaction, so a failure only logs.
+	if base := event.Base(); event.Type != events.EventTypeServerOnline && event.Type != events.EventTypeServerOffline {
+		if err := p.store.RecordServerVersion(ctx, base.ServerIP, base.PluginVersion, base.SchemaVersion, base.Timestamp); err != nil {
+			p.logger.Error("Failed to record server version", err, watermill.LogFields{
+				"server_ip": base.ServerIP,
+			})
+		}
 	}
 
 	return nil
 }
 
-// storeRawEvent stores the raw event JSON
-func (p *Processor) storeRawEvent(ctx context.Context, event *events.Event, payload []byte) (int64, error) {
-	var baseEvent events.BaseEvent
+// processInvalidMessage stores a payload the collector dead-lettered
+func (p *Processor) processInvalidMessage(ctx context.Context, msg *message.Message) error {
+	receivedAt, err := time.Parse(time.RFC3339Nano, msg.Metadata.Get("received_at"))
+	if err != nil {
+		receivedAt = time.Now()
+	}
 
-	// Extract base event fields
-	if err := json.Unmarshal(payload, &baseEvent); err != nil {
-		return 0, err
+	serverIP := msg.Metadata.Get("server_ip")
+	if serverIP == "" {
+		serverIP = msg.Metadata.Get("source_ip")
 	}
 
-	return p.store.InsertRawEvent(
+	return p.store.InsertInvalidEvent(ctx, &store.InvalidEvent{
+		ServerIP:   serverIP,
+		ServerID:   msg.Metadata.Get("server_id"),
+		Source:     msg.Metadata.Get("source"),
+		EventType:  msg.Metadata.Get("event_type"),
+		Reason:     msg.Metadata.Get("reason"),
+		Payload:    msg.Payload,
+		ReceivedAt: receivedAt,
+	})
+}
+
+// storeRawEvent stores the raw event JSON under the event's (corrected) time.
+// It reports whether the event was already processed.
+func (p *Processor) storeRawEvent(ctx context.Context, tx *store.Store, event *events.Event, payload []byte) (int64, bool, error) {
+	baseEvent := event.Base()
+
+	return tx.InsertRawEvent(
 		ctx,
+		parser.EventKey(event, payload),
 		string(event.Type),
 		baseEvent.Timestamp,
 		baseEvent.ServerIP,
@@ -147,22 +244,37 @@ func (p *Processor) storeRawEvent(ctx context.Context, event *events.Event, payl
 }
 
 // processTypedEvent processes the event based on its type
-func (p *Processor) processTypedEvent(ctx context.Context, event *events.Event, eventID int64) error {
+func (p *Processor) processTypedEvent(ctx context.Context, tx *store.Store, event *events.Event, eventID int64) error {
 	switch event.Type {
 	case events.EventTypeKill:
-		return p.processKillEvent(ctx, event.Kill, eventID)
+		return p.processKillEvent(ctx, tx, event.Kill, eventID)
 
 	case events.EventTypeAirshot:
-		return p.processAirshotEvent(ctx, event.Airshot, eventID)
+		return p.processAirshotEvent(ctx, tx, event.Airshot, eventID)
 
 	case events.EventTypeDeflect:
-		return p.processDeflectEvent(ctx, event.Deflect, eventID)
+		return p.processDeflectEvent(ctx, tx, event.Deflect, eventID)
 
 	case events.EventTypeRoundStart, events.EventTypeMatchStart:
-		return p.processMatchStartEvent(ctx, event.MatchStart)
+		return p.processMatchStartEvent(ctx, tx, event.MatchStart, eventID)
 
 	case events.EventTypeRoundEnd, events.EventTypeMatchEnd:
-		return p.processMatchEndEvent(ctx, event.MatchEnd)
+		return p.processMatchEndEvent(ctx, tx, event.MatchEnd)
+
+	case events.EventTypeServerOffline:
+		return p.processServerOfflineEvent(ctx, tx, event.ServerStatus)
+
+	case events.EventTypePlayerSpawn:
+		return p.processPlayerSpawnEvent(ctx, tx, event.PlayerSpawn)
+
+	case events.EventTypePlayerDisconnect:
+		return p.processPlayerDisconnectEvent(ctx, tx, event.PlayerDisconnect)
+
+	case events.EventTypeAssist, events.EventTypeDomination, events.EventTypeRevenge,
+		events.EventTypeHeadshot, events.EventTypeBackstab, events.EventTypeFirstBlood:
+		// Counted from the kill event, which carries the same flags and the
+		// assister
+		return nil
 
 	default:
 		// Event type stored but not processed further
@@ -170,66 +282,170 @@ func (p *Processor) processTypedEvent(ctx context.Context, event *events.Event,
 	}
 }
 
+// anonymousPlayer drops the optional players of an event that have no
+// account, and returns the role of a required player that has none. Only
+// the players the processor records are checked; malformed IDs are left for
+// the store to reject.
+func anonymousPlayer(event *events.Event) string {
+	switch {
+	case event.Kill != nil:
+		if event.Kill.Assister != nil && isAnonymous(event.Kill.Assister.SteamID) {
+			event.Kill.Assister = nil
+		}
+		switch {
+		case isAnonymous(event.Kill.Killer.SteamID):
+			return "killer"
+		case isAnonymous(event.Kill.Victim.SteamID):
+			return "victim"
+		}
+	case event.Airshot != nil:
+		switch {
+		case isAnonymous(event.Airshot.Player.SteamID):
+			return "player"
+		case isAnonymous(event.Airshot.Victim.SteamID):
+			return "victim"
+		}
+	case event.Deflect != nil:
+		if event.Deflect.Owner != nil && isAnonymous(event.Deflect.Owner.SteamID) {
+			event.Deflect.Owner = nil
+		}
+		if isAnonymous(event.Deflect.Player.SteamID) {
+			return "player"
+		}
+	case event.PlayerSpawn != nil:
+		if isAnonymous(event.PlayerSpawn.Player.SteamID) {
+			return "player"
+		}
+	case event.PlayerDisconnect != nil:
+		if isAnonymous(event.PlayerDisconnect.Player.SteamID) {
+			return "player"
+		}
+	}
+
+	return ""
+}
+
+// isAnonymous reports whether a SteamID is a bot's or not assigned yet
+// (STEAM_ID_PENDING, empty)
+func isAnonymous(steamID string) bool {
+	_, err := steamid.Parse(steamID)
+	return errors.Is(err, steamid.ErrBot) || errors.Is(err, steamid.ErrUnassigned)
+}
+
 // processKillEvent processes a kill event
-func (p *Processor) processKillEvent(ctx context.Context, kill *events.KillEvent, eventID int64) error {
+func (p *Processor) processKillEvent(ctx context.Context, tx *store.Store, kill *events.KillEvent, eventID int64) error {
 	// Get or create active match
-	match, err := p.store.GetOrCreateActiveMatch(ctx, kill.ServerIP, "", kill.Gamemode)
+	match, err := tx.GetOrCreateActiveMatch(ctx, kill.ServerIP, "", kill.Gamemode)
 	if err != nil {
 		return fmt.Errorf("failed to get/create match: %w", err)
 	}
 
 	// Get or create players
-	killer, err := p.store.GetOrCreatePlayer(ctx, kill.Killer.SteamID, kill.Killer.Name)
+	killer, err := tx.GetOrCreatePlayer(ctx, kill.Killer.SteamID, kill.Killer.Name)
 	if err != nil {
 		return err
 	}
 
-	victim, err := p.store.GetOrCreatePlayer(ctx, kill.Victim.SteamID, kill.Victim.Name)
+	victim, err := tx.GetOrCreatePlayer(ctx, kill.Victim.SteamID, kill.Victim.Name)
 	if err != nil {
 		return err
 	}
 
-	// Track players in match
-	if err := p.store.GetOrCreateMatchPlayer(ctx, match.ID, killer.ID, kill.Killer.Team); err != nil {
-		p.logger.Error("Failed to track killer in match", err, watermill.LogFields{
-			"match_id":  match.ID,
-			"player_id": killer.ID,
-		})
+	// Track players in match. A failed statement aborts the transaction, so
+	// the whole event is rolled back and retried.
+	if err := tx.GetOrCreateMatchPlayer(ctx, match.ID, killer.ID, kill.Killer.Team); err != nil {
+		return fmt.Errorf("failed to track killer in match: %w", err)
 	}
-	if err := p.store.GetOrCreateMatchPlayer(ctx, match.ID, victim.ID, kill.Victim.Team); err != nil {
-		p.logger.Error("Failed to track victim in match", err, watermill.LogFields{
-			"match_id":  match.ID,
-			"player_id": victim.ID,
-		})
+	if err := tx.GetOrCreateMatchPlayer(ctx, match.ID, victim.ID, kill.Victim.Team); err != nil {
+		return fmt.Errorf("failed to track victim in match: %w", err)
 	}
 
 	// Insert kill
-	return p.store.InsertKill(ctx, kill, eventID, match.ID)
+	return tx.InsertKill(ctx, kill, eventID, match.ID)
 }
 
 // processAirshotEvent processes an airshot event
-func (p *Processor) processAirshotEvent(ctx context.Context, airshot *events.AirshotEvent, eventID int64) error {
-	match, err := p.store.GetOrCreateActiveMatch(ctx, airshot.ServerIP, "", airshot.Gamemode)
+func (p *Processor) processAirshotEvent(ctx context.Context, tx *store.Store, airshot *events.AirshotEvent, eventID int64) error {
+	match, err := tx.GetOrCreateActiveMatch(ctx, airshot.ServerIP, "", airshot.Gamemode)
 	if err != nil {
 		return err
 	}
 
-	return p.store.InsertAirshot(ctx, airshot, eventID, match.ID)
+	return tx.InsertAirshot(ctx, airshot, eventID, match.ID)
 }
 
 // processDeflectEvent processes a deflect event
-func (p *Processor) processDeflectEvent(ctx context.Context, deflect *events.DeflectEvent, eventID int64) error {
-	match, err := p.store.GetOrCreateActiveMatch(ctx, deflect.ServerIP, "", deflect.Gamemode)
+func (p *Processor) processDeflectEvent(ctx context.Context, tx *store.Store, deflect *events.DeflectEvent, eventID int64) error {
+	match, err := tx.GetOrCreateActiveMatch(ctx, deflect.ServerIP, "", deflect.Gamemode)
+	if err != nil {
+		return err
+	}
+
+	return tx.InsertDeflect(ctx, deflect, eventID, match.ID)
+}
+
+// processServerOfflineEvent closes matches left open by a server that went
+// quiet, so its next event starts a new match
+func (p *Processor) processServerOfflineEvent(ctx context.Context, tx *store.Store, status *events.ServerStatusEvent) error {
+	closed, err := tx.CloseOpenMatches(ctx, status.ServerIP, status.LastSeen)
+	if err != nil {
+		return err
+	}
+
+	sessions, err := tx.ClosePlayerSessions(ctx, status.ServerIP, status.LastSeen, "server offline")
 	if err != nil {
 		return err
 	}
 
-	return p.store.InsertDeflect(ctx, deflect, eventID, match.ID)
+	if closed > 0 || sessions > 0 {
+		p.logger.Info("Closed matches and sessions of offline server", watermill.LogFields{
+			"server_ip": status.ServerIP,
+			"matches":   closed,
+			"sessions":  sessions,
+			"last_seen": status.LastSeen.Format(time.RFC3339),
+		})
+	}
+
+	return nil
+}
+
+// processPlayerSpawnEvent opens the player's session on the server, or
+// counts the spawn on the open one
+func (p *Processor) processPlayerSpawnEvent(ctx context.Context, tx *store.Store, spawn *events.PlayerSpawnEvent) error {
+	player, err := tx.GetOrCreatePlayer(ctx, spawn.Player.SteamID, spawn.Player.Name)
+	if err != nil {
+		return fmt.Errorf("failed to get/create player: %w", err)
+	}
+
+	return tx.RecordPlayerSpawn(ctx, player.ID, spawn.ServerIP, spawn.Timestamp)
+}
+
+// processPlayerDisconnectEvent closes the player's session on the server
+func (p *Processor) processPlayerDisconnectEvent(ctx context.Context, tx *store.Store, disconnect *events.PlayerDisconnectEvent) error {
+	player, err := tx.GetOrCreatePlayer(ctx, disconnect.Player.SteamID, disconnect.Player.Name)
+	if err != nil {
+		return fmt.Errorf("failed to get/create player: %w", err)
+	}
+
+	ended, err := tx.EndPlayerSession(ctx, player.ID, disconnect.ServerIP, disconnect.Timestamp, disconnect.Reason)
+	if err != nil {
+		return err
+	}
+
+	if !ended {
+		// The player left before spawning
+		p.logger.Debug("No open session for disconnecting player", watermill.LogFields{
+			"server_ip": disconnect.ServerIP,
+			"steam_id":  disconnect.Player.SteamID,
+		})
+	}
+
+	return nil
 }
 
 // processMatchStartEvent processes a match start event
-func (p *Processor) processMatchStartEvent(ctx context.Context, matchStart *events.MatchStartEvent) error {
+func (p *Processor) processMatchStartEvent(ctx context.Context, tx *store.Store, matchStart *events.MatchStartEvent, eventID int64) error {
 	// Create new match
-	_, err := p.store.CreateMatch(ctx, matchStart.ServerIP, matchStart.Map, matchStart.Gamemode, matchStart.Timestamp)
+	_, err := tx.CreateMatch(ctx, matchStart.ServerIP, matchStart.Map, matchStart.Gamemode, matchStart.Timestamp, eventID)
 	return err
 }
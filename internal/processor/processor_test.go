@@ -0,0 +1,81 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/UDL-TF/UnitedStats/internal/parser"
+)
+
+// TestAnonymousPlayer tests that events of bots and unassigned players are
+// skipped and such optional players are dropped
+func TestAnonymousPlayer(t *testing.T) {
+	tests := []struct {
+		name         string
+		line         string
+		wantRole     string
+		wantAssister bool
+		wantOwner    bool
+	}{
+		{
+			name:         "Kill",
+			line:         `{"timestamp":"2024-02-01T12:00:00Z","server_ip":"10.0.0.1","event_type":"kill","killer":{"steam_id":"76561198012345678","team":2},"victim":{"steam_id":"[U:1:12345]","team":3},"assister":{"steam_id":"76561198087654321","team":2},"weapon":{"name":"scattergun"}}`,
+			wantAssister: true,
+		},
+		{
+			name:     "Bot killer",
+			line:     `{"timestamp":"2024-02-01T12:00:00Z","server_ip":"10.0.0.1","event_type":"kill","killer":{"steam_id":"BOT","team":2},"victim":{"steam_id":"76561198087654321","team":3},"weapon":{"name":"scattergun"}}`,
+			wantRole: "killer",
+		},
+		{
+			name:     "Pending victim",
+			line:     `{"timestamp":"2024-02-01T12:00:00Z","server_ip":"10.0.0.1","event_type":"kill","killer":{"steam_id":"76561198012345678","team":2},"victim":{"steam_id":"STEAM_ID_PENDING","team":3},"weapon":{"name":"scattergun"}}`,
+			wantRole: "victim",
+		},
+		{
+			name: "Bot assister",
+			line: `{"timestamp":"2024-02-01T12:00:00Z","server_ip":"10.0.0.1","event_type":"kill","killer":{"steam_id":"76561198012345678","team":2},"victim":{"steam_id":"76561198087654321","team":3},"assister":{"steam_id":"BOT","team":2},"weapon":{"name":"scattergun"}}`,
+		},
+		{
+			name:     "Empty airshot victim",
+			line:     `{"timestamp":"2024-02-01T12:00:00Z","server_ip":"10.0.0.1","event_type":"airshot","player":{"steam_id":"76561198012345678","team":2},"victim":{"steam_id":"","team":3},"weapon_type":"rocket"}`,
+			wantRole: "victim",
+		},
+		{
+			name: "Bot deflect owner",
+			line: `{"timestamp":"2024-02-01T12:00:00Z","server_ip":"10.0.0.1","event_type":"deflect","player":{"steam_id":"76561198012345678","team":3},"owner":{"steam_id":"BOT","team":2}}`,
+		},
+		{
+			name:      "Deflect",
+			line:      `{"timestamp":"2024-02-01T12:00:00Z","server_ip":"10.0.0.1","event_type":"deflect","player":{"steam_id":"76561198012345678","team":3},"owner":{"steam_id":"76561198087654321","team":2}}`,
+			wantOwner: true,
+		},
+		{
+			name:     "Bot spawn",
+			line:     `{"timestamp":"2024-02-01T12:00:00Z","server_ip":"10.0.0.1","event_type":"player_spawn","player":{"steam_id":"BOT","team":2}}`,
+			wantRole: "player",
+		},
+		{
+			name: "Malformed killer",
+			line: `{"timestamp":"2024-02-01T12:00:00Z","server_ip":"10.0.0.1","event_type":"kill","killer":{"steam_id":"STEAM_0:2:1","team":2},"victim":{"steam_id":"76561198087654321","team":3},"weapon":{"name":"scattergun"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := parser.Decode([]byte(tt.line))
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+
+			if role := anonymousPlayer(event); role != tt.wantRole {
+				t.Errorf("anonymousPlayer() = %q, want %q", role, tt.wantRole)
+			}
+			if event.Kill != nil && (event.Kill.Assister != nil) != tt.wantAssister {
+				t.Errorf("assister = %+v, want kept %v", event.Kill.Assister, tt.wantAssister)
+			}
+			if event.Deflect != nil && (event.Deflect.Owner != nil) != tt.wantOwner {
+				t.Errorf("owner = %+v, want kept %v", event.Deflect.Owner, tt.wantOwner)
+			}
+		})
+	}
+}
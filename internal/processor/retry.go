@@ -0,0 +1,183 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+	"github.com/UDL-TF/UnitedStats/internal/parser"
+	"github.com/UDL-TF/UnitedStats/internal/store"
+	"github.com/UDL-TF/UnitedStats/pkg/steamid"
+)
+
+// Retries and quarantine
+//
+// A message that fails is retried in place with exponential backoff, each
+// attempt under its own handler timeout. Once its attempts are used up, or
+// when the failure cannot be fixed by retrying (such as a payload that does
+// not parse), the message is quarantined: it is stored in the poison_messages
+// table with its error chain, announced on PoisonTopic and acknowledged, so it
+// no longer blocks the topic. Quarantined messages can be inspected, fixed and
+// requeued with cmd/quarantine.
+
+// PoisonTopic announces messages the processor quarantined
+const PoisonTopic = "events.poison"
+
+// RetryConfig controls how failed messages are retried
+type RetryConfig struct {
+	// MaxAttempts is how often a message is processed before it is
+	// quarantined (default 5)
+	MaxAttempts int
+	// InitialBackoff is the pause after the first failure (default 100ms)
+	InitialBackoff time.Duration
+	// MaxBackoff caps the pause between attempts (default 10s)
+	MaxBackoff time.Duration
+}
+
+// withDefaults fills in unset retry settings
+func (cfg RetryConfig) withDefaults() RetryConfig {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 5
+	}
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = 100 * time.Millisecond
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 10 * time.Second
+	}
+	return cfg
+}
+
+// poisonStore stores quarantined messages
+type poisonStore interface {
+	InsertPoisonMessage(ctx context.Context, msg *store.PoisonMessage) (int64, error)
+}
+
+// isPermanent reports whether retrying cannot fix a failure
+func isPermanent(err error) bool {
+	var parseErr *parser.ParseError
+	return errors.As(err, &parseErr) || errors.Is(err, steamid.ErrInvalid)
+}
+
+// errorChain lists the messages of an error and the errors it wraps,
+// outermost first
+func errorChain(err error) []string {
+	var chain []string
+	for ; err != nil; err = errors.Unwrap(err) {
+		chain = append(chain, err.Error())
+	}
+	return chain
+}
+
+// retryMiddleware retries failed messages and quarantines those that keep
+// failing. Once ctx is cancelled it stops retrying and leaves the message
+// unacknowledged for the next run.
+func (p *Processor) retryMiddleware(ctx context.Context) message.HandlerMiddleware {
+	return func(h message.HandlerFunc) message.HandlerFunc {
+		return func(msg *message.Message) ([]*message.Message, error) {
+			attempts, err := p.processWithRetry(ctx, msg, h)
+			if err == nil || ctx.Err() != nil {
+				return nil, err
+			}
+
+			topic := message.SubscribeTopicFromCtx(msg.Context())
+			if err := p.quarantine(msg.Context(), topic, msg, attempts, err); err != nil {
+				return nil, err
+			}
+			return nil, nil
+		}
+	}
+}
+
+// processWithRetry processes a message until it succeeds, fails permanently,
+// runs out of attempts or ctx is cancelled. It returns the number of attempts
+// made and the last error.
+func (p *Processor) processWithRetry(ctx context.Context, msg *message.Message, h message.HandlerFunc) (int, error) {
+	// Each attempt starts from the message's own context, not the one the
+	// previous attempt's timeout cancelled
+	msgCtx := msg.Context()
+	defer msg.SetContext(msgCtx)
+
+	backoff := p.retry.InitialBackoff
+
+	for attempt := 1; ; attempt++ {
+		msg.SetContext(msgCtx)
+		_, err := h(msg)
+		if err == nil {
+			return attempt, nil
+		}
+
+		p.logger.Error("Failed to process message", err, watermill.LogFields{
+			"message_id":     msg.UUID,
+			"correlation_id": middleware.MessageCorrelationID(msg),
+			"attempt":        attempt,
+		})
+
+		if attempt >= p.retry.MaxAttempts || isPermanent(err) {
+			return attempt, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return attempt, err
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, p.retry.MaxBackoff)
+	}
+}
+
+// quarantine stores a message that could not be processed and announces it
+// on the poison topic. The table is the record the quarantine tools work
+// from, so only failing to store the message is an error.
+func (p *Processor) quarantine(ctx context.Context, topic string, msg *message.Message, attempts int, cause error) error {
+	metadata := make(map[string]string, len(msg.Metadata))
+	for key, value := range msg.Metadata {
+		metadata[key] = value
+	}
+
+	id, err := p.poison.InsertPoisonMessage(ctx, &store.PoisonMessage{
+		MessageUUID: msg.UUID,
+		Topic:       topic,
+		Payload:     msg.Payload,
+		Metadata:    metadata,
+		ErrorChain:  errorChain(cause),
+		Attempts:    attempts,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to quarantine message: %w", err)
+	}
+
+	p.logger.Error("Quarantined poison message", cause, watermill.LogFields{
+		"message_id": msg.UUID,
+		"topic":      topic,
+		"attempts":   attempts,
+		"poison_id":  id,
+	})
+
+	if p.publisher == nil {
+		return nil
+	}
+
+	poison := message.NewMessage(watermill.NewUUID(), msg.Payload)
+	for key, value := range msg.Metadata {
+		poison.Metadata.Set(key, value)
+	}
+	middleware.SetCorrelationID(middleware.MessageCorrelationID(msg), poison)
+	poison.Metadata.Set("poison_id", strconv.FormatInt(id, 10))
+	poison.Metadata.Set("poison_topic", topic)
+	poison.Metadata.Set("poison_attempts", strconv.Itoa(attempts))
+	poison.Metadata.Set("poison_error", cause.Error())
+
+	if err := p.publisher.Publish(PoisonTopic, poison); err != nil {
+		p.logger.Error("Failed to publish poison message", err, watermill.LogFields{
+			"poison_id": id,
+		})
+	}
+
+	return nil
+}
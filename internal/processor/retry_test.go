@@ -0,0 +1,205 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/UDL-TF/UnitedStats/internal/parser"
+	"github.com/UDL-TF/UnitedStats/internal/store"
+	"github.com/UDL-TF/UnitedStats/pkg/steamid"
+)
+
+// recordingPoisonStore keeps quarantined messages in memory
+type recordingPoisonStore struct {
+	mu       sync.Mutex
+	messages []*store.PoisonMessage
+	err      error
+}
+
+func (s *recordingPoisonStore) InsertPoisonMessage(ctx context.Context, msg *store.PoisonMessage) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return 0, s.err
+	}
+	s.messages = append(s.messages, msg)
+	return int64(len(s.messages)), nil
+}
+
+// newTestProcessor creates a processor with fast retries and an in-memory
+// poison store
+func newTestProcessor(poison poisonStore, publisher message.Publisher) *Processor {
+	p := New(Config{
+		Publisher: publisher,
+		Logger:    watermill.NopLogger{},
+		Retry: RetryConfig{
+			MaxAttempts:    3,
+			InitialBackoff: time.Millisecond,
+			MaxBackoff:     2 * time.Millisecond,
+		},
+	})
+	p.poison = poison
+	return p
+}
+
+// TestProcessWithRetry tests how often messages are attempted
+func TestProcessWithRetry(t *testing.T) {
+	parseErr := fmt.Errorf("failed to parse event: %w", &parser.ParseError{Line: "x", Reason: "invalid JSON"})
+	_, steamIDErr := steamid.Parse("STEAM_0:2:1")
+	steamIDErr = fmt.Errorf("failed to normalize steam ID: %w", steamIDErr)
+
+	tests := []struct {
+		name         string
+		failures     int
+		err          error
+		wantAttempts int
+		wantErr      bool
+	}{
+		{name: "Succeeds first time", failures: 0, err: errors.New("db down"), wantAttempts: 1},
+		{name: "Succeeds after retries", failures: 2, err: errors.New("db down"), wantAttempts: 3},
+		{name: "Runs out of attempts", failures: 5, err: errors.New("db down"), wantAttempts: 3, wantErr: true},
+		{name: "Parse errors are not retried", failures: 5, err: parseErr, wantAttempts: 1, wantErr: true},
+		{name: "Malformed SteamIDs are not retried", failures: 5, err: steamIDErr, wantAttempts: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProcessor(&recordingPoisonStore{}, nil)
+
+			calls := 0
+			attempts, err := p.processWithRetry(context.Background(), message.NewMessage("1", nil), func(*message.Message) ([]*message.Message, error) {
+				calls++
+				if calls <= tt.failures {
+					return nil, tt.err
+				}
+				return nil, nil
+			})
+
+			if attempts != tt.wantAttempts || calls != tt.wantAttempts {
+				t.Errorf("attempts = %d (calls %d), want %d", attempts, calls, tt.wantAttempts)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestQuarantine tests that messages that keep failing are stored, announced
+// on the poison topic and acknowledged
+func TestQuarantine(t *testing.T) {
+	tests := []struct {
+		name      string
+		process   processFunc
+		storeErr  error
+		wantAck   bool
+		wantChain []string
+	}{
+		{
+			name: "Quarantined",
+			process: func(context.Context, *message.Message) error {
+				return fmt.Errorf("failed to store raw event: %w", errors.New("db down"))
+			},
+			wantAck:   true,
+			wantChain: []string{"failed to store raw event: db down", "db down"},
+		},
+		{
+			name: "Panics are quarantined",
+			process: func(context.Context, *message.Message) error {
+				panic("bad payload")
+			},
+			wantAck: true,
+		},
+		{
+			name: "Store unavailable",
+			process: func(context.Context, *message.Message) error {
+				return errors.New("db down")
+			},
+			storeErr: errors.New("db down"),
+			wantAck:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pubsub := newTestPubSub()
+			defer pubsub.Close()
+
+			poisoned, err := pubsub.Subscribe(context.Background(), PoisonTopic)
+			if err != nil {
+				t.Fatalf("Subscribe() error = %v", err)
+			}
+
+			poison := &recordingPoisonStore{err: tt.storeErr}
+			p := newTestProcessor(poison, pubsub)
+			p.subscriber = pubsub
+
+			calls := make(chan struct{}, 16)
+			stop := runTestProcessor(t, p, map[string]processFunc{
+				"events.kill": func(ctx context.Context, msg *message.Message) error {
+					calls <- struct{}{}
+					return tt.process(ctx, msg)
+				},
+			})
+			defer stop()
+
+			msg := message.NewMessage("msg-1", []byte(`{"event_type":"kill"}`))
+			msg.Metadata.Set("source_ip", "10.0.0.1")
+			if err := pubsub.Publish("events.kill", msg); err != nil {
+				t.Fatalf("Publish() error = %v", err)
+			}
+
+			// All attempts are made before the message is quarantined
+			for i := 0; i < 3; i++ {
+				select {
+				case <-calls:
+				case <-time.After(5 * time.Second):
+					t.Fatalf("attempt %d not made", i+1)
+				}
+			}
+
+			if !tt.wantAck {
+				// The message is nacked and redelivered
+				select {
+				case <-calls:
+				case <-time.After(5 * time.Second):
+					t.Fatal("message not redelivered")
+				}
+				return
+			}
+
+			select {
+			case announced := <-poisoned:
+				announced.Ack()
+				if announced.Metadata.Get("poison_topic") != "events.kill" || announced.Metadata.Get("poison_id") != "1" {
+					t.Errorf("poison metadata = %v", announced.Metadata)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("nothing published to the poison topic")
+			}
+
+			poison.mu.Lock()
+			defer poison.mu.Unlock()
+			if len(poison.messages) != 1 {
+				t.Fatalf("stored %d poison messages, want 1", len(poison.messages))
+			}
+			stored := poison.messages[0]
+			if stored.Topic != "events.kill" || stored.Attempts != 3 || stored.MessageUUID != "msg-1" {
+				t.Errorf("stored = %+v, want topic events.kill, 3 attempts, uuid msg-1", stored)
+			}
+			if tt.wantChain != nil && !reflect.DeepEqual(stored.ErrorChain, tt.wantChain) {
+				t.Errorf("error chain = %q, want %q", stored.ErrorChain, tt.wantChain)
+			}
+			if stored.Metadata["source_ip"] != "10.0.0.1" {
+				t.Errorf("metadata = %v, want source_ip", stored.Metadata)
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/components/metrics"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+	"github.com/UDL-TF/UnitedStats/internal/parser"
+)
+
+// processFunc processes one message of a topic
+type processFunc func(context.Context, *message.Message) error
+
+// handlers returns the processing function of every subscribed topic: one
+// topic per event type the parser understands, and the dead-letter topic
+func (p *Processor) handlers() map[string]processFunc {
+	handlers := make(map[string]processFunc)
+	for _, eventType := range parser.EventTypes() {
+		handlers[fmt.Sprintf("events.%s", eventType)] = p.processMessage
+	}
+
+	// Payloads the collector rejected are kept for inspection
+	handlers[invalidTopic] = p.processInvalidMessage
+
+	return handlers
+}
+
+// Start starts processing events and blocks until ctx is cancelled and the
+// messages in flight have drained
+func (p *Processor) Start(ctx context.Context) error {
+	handlers := p.handlers()
+
+	p.logger.Info("Event processor starting", watermill.LogFields{
+		"topics": len(handlers),
+	})
+
+	return p.run(ctx, handlers)
+}
+
+// run routes each topic to its processing function until ctx is cancelled.
+// Messages in flight then get the drain timeout to finish before their
+// contexts are cancelled.
+func (p *Processor) run(ctx context.Context, handlers map[string]processFunc) error {
+	router, err := message.NewRouter(message.RouterConfig{
+		CloseTimeout: p.drainTimeout,
+	}, p.logger)
+	if err != nil {
+		return fmt.Errorf("failed to create router: %w", err)
+	}
+
+	work, abort := context.WithCancel(context.WithoutCancel(ctx))
+	defer abort()
+	stopDrain := context.AfterFunc(ctx, func() {
+		time.AfterFunc(p.drainTimeout, abort)
+	})
+	defer stopDrain()
+
+	router.AddMiddleware(middleware.CorrelationID)
+	if p.metrics != nil {
+		metrics.NewPrometheusMetricsBuilder(p.metrics, "unitedstats", "processor").AddPrometheusRouterMetrics(router)
+	}
+	if p.throttle > 0 {
+		router.AddMiddleware(middleware.NewThrottle(p.throttle, time.Second).Middleware)
+	}
+
+	var seq *sequencer
+	if p.reorderWindow > 0 {
+		seq = newSequencer(p.reorderWindow, p.maxPending, p.logger)
+	}
+
+	for topic, process := range handlers {
+		handler := p.chain(ctx, work, process)
+		if seq == nil || topic == invalidTopic {
+			router.AddNoPublisherHandler(topic, topic, p.subscriber, func(msg *message.Message) error {
+				_, err := handler(msg)
+				return err
+			})
+			continue
+		}
+
+		router.AddNoPublisherHandler(topic, topic, p.subscriber, func(msg *message.Message) error {
+			// A payload that does not decode is not ordered; processing
+			// reports the error
+			event, _ := decodeEvent(msg)
+			key, timestamp, ok := sequenceKey(msg, event)
+			if !ok {
+				_, err := handler(msg)
+				return err
+			}
+			return seq.add(msg.Context(), key, timestamp, func() {
+				p.processSequenced(handler, msg)
+			})
+		})
+	}
+
+	err = router.Run(ctx)
+
+	if seq != nil {
+		seq.stop()
+		if left := seq.wait(work); left > 0 {
+			p.logger.Error("Buffered events did not drain", fmt.Errorf("timed out after %s", p.drainTimeout), watermill.LogFields{
+				"events": left,
+			})
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to run router: %w", err)
+	}
+
+	return nil
+}
+
+// chain wraps a processing function in the per-message middleware. The first
+// middleware runs outermost. Recoverer sits inside the retries, so a payload
+// that panics is retried and quarantined like any failure.
+func (p *Processor) chain(ctx, work context.Context, process processFunc) message.HandlerFunc {
+	handler := func(msg *message.Message) ([]*message.Message, error) {
+		return nil, process(msg.Context(), msg)
+	}
+
+	middlewares := []message.HandlerMiddleware{
+		detach(work),
+		p.retryMiddleware(ctx),
+		middleware.Timeout(p.handlerTimeout),
+		middleware.Recoverer,
+	}
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+
+	return handler
+}
+
+// processSequenced processes an event the sequencer released. The message was
+// acknowledged when it was buffered, so if it can be neither processed nor
+// quarantined it is published to its topic again rather than lost.
+func (p *Processor) processSequenced(handler message.HandlerFunc, msg *message.Message) {
+	_, err := handler(msg)
+	if err == nil {
+		return
+	}
+
+	topic := message.SubscribeTopicFromCtx(msg.Context())
+	fields := watermill.LogFields{
+		"message_id": msg.UUID,
+		"topic":      topic,
+	}
+
+	if p.publisher != nil {
+		retry := message.NewMessage(watermill.NewUUID(), msg.Payload)
+		for key, value := range msg.Metadata {
+			retry.Metadata.Set(key, value)
+		}
+
+		publishErr := p.publisher.Publish(topic, retry)
+		if publishErr == nil {
+			p.logger.Info("Requeued event that could not be processed", fields)
+			return
+		}
+		err = errors.Join(err, publishErr)
+	}
+
+	p.logger.Error("Lost event that could not be processed", err, fields)
+}
+
+// detach lets a message keep its context when the subscription closes on
+// shutdown, so it can finish until work is cancelled at the drain deadline
+func detach(work context.Context) message.HandlerMiddleware {
+	return func(h message.HandlerFunc) message.HandlerFunc {
+		return func(msg *message.Message) ([]*message.Message, error) {
+			ctx, cancel := context.WithCancel(context.WithoutCancel(msg.Context()))
+			defer cancel()
+			stop := context.AfterFunc(work, cancel)
+			defer stop()
+
+			msg.SetContext(ctx)
+			return h(msg)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/pubsub/gochannel"
+)
+
+// newTestPubSub creates an in-memory queue that keeps messages published
+// before the processor subscribes
+func newTestPubSub() *gochannel.GoChannel {
+	return gochannel.NewGoChannel(gochannel.Config{
+		OutputChannelBuffer: 16,
+		Persistent:          true,
+	}, watermill.NopLogger{})
+}
+
+// runTestProcessor runs the processor's router with the given handlers and
+// returns a function that stops it and returns the result of run
+func runTestProcessor(t *testing.T, p *Processor, handlers map[string]processFunc) func() error {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- p.run(ctx, handlers) }()
+
+	var err error
+	stopped := false
+	return func() error {
+		if !stopped {
+			cancel()
+			err = <-done
+			stopped = true
+		}
+		return err
+	}
+}
+
+// TestDrain tests that messages in flight at shutdown may finish until the
+// drain deadline, and are cancelled after it
+func TestDrain(t *testing.T) {
+	tests := []struct {
+		name         string
+		work         time.Duration
+		drainTimeout time.Duration
+		wantErr      error
+	}{
+		{name: "Finishes before deadline", work: 50 * time.Millisecond, drainTimeout: 5 * time.Second},
+		{name: "Cancelled at deadline", work: time.Minute, drainTimeout: 50 * time.Millisecond, wantErr: context.Canceled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pubsub := newTestPubSub()
+			defer pubsub.Close()
+
+			p := newTestProcessor(&recordingPoisonStore{}, nil)
+			p.subscriber = pubsub
+			p.drainTimeout = tt.drainTimeout
+
+			started := make(chan struct{})
+			result := make(chan error, 1)
+			stop := runTestProcessor(t, p, map[string]processFunc{
+				"events.kill": func(ctx context.Context, msg *message.Message) error {
+					close(started)
+					select {
+					case <-time.After(tt.work):
+						result <- nil
+					case <-ctx.Done():
+						result <- ctx.Err()
+					}
+					return nil
+				},
+			})
+
+			if err := pubsub.Publish("events.kill", message.NewMessage("msg-1", nil)); err != nil {
+				t.Fatalf("Publish() error = %v", err)
+			}
+
+			select {
+			case <-started:
+			case <-time.After(5 * time.Second):
+				t.Fatal("message not delivered")
+			}
+
+			_ = stop()
+
+			select {
+			case err := <-result:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("handler result = %v, want %v", err, tt.wantErr)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("handler still running after shutdown")
+			}
+		})
+	}
+}
+
+// TestHandlers tests that every parsed event type and the dead-letter topic
+// are subscribed
+func TestHandlers(t *testing.T) {
+	p := newTestProcessor(&recordingPoisonStore{}, nil)
+	handlers := p.handlers()
+
+	for _, topic := range []string{"events.kill", "events.match_end", "events.server_offline", invalidTopic} {
+		if handlers[topic] == nil {
+			t.Errorf("no handler for %s", topic)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package processor
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/UDL-TF/UnitedStats/pkg/events"
+)
+
+// Ordering
+//
+// Each event type has its own topic, so a match_end could otherwise be
+// processed before the last kill of its match. The sequencer partitions
+// events by server and holds each one for a short reorder window, then
+// releases a server's events in timestamp order to a worker of its own, so
+// servers are still processed in parallel. An event that arrives after later
+// events of its server were released is processed at once.
+//
+// Subscribers deliver the next message of a topic only after the previous one
+// is acknowledged, so events are acknowledged once the sequencer holds them;
+// waiting for them to be processed would take a reorder window per event.
+// This gives up at-least-once delivery for buffered events: if the processor
+// crashes or is killed, the events it holds (up to MaxPending) are lost. At a
+// clean shutdown they are flushed, and an event that can be neither processed
+// nor quarantined is published to its topic again. Ordering is therefore off
+// unless ReorderWindow is set.
+
+// idleTimeout is how long a server's worker waits for events before it exits
+const idleTimeout = time.Minute
+
+// errSequencerStopped is returned for events that arrive during shutdown
+var errSequencerStopped = errors.New("sequencer stopped")
+
+// pendingEvent is an event waiting for its reorder window to pass
+type pendingEvent struct {
+	timestamp time.Time
+	arrived   time.Time
+	seq       uint64
+	run       func()
+}
+
+// pendingEvents is a heap of events, earliest timestamp first
+type pendingEvents []*pendingEvent
+
+func (h pendingEvents) Len() int      { return len(h) }
+func (h pendingEvents) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h pendingEvents) Less(i, j int) bool {
+	if !h[i].timestamp.Equal(h[j].timestamp) {
+		return h[i].timestamp.Before(h[j].timestamp)
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h *pendingEvents) Push(x interface{}) {
+	*h = append(*h, x.(*pendingEvent))
+}
+
+func (h *pendingEvents) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return e
+}
+
+// partition holds the buffered events of one server
+type partition struct {
+	events       pendingEvents
+	wake         chan struct{}
+	lastReleased time.Time
+}
+
+// sequencer releases each server's events in timestamp order
+type sequencer struct {
+	window time.Duration
+	slots  chan struct{}
+	logger watermill.LoggerAdapter
+
+	mu         sync.Mutex
+	partitions map[string]*partition
+	stopping   bool
+	seq        uint64
+	wg         sync.WaitGroup
+}
+
+// newSequencer creates a sequencer holding at most maxPending events
+func newSequencer(window time.Duration, maxPending int, logger watermill.LoggerAdapter) *sequencer {
+	return &sequencer{
+		window:     window,
+		slots:      make(chan struct{}, maxPending),
+		logger:     logger,
+		partitions: make(map[string]*partition),
+	}
+}
+
+// add buffers an event of a server. run is called once the event is
+// released. It blocks while the sequencer is full, and fails if ctx is
+// cancelled first or the sequencer is stopping.
+func (s *sequencer) add(ctx context.Context, key string, timestamp time.Time, run func()) error {
+	select {
+	case s.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopping {
+		<-s.slots
+		return errSequencerStopped
+	}
+
+	p := s.partitions[key]
+	if p == nil {
+		p = &partition{wake: make(chan struct{}, 1)}
+		s.partitions[key] = p
+		s.wg.Add(1)
+		go s.run(key, p)
+	}
+
+	s.seq++
+	heap.Push(&p.events, &pendingEvent{
+		timestamp: timestamp,
+		arrived:   time.Now(),
+		seq:       s.seq,
+		run:       run,
+	})
+
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// run releases the events of one server until it has been idle for
+// idleTimeout, or the sequencer stops and its events are flushed
+func (s *sequencer) run(key string, p *partition) {
+	defer s.wg.Done()
+
+	timer := time.NewTimer(idleTimeout)
+	defer timer.Stop()
+	idle := false
+
+	for {
+		s.mu.Lock()
+
+		if len(p.events) == 0 {
+			if s.stopping || idle {
+				delete(s.partitions, key)
+				s.mu.Unlock()
+				return
+			}
+			s.mu.Unlock()
+
+			timer.Reset(idleTimeout)
+			select {
+			case <-p.wake:
+			case <-timer.C:
+				idle = true
+			}
+			continue
+		}
+		idle = false
+
+		next := p.events[0]
+		late := next.timestamp.Before(p.lastReleased)
+		wait := time.Until(next.arrived.Add(s.window))
+
+		if !s.stopping && !late && wait > 0 {
+			s.mu.Unlock()
+
+			timer.Reset(wait)
+			select {
+			case <-p.wake:
+			case <-timer.C:
+			}
+			continue
+		}
+
+		heap.Pop(&p.events)
+		if next.timestamp.After(p.lastReleased) {
+			p.lastReleased = next.timestamp
+		}
+		s.mu.Unlock()
+
+		if late {
+			s.logger.Debug("Event arrived after its reorder window", watermill.LogFields{
+				"server":    key,
+				"timestamp": next.timestamp.Format(time.RFC3339Nano),
+			})
+		}
+
+		next.run()
+		<-s.slots
+	}
+}
+
+// stop releases all buffered events at once and refuses new ones
+func (s *sequencer) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stopping = true
+	for _, p := range s.partitions {
+		select {
+		case p.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// wait waits until the workers have flushed their events or ctx is
+// cancelled, and returns the number of events left
+func (s *sequencer) wait(ctx context.Context) int {
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return 0
+	case <-ctx.Done():
+		return len(s.slots)
+	}
+}
+
+// sequenceKey returns the server an event is ordered within and its time.
+// Events without a server or timestamp are not ordered.
+func sequenceKey(msg *message.Message, event *events.Event) (string, time.Time, bool) {
+	if event == nil || event.Base() == nil || event.Base().Timestamp.IsZero() {
+		return "", time.Time{}, false
+	}
+	base := event.Base()
+	timestamp := base.Timestamp
+
+	// Use the collector's clock skew correction, as processMessage does
+	if corrected := msg.Metadata.Get("corrected_timestamp"); corrected != "" {
+		if parsed, err := time.Parse(time.RFC3339Nano, corrected); err == nil {
+			timestamp = parsed
+		}
+	}
+
+	key := msg.Metadata.Get("server_id")
+	if key == "" {
+		key = base.ServerIP
+	}
+	if key == "" {
+		key = msg.Metadata.Get("source_ip")
+	}
+	if key == "" {
+		return "", time.Time{}, false
+	}
+
+	return key, timestamp, true
+}
@@ -0,0 +1,196 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// TestSequencer tests that each server's events are released in timestamp order
+func TestSequencer(t *testing.T) {
+	base := time.Date(2024, 2, 1, 12, 0, 0, 0, time.UTC)
+
+	type event struct {
+		server string
+		second int
+	}
+
+	tests := []struct {
+		name   string
+		events []event
+		want   map[string][]int
+	}{
+		{
+			name:   "Reordered within window",
+			events: []event{{"a", 3}, {"a", 1}, {"a", 2}},
+			want:   map[string][]int{"a": {1, 2, 3}},
+		},
+		{
+			name:   "Servers are independent",
+			events: []event{{"a", 2}, {"b", 1}, {"a", 1}, {"b", 0}},
+			want:   map[string][]int{"a": {1, 2}, "b": {0, 1}},
+		},
+		{
+			name:   "Equal timestamps keep arrival order",
+			events: []event{{"a", 1}, {"a", 1}},
+			want:   map[string][]int{"a": {1, 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSequencer(50*time.Millisecond, 100, watermill.NopLogger{})
+
+			var mu sync.Mutex
+			var wg sync.WaitGroup
+			got := make(map[string][]int)
+
+			for _, e := range tt.events {
+				e := e
+				wg.Add(1)
+				err := s.add(context.Background(), e.server, base.Add(time.Duration(e.second)*time.Second), func() {
+					defer wg.Done()
+					mu.Lock()
+					got[e.server] = append(got[e.server], e.second)
+					mu.Unlock()
+				})
+				if err != nil {
+					t.Fatalf("add() error = %v", err)
+				}
+			}
+
+			wg.Wait()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("released %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestSequencerLateEvent tests that an event arriving after later events
+// were released is processed without waiting
+func TestSequencerLateEvent(t *testing.T) {
+	s := newSequencer(100*time.Millisecond, 100, watermill.NopLogger{})
+	base := time.Date(2024, 2, 1, 12, 0, 0, 0, time.UTC)
+
+	released := make(chan struct{}, 1)
+	if err := s.add(context.Background(), "a", base.Add(time.Second), func() { released <- struct{}{} }); err != nil {
+		t.Fatalf("add() error = %v", err)
+	}
+	<-released
+
+	start := time.Now()
+	if err := s.add(context.Background(), "a", base, func() { released <- struct{}{} }); err != nil {
+		t.Fatalf("add() error = %v", err)
+	}
+	<-released
+
+	if elapsed := time.Since(start); elapsed >= 100*time.Millisecond {
+		t.Errorf("late event released after %s, want immediately", elapsed)
+	}
+}
+
+// TestSequencerStop tests that stopping flushes buffered events and refuses new ones
+func TestSequencerStop(t *testing.T) {
+	s := newSequencer(time.Hour, 100, watermill.NopLogger{})
+
+	released := 0
+	var mu sync.Mutex
+	for i := 0; i < 3; i++ {
+		err := s.add(context.Background(), fmt.Sprintf("server-%d", i), time.Now(), func() {
+			mu.Lock()
+			released++
+			mu.Unlock()
+		})
+		if err != nil {
+			t.Fatalf("add() error = %v", err)
+		}
+	}
+
+	s.stop()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if left := s.wait(ctx); left != 0 {
+		t.Fatalf("wait() left %d events", left)
+	}
+	if released != 3 {
+		t.Errorf("released %d events, want 3", released)
+	}
+
+	if err := s.add(context.Background(), "a", time.Now(), func() {}); err != errSequencerStopped {
+		t.Errorf("add() after stop error = %v, want %v", err, errSequencerStopped)
+	}
+}
+
+// TestSequencerFull tests that intake blocks while the sequencer is full
+func TestSequencerFull(t *testing.T) {
+	s := newSequencer(time.Hour, 1, watermill.NopLogger{})
+	defer s.stop()
+
+	if err := s.add(context.Background(), "a", time.Now(), func() {}); err != nil {
+		t.Fatalf("add() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := s.add(ctx, "a", time.Now(), func() {}); err != context.DeadlineExceeded {
+		t.Errorf("add() on full sequencer error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+// TestOrderedProcessing tests that a match_end published before the last kill
+// of its match is processed after it
+func TestOrderedProcessing(t *testing.T) {
+	pubsub := newTestPubSub()
+	defer pubsub.Close()
+
+	p := newTestProcessor(&recordingPoisonStore{}, nil)
+	p.subscriber = pubsub
+	p.reorderWindow = 100 * time.Millisecond
+
+	var mu sync.Mutex
+	var order []string
+	done := make(chan struct{}, 2)
+	record := func(ctx context.Context, msg *message.Message) error {
+		mu.Lock()
+		order = append(order, message.SubscribeTopicFromCtx(msg.Context()))
+		mu.Unlock()
+		done <- struct{}{}
+		return nil
+	}
+
+	stop := runTestProcessor(t, p, map[string]processFunc{
+		"events.kill":      record,
+		"events.match_end": record,
+	})
+	defer stop()
+
+	publish := func(topic, payload string) {
+		t.Helper()
+		if err := pubsub.Publish(topic, message.NewMessage(watermill.NewUUID(), []byte(payload))); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+	}
+	publish("events.match_end", `{"event_type":"match_end","timestamp":"2024-02-01T12:10:00Z","server_ip":"10.0.0.1"}`)
+	publish("events.kill", `{"event_type":"kill","timestamp":"2024-02-01T12:09:59Z","server_ip":"10.0.0.1"}`)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("events not processed")
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"events.kill", "events.match_end"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("processed %v, want %v", order, want)
+	}
+}
@@ -0,0 +1,80 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// TestParseDriver tests parsing queue driver names
+func TestParseDriver(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Driver
+		wantErr bool
+	}{
+		{input: "amqp", want: DriverAMQP},
+		{input: "gochannel", wantErr: true},
+		{input: "sql", want: DriverSQL},
+		{input: "kafka", wantErr: true},
+		{input: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseDriver(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseDriver() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseDriver() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestGoChannelDriver tests that separately created in-process publishers and
+// subscribers are connected
+func TestGoChannelDriver(t *testing.T) {
+	cfg := Config{Driver: DriverGoChannel, Logger: watermill.NopLogger{}}
+
+	subscriber, err := NewSubscriber(cfg)
+	if err != nil {
+		t.Fatalf("NewSubscriber() error = %v", err)
+	}
+	defer subscriber.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	messages, err := subscriber.Subscribe(ctx, "events.kill")
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+
+	publisher, err := NewPublisher(cfg)
+	if err != nil {
+		t.Fatalf("NewPublisher() error = %v", err)
+	}
+	if err := publisher.Publish("events.kill", message.NewMessage(watermill.NewUUID(), []byte(`{"event_type":"kill"}`))); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	// Closing one side leaves the shared channel usable for the other
+	if err := publisher.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	select {
+	case msg := <-messages:
+		if string(msg.Payload) != `{"event_type":"kill"}` {
+			t.Errorf("payload = %s", msg.Payload)
+		}
+		msg.Ack()
+	case <-time.After(5 * time.Second):
+		t.Fatal("message not delivered")
+	}
+}
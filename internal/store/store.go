@@ -4,16 +4,28 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/UDL-TF/UnitedStats/pkg/events"
+	"github.com/UDL-TF/UnitedStats/pkg/steamid"
 	_ "github.com/lib/pq"
 )
 
 // Store handles all database operations
 type Store struct {
-	db *sql.DB
+	conn *sql.DB
+	// db runs the queries: the connection pool, or the transaction of a
+	// unit of work
+	db dbtx
+}
+
+// dbtx is implemented by *sql.DB and *sql.Tx
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
 }
 
 // Config holds database configuration
@@ -26,14 +38,17 @@ type Config struct {
 	SSLMode  string
 }
 
-// New creates a new database store
-func New(cfg Config) (*Store, error) {
-	connStr := fmt.Sprintf(
+// ConnString returns the PostgreSQL connection string for the configuration
+func (cfg Config) ConnString() string {
+	return fmt.Sprintf(
 		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
 		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.DBName, cfg.SSLMode,
 	)
+}
 
-	db, err := sql.Open("postgres", connStr)
+// New creates a new database store
+func New(cfg Config) (*Store, error) {
+	db, err := sql.Open("postgres", cfg.ConnString())
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -48,12 +63,39 @@ func New(cfg Config) (*Store, error) {
 	db.SetMaxIdleConns(5)
 	db.SetConnMaxLifetime(5 * time.Minute)
 
-	return &Store{db: db}, nil
+	return &Store{conn: db, db: db}, nil
 }
 
 // Close closes the database connection
 func (s *Store) Close() error {
-	return s.db.Close()
+	return s.conn.Close()
+}
+
+// InTx runs fn as one unit of work: every query fn makes through tx commits
+// if fn returns nil and rolls back otherwise. Called on a store that is
+// already in a transaction, fn joins that transaction.
+func (s *Store) InTx(ctx context.Context, fn func(tx *Store) error) error {
+	if _, ok := s.db.(*sql.Tx); ok {
+		return fn(s)
+	}
+
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	// Rolls back if fn fails or panics; a no-op once committed
+	defer tx.Rollback()
+
+	if err := fn(&Store{conn: s.conn, db: tx}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
 }
 
 // ============================================================================
@@ -85,12 +127,18 @@ type Player struct {
 	CountryCode sql.NullString
 }
 
-// GetOrCreatePlayer gets or creates a player by steam ID
+// GetOrCreatePlayer gets or creates a player by steam ID. The ID may be in
+// any format; players are stored by their SteamID64.
 func (s *Store) GetOrCreatePlayer(ctx context.Context, steamID, name string) (*Player, error) {
+	steamID, err := steamid.Normalize(steamID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to normalize steam ID: %w", err)
+	}
+
 	var player Player
 
 	// Try to get existing player
-	err := s.db.QueryRowContext(ctx, `
+	err = s.db.QueryRowContext(ctx, `
 		SELECT id, steam_id, name, created_at, updated_at, last_seen,
 		       mmr, peak_mmr, mmr_updated_at,
 		       total_kills, total_deaths, total_assists,
@@ -144,11 +192,16 @@ func (s *Store) GetOrCreatePlayer(ctx context.Context, steamID, name string) (*P
 	return &player, nil
 }
 
-// GetPlayerBySteamID gets a player by steam ID
+// GetPlayerBySteamID gets a player by steam ID, in any format
 func (s *Store) GetPlayerBySteamID(ctx context.Context, steamID string) (*Player, error) {
+	steamID, err := steamid.Normalize(steamID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to normalize steam ID: %w", err)
+	}
+
 	var player Player
 
-	err := s.db.QueryRowContext(ctx, `
+	err = s.db.QueryRowContext(ctx, `
 		SELECT id, steam_id, name, created_at, updated_at, last_seen,
 		       mmr, peak_mmr, mmr_updated_at,
 		       total_kills, total_deaths, total_assists,
@@ -196,15 +249,17 @@ type Match struct {
 	CreatedAt time.Time
 }
 
-// CreateMatch creates a new match
-func (s *Store) CreateMatch(ctx context.Context, serverIP, mapName, gamemode string, startedAt time.Time) (*Match, error) {
+// CreateMatch creates a new match. A match started by an event (startEventID
+// non-zero) is created once; repeating the event returns the same match.
+func (s *Store) CreateMatch(ctx context.Context, serverIP, mapName, gamemode string, startedAt time.Time, startEventID int64) (*Match, error) {
 	var match Match
 
 	err := s.db.QueryRowContext(ctx, `
-		INSERT INTO matches (server_ip, map, gamemode, started_at)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO matches (server_ip, map, gamemode, started_at, start_event_id)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (start_event_id) DO UPDATE SET start_event_id = EXCLUDED.start_event_id
 		RETURNING id, uuid, server_ip, map, gamemode, started_at, created_at
-	`, serverIP, mapName, gamemode, startedAt).Scan(
+	`, serverIP, mapName, gamemode, startedAt, sql.NullInt64{Int64: startEventID, Valid: startEventID != 0}).Scan(
 		&match.ID, &match.UUID, &match.ServerIP, &match.Map, &match.Gamemode,
 		&match.StartedAt, &match.CreatedAt,
 	)
@@ -245,7 +300,7 @@ func (s *Store) GetOrCreateActiveMatch(ctx context.Context, serverIP, mapName, g
 	}
 
 	// Create new match
-	return s.CreateMatch(ctx, serverIP, mapName, gamemode, time.Now())
+	return s.CreateMatch(ctx, serverIP, mapName, gamemode, time.Now(), 0)
 }
 
 // EndMatch marks a match as ended
@@ -267,25 +322,123 @@ func (s *Store) EndMatch(ctx context.Context, matchID int64, winnerTeam, redScor
 	return nil
 }
 
+// CloseOpenMatches ends every match still open on a server at endedAt,
+// without a winner. It returns how many matches were closed.
+func (s *Store) CloseOpenMatches(ctx context.Context, serverIP string, endedAt time.Time) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE matches
+		SET ended_at = GREATEST(started_at, $2),
+		    duration_seconds = EXTRACT(EPOCH FROM (GREATEST(started_at, $2) - started_at))::INTEGER
+		WHERE server_ip = $1 AND ended_at IS NULL
+	`, serverIP, endedAt)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to close open matches: %w", err)
+	}
+
+	closed, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count closed matches: %w", err)
+	}
+
+	return closed, nil
+}
+
+// ============================================================================
+// PLAYER SESSIONS
+// ============================================================================
+
+// RecordPlayerSpawn opens a session for a player on a server, or counts the
+// spawn on the session that is already open
+func (s *Store) RecordPlayerSpawn(ctx context.Context, playerID int64, serverIP string, spawnedAt time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO player_sessions (player_id, server_ip, started_at, last_spawn_at)
+		VALUES ($1, $2, $3, $3)
+		ON CONFLICT (player_id, server_ip) WHERE ended_at IS NULL DO UPDATE
+		SET spawns = player_sessions.spawns + 1,
+		    last_spawn_at = GREATEST(player_sessions.last_spawn_at, EXCLUDED.last_spawn_at)
+	`, playerID, serverIP, spawnedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to record player spawn: %w", err)
+	}
+
+	return nil
+}
+
+// EndPlayerSession closes a player's open session on a server. It reports
+// whether a session was open.
+func (s *Store) EndPlayerSession(ctx context.Context, playerID int64, serverIP string, endedAt time.Time, reason string) (bool, error) {
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE player_sessions
+		SET ended_at = GREATEST(last_spawn_at, $3),
+		    duration_seconds = EXTRACT(EPOCH FROM (GREATEST(last_spawn_at, $3) - started_at))::INTEGER,
+		    end_reason = NULLIF($4, '')
+		WHERE player_id = $1 AND server_ip = $2 AND ended_at IS NULL
+	`, playerID, serverIP, endedAt, reason)
+
+	if err != nil {
+		return false, fmt.Errorf("failed to end player session: %w", err)
+	}
+
+	ended, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to count ended sessions: %w", err)
+	}
+
+	return ended > 0, nil
+}
+
+// ClosePlayerSessions ends every session still open on a server at endedAt.
+// It returns how many sessions were closed.
+func (s *Store) ClosePlayerSessions(ctx context.Context, serverIP string, endedAt time.Time, reason string) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE player_sessions
+		SET ended_at = GREATEST(last_spawn_at, $2),
+		    duration_seconds = EXTRACT(EPOCH FROM (GREATEST(last_spawn_at, $2) - started_at))::INTEGER,
+		    end_reason = NULLIF($3, '')
+		WHERE server_ip = $1 AND ended_at IS NULL
+	`, serverIP, endedAt, reason)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to close player sessions: %w", err)
+	}
+
+	closed, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count closed sessions: %w", err)
+	}
+
+	return closed, nil
+}
+
 // ============================================================================
 // EVENTS
 // ============================================================================
 
-// InsertRawEvent inserts a raw event into the events table
-func (s *Store) InsertRawEvent(ctx context.Context, eventType string, timestamp time.Time, serverIP, gamemode string, payload json.RawMessage) (int64, error) {
+// InsertRawEvent inserts a raw event into the events table, once per event
+// key. For an event that is already stored it returns the existing ID and
+// whether the event was processed.
+//
+// The no-op update makes a conflicting insert wait for the transaction that
+// inserted the key and return its row, even if that transaction committed
+// after this statement started; a plain SELECT would not see the row.
+func (s *Store) InsertRawEvent(ctx context.Context, eventKey, eventType string, timestamp time.Time, serverIP, gamemode string, payload json.RawMessage) (int64, bool, error) {
 	var eventID int64
+	var processed bool
 
 	err := s.db.QueryRowContext(ctx, `
-		INSERT INTO events (event_type, timestamp, server_ip, gamemode, payload)
-		VALUES ($1, $2, $3, $4, $5)
-		RETURNING id
-	`, eventType, timestamp, serverIP, gamemode, payload).Scan(&eventID)
+		INSERT INTO events (event_key, event_type, timestamp, server_ip, gamemode, payload)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (event_key) DO UPDATE SET event_key = EXCLUDED.event_key
+		RETURNING id, processed
+	`, eventKey, eventType, timestamp, serverIP, gamemode, payload).Scan(&eventID, &processed)
 
 	if err != nil {
-		return 0, fmt.Errorf("failed to insert event: %w", err)
+		return 0, false, fmt.Errorf("failed to insert event: %w", err)
 	}
 
-	return eventID, nil
+	return eventID, processed, nil
 }
 
 // MarkEventProcessed marks an event as processed
@@ -296,11 +449,288 @@ func (s *Store) MarkEventProcessed(ctx context.Context, eventID int64) error {
 	return err
 }
 
+// ============================================================================
+// SERVER VERSIONS
+// ============================================================================
+
+// ServerVersion counts the events a server sent with one plugin and schema version
+type ServerVersion struct {
+	ServerIP      string    `json:"server_ip"`
+	PluginVersion string    `json:"plugin_version"`
+	SchemaVersion int       `json:"schema_version"`
+	Events        int64     `json:"events"`
+	FirstSeen     time.Time `json:"first_seen"`
+	LastSeen      time.Time `json:"last_seen"`
+}
+
+// RecordServerVersion counts an event a server sent with a plugin and schema version
+func (s *Store) RecordServerVersion(ctx context.Context, serverIP, pluginVersion string, schemaVersion int, seenAt time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO server_versions (server_ip, plugin_version, schema_version, events, first_seen, last_seen)
+		VALUES ($1, $2, $3, 1, $4, $4)
+		ON CONFLICT (server_ip, plugin_version, schema_version) DO UPDATE
+		SET events = server_versions.events + 1,
+		    first_seen = LEAST(server_versions.first_seen, EXCLUDED.first_seen),
+		    last_seen = GREATEST(server_versions.last_seen, EXCLUDED.last_seen)
+	`, serverIP, pluginVersion, schemaVersion, seenAt)
+	if err != nil {
+		return fmt.Errorf("failed to record server version: %w", err)
+	}
+	return nil
+}
+
+// GetServerVersions gets the versions seen per server, most recent first,
+// optionally for one server
+func (s *Store) GetServerVersions(ctx context.Context, serverIP string) ([]*ServerVersion, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT server_ip, plugin_version, schema_version, events, first_seen, last_seen
+		FROM server_versions
+		WHERE $1 = '' OR server_ip = $1
+		ORDER BY server_ip, last_seen DESC
+	`, serverIP)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query server versions: %w", err)
+	}
+	defer rows.Close()
+
+	var versions []*ServerVersion
+	for rows.Next() {
+		var v ServerVersion
+		if err := rows.Scan(&v.ServerIP, &v.PluginVersion, &v.SchemaVersion, &v.Events, &v.FirstSeen, &v.LastSeen); err != nil {
+			return nil, fmt.Errorf("failed to scan server version: %w", err)
+		}
+		versions = append(versions, &v)
+	}
+
+	return versions, rows.Err()
+}
+
+// ============================================================================
+// INVALID EVENTS
+// ============================================================================
+
+// InvalidEvent is a payload rejected by the collector's validation
+type InvalidEvent struct {
+	ID         int64     `json:"id"`
+	ServerIP   string    `json:"server_ip"`
+	ServerID   string    `json:"server_id,omitempty"`
+	Source     string    `json:"source"`
+	EventType  string    `json:"event_type,omitempty"`
+	Reason     string    `json:"reason"`
+	Payload    []byte    `json:"payload"`
+	ReceivedAt time.Time `json:"received_at"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// InsertInvalidEvent stores a rejected payload
+func (s *Store) InsertInvalidEvent(ctx context.Context, event *InvalidEvent) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO invalid_events (server_ip, server_id, source, event_type, reason, payload, received_at)
+		VALUES ($1, NULLIF($2, ''), $3, NULLIF($4, ''), $5, $6, $7)
+	`, event.ServerIP, event.ServerID, event.Source, event.EventType, event.Reason, event.Payload, event.ReceivedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert invalid event: %w", err)
+	}
+	return nil
+}
+
+// GetInvalidEvents gets the most recent rejected payloads, optionally for one server
+func (s *Store) GetInvalidEvents(ctx context.Context, serverIP string, limit, offset int) ([]*InvalidEvent, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, server_ip, COALESCE(server_id, ''), source, COALESCE(event_type, ''),
+		       reason, payload, received_at, created_at
+		FROM invalid_events
+		WHERE $1 = '' OR server_ip = $1
+		ORDER BY received_at DESC
+		LIMIT $2 OFFSET $3
+	`, serverIP, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query invalid events: %w", err)
+	}
+	defer rows.Close()
+
+	var invalid []*InvalidEvent
+	for rows.Next() {
+		var e InvalidEvent
+		err := rows.Scan(
+			&e.ID, &e.ServerIP, &e.ServerID, &e.Source, &e.EventType,
+			&e.Reason, &e.Payload, &e.ReceivedAt, &e.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan invalid event: %w", err)
+		}
+		invalid = append(invalid, &e)
+	}
+
+	return invalid, rows.Err()
+}
+
+// ============================================================================
+// POISON MESSAGES
+// ============================================================================
+
+// Poison message statuses
+const (
+	PoisonQuarantined = "quarantined"
+	PoisonRequeued    = "requeued"
+	PoisonDiscarded   = "discarded"
+)
+
+// PoisonMessage is a message the processor gave up on after its last attempt
+type PoisonMessage struct {
+	ID            int64             `json:"id"`
+	MessageUUID   string            `json:"message_uuid"`
+	Topic         string            `json:"topic"`
+	Payload       []byte            `json:"payload"`
+	Metadata      map[string]string `json:"metadata"`
+	ErrorChain    []string          `json:"error_chain"`
+	Attempts      int               `json:"attempts"`
+	Status        string            `json:"status"`
+	QuarantinedAt time.Time         `json:"quarantined_at"`
+	ResolvedAt    *time.Time        `json:"resolved_at,omitempty"`
+}
+
+// InsertPoisonMessage quarantines a message and returns its ID
+func (s *Store) InsertPoisonMessage(ctx context.Context, msg *PoisonMessage) (int64, error) {
+	metadata, err := json.Marshal(msg.Metadata)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode metadata: %w", err)
+	}
+	errorChain, err := json.Marshal(msg.ErrorChain)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode error chain: %w", err)
+	}
+
+	var id int64
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO poison_messages (message_uuid, topic, payload, metadata, error_chain, attempts)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`, msg.MessageUUID, msg.Topic, msg.Payload, metadata, errorChain, msg.Attempts).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert poison message: %w", err)
+	}
+
+	return id, nil
+}
+
+// GetPoisonMessages gets poison messages, newest first, optionally filtered by
+// status and topic
+func (s *Store) GetPoisonMessages(ctx context.Context, status, topic string, limit, offset int) ([]*PoisonMessage, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, message_uuid, topic, payload, metadata, error_chain, attempts,
+		       status, quarantined_at, resolved_at
+		FROM poison_messages
+		WHERE ($1 = '' OR status = $1) AND ($2 = '' OR topic = $2)
+		ORDER BY quarantined_at DESC
+		LIMIT $3 OFFSET $4
+	`, status, topic, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query poison messages: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []*PoisonMessage
+	for rows.Next() {
+		msg, err := scanPoisonMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages, rows.Err()
+}
+
+// GetPoisonMessage gets a poison message by ID
+func (s *Store) GetPoisonMessage(ctx context.Context, id int64) (*PoisonMessage, error) {
+	row := s.db.QueryRowContext(ctx, `
+		SELECT id, message_uuid, topic, payload, metadata, error_chain, attempts,
+		       status, quarantined_at, resolved_at
+		FROM poison_messages
+		WHERE id = $1
+	`, id)
+
+	msg, err := scanPoisonMessage(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("poison message %d not found", id)
+	}
+	return msg, err
+}
+
+// scanPoisonMessage scans a poison message row
+func scanPoisonMessage(row interface{ Scan(...interface{}) error }) (*PoisonMessage, error) {
+	var msg PoisonMessage
+	var metadata, errorChain []byte
+
+	err := row.Scan(
+		&msg.ID, &msg.MessageUUID, &msg.Topic, &msg.Payload, &metadata, &errorChain,
+		&msg.Attempts, &msg.Status, &msg.QuarantinedAt, &msg.ResolvedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan poison message: %w", err)
+	}
+
+	if err := json.Unmarshal(metadata, &msg.Metadata); err != nil {
+		return nil, fmt.Errorf("failed to decode metadata: %w", err)
+	}
+	if err := json.Unmarshal(errorChain, &msg.ErrorChain); err != nil {
+		return nil, fmt.Errorf("failed to decode error chain: %w", err)
+	}
+
+	return &msg, nil
+}
+
+// UpdatePoisonPayload replaces the payload of a quarantined message, so it can
+// be fixed before it is requeued
+func (s *Store) UpdatePoisonPayload(ctx context.Context, id int64, payload []byte) error {
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE poison_messages
+		SET payload = $2
+		WHERE id = $1 AND status = 'quarantined'
+	`, id, payload)
+	if err != nil {
+		return fmt.Errorf("failed to update poison message: %w", err)
+	}
+
+	return expectOneRow(result, id)
+}
+
+// ResolvePoisonMessage marks a quarantined message as requeued or discarded
+func (s *Store) ResolvePoisonMessage(ctx context.Context, id int64, status string) error {
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE poison_messages
+		SET status = $2, resolved_at = NOW()
+		WHERE id = $1 AND status = 'quarantined'
+	`, id, status)
+	if err != nil {
+		return fmt.Errorf("failed to resolve poison message: %w", err)
+	}
+
+	return expectOneRow(result, id)
+}
+
+// expectOneRow checks that an update hit the quarantined poison message
+func expectOneRow(result sql.Result, id int64) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to count updated rows: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("poison message %d not found or not quarantined", id)
+	}
+	return nil
+}
+
 // ============================================================================
 // KILLS
 // ============================================================================
 
-// InsertKill inserts a kill event
+// InsertKill inserts a kill event. A kill already stored for the event is
+// left alone, so its player stats are counted once.
 func (s *Store) InsertKill(ctx context.Context, kill *events.KillEvent, eventID, matchID int64) error {
 	// Get or create players
 	killer, err := s.GetOrCreatePlayer(ctx, kill.Killer.SteamID, kill.Killer.Name)
@@ -331,6 +761,7 @@ func (s *Store) InsertKill(ctx context.Context, kill *events.KillEvent, eventID,
 			victim_pos_x, victim_pos_y, victim_pos_z,
 			timestamp
 		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)
+		ON CONFLICT (event_id) DO NOTHING
 	`,
 		eventID, matchID, killer.ID, victim.ID, assisterID,
 		kill.Weapon.Name, kill.Weapon.ItemDefIndex, kill.Crit, kill.Airborne,
@@ -347,7 +778,7 @@ func (s *Store) InsertKill(ctx context.Context, kill *events.KillEvent, eventID,
 // AIRSHOTS
 // ============================================================================
 
-// InsertAirshot inserts an airshot event
+// InsertAirshot inserts an airshot event, once per event
 func (s *Store) InsertAirshot(ctx context.Context, airshot *events.AirshotEvent, eventID, matchID int64) error {
 	player, err := s.GetOrCreatePlayer(ctx, airshot.Player.SteamID, airshot.Player.Name)
 	if err != nil {
@@ -362,6 +793,7 @@ func (s *Store) InsertAirshot(ctx context.Context, airshot *events.AirshotEvent,
 	_, err = s.db.ExecContext(ctx, `
 		INSERT INTO airshots (event_id, match_id, player_id, victim_id, weapon_type, air2air, timestamp)
 		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (event_id) DO NOTHING
 	`, eventID, matchID, player.ID, victim.ID, airshot.WeaponType, airshot.Air2Air, airshot.Timestamp)
 
 	return err
@@ -371,7 +803,7 @@ func (s *Store) InsertAirshot(ctx context.Context, airshot *events.AirshotEvent,
 // DEFLECTS
 // ============================================================================
 
-// InsertDeflect inserts a deflect event
+// InsertDeflect inserts a deflect event, once per event
 func (s *Store) InsertDeflect(ctx context.Context, deflect *events.DeflectEvent, eventID, matchID int64) error {
 	player, err := s.GetOrCreatePlayer(ctx, deflect.Player.SteamID, deflect.Player.Name)
 	if err != nil {
@@ -392,6 +824,7 @@ func (s *Store) InsertDeflect(ctx context.Context, deflect *events.DeflectEvent,
 			event_id, match_id, player_id, owner_id, projectile_type,
 			rocket_speed, deflect_angle, timing_ms, distance, timestamp
 		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (event_id) DO NOTHING
 	`, eventID, matchID, player.ID, ownerID, deflect.ProjectileType,
 		floatPtr(deflect.RocketSpeed), floatPtr(deflect.DeflectAngle),
 		intPtr(deflect.TimingMs), floatPtr(deflect.Distance), deflect.Timestamp)
@@ -0,0 +1,226 @@
+-- UnitedStats migration 001: normalize players.steam_id to SteamID64
+--
+-- Servers that sent SteamID2 (STEAM_0:1:123) or SteamID3 ([U:1:247]) IDs
+-- created a separate player for each format. This migration rewrites every
+-- steam_id as a SteamID64 and merges the players that turn out to be the same
+-- account into the oldest of them:
+--
+--   * kills, airshots, deflects and player_sessions (if it exists) are
+--     moved to it
+--   * match_players rows of the same match are summed into one row
+--   * the summary stats are summed; the name, avatar and MMR of the most
+--     recently seen/rated duplicate win; peak MMR is the highest
+--
+-- IDs that are not SteamIDs (bots, STEAM_ID_PENDING, junk) are left as they
+-- are. List them afterwards with:
+--
+--   SELECT id, steam_id, name FROM players WHERE steam_id !~ '^7656119[0-9]{10}$';
+--
+-- Databases created from schema.sql after the processor started normalizing
+-- IDs need not run it. Run it once, while the processor is stopped:
+--
+--   psql "$DATABASE_URL" -f migrations/001_normalize_steam_ids.sql
+
+BEGIN;
+
+-- ============================================================================
+-- STEAMID64 OF EVERY PLAYER
+-- ============================================================================
+
+CREATE TEMP TABLE steam_id64s ON COMMIT DROP AS
+SELECT id, account_id64::TEXT AS steam_id64
+FROM (
+    SELECT id,
+           CASE
+               -- STEAM_X:Y:Z is account Z*2+Y
+               WHEN steam_id ~ '^STEAM_[01]:[01]:[0-9]{1,10}$' THEN
+                   76561197960265728
+                   + split_part(steam_id, ':', 3)::BIGINT * 2
+                   + split_part(steam_id, ':', 2)::BIGINT
+               -- [U:1:N] is account N
+               WHEN steam_id ~ '^\[U:1:[0-9]{1,10}\]$' THEN
+                   76561197960265728
+                   + substring(steam_id FROM '^\[U:1:([0-9]+)\]$')::BIGINT
+               WHEN steam_id ~ '^7656119[0-9]{10}$' THEN
+                   steam_id::BIGINT
+           END AS account_id64
+    FROM players
+) ids
+-- Account 0 is unassigned; accounts above 2^32-1 do not exist
+WHERE account_id64 > 76561197960265728
+  AND account_id64 <= 76561202255233023;
+
+-- ============================================================================
+-- DUPLICATES
+-- ============================================================================
+
+-- Every player of an account with more than one player, and the oldest
+-- player of that account, which the others are merged into
+CREATE TEMP TABLE player_merges ON COMMIT DROP AS
+SELECT id AS player_id, keeper_id
+FROM (
+    SELECT id,
+           MIN(id) OVER (PARTITION BY steam_id64) AS keeper_id,
+           COUNT(*) OVER (PARTITION BY steam_id64) AS players
+    FROM steam_id64s
+) accounts
+WHERE players > 1;
+
+-- ============================================================================
+-- MATCH PLAYERS
+-- ============================================================================
+
+-- The rows of one account in one match are summed into the first of them
+CREATE TEMP TABLE match_player_merges ON COMMIT DROP AS
+SELECT mp.id,
+       pm.keeper_id,
+       MIN(mp.id) OVER (PARTITION BY mp.match_id, pm.keeper_id) AS survivor_id
+FROM match_players mp
+JOIN player_merges pm ON pm.player_id = mp.player_id;
+
+UPDATE match_players s
+SET kills = t.kills,
+    deaths = t.deaths,
+    assists = t.assists,
+    damage_dealt = t.damage_dealt,
+    healing_done = t.healing_done,
+    airshots = t.airshots,
+    headshots = t.headshots,
+    backstabs = t.backstabs,
+    deflects = t.deflects
+FROM (
+    SELECT m.survivor_id,
+           SUM(mp.kills) AS kills,
+           SUM(mp.deaths) AS deaths,
+           SUM(mp.assists) AS assists,
+           SUM(mp.damage_dealt) AS damage_dealt,
+           SUM(mp.healing_done) AS healing_done,
+           SUM(mp.airshots) AS airshots,
+           SUM(mp.headshots) AS headshots,
+           SUM(mp.backstabs) AS backstabs,
+           SUM(mp.deflects) AS deflects
+    FROM match_player_merges m
+    JOIN match_players mp ON mp.id = m.id
+    GROUP BY m.survivor_id
+) t
+WHERE s.id = t.survivor_id;
+
+DELETE FROM match_players
+WHERE id IN (SELECT id FROM match_player_merges WHERE id <> survivor_id);
+
+UPDATE match_players mp
+SET player_id = m.keeper_id
+FROM match_player_merges m
+WHERE mp.id = m.id AND m.id = m.survivor_id;
+
+-- ============================================================================
+-- PLAYER SESSIONS
+-- ============================================================================
+
+-- Databases created before player_sessions do not have it; migration 006
+-- creates it and may run before or after this one
+DO $$
+BEGIN
+    IF to_regclass('player_sessions') IS NOT NULL THEN
+        -- An account may have one open session per server; close all but the latest
+        UPDATE player_sessions s
+        SET ended_at = s.last_spawn_at,
+            duration_seconds = EXTRACT(EPOCH FROM (s.last_spawn_at - s.started_at))::INTEGER,
+            end_reason = 'merged'
+        FROM (
+            SELECT ps.id,
+                   ROW_NUMBER() OVER (PARTITION BY pm.keeper_id, ps.server_ip ORDER BY ps.last_spawn_at DESC, ps.id DESC) AS latest
+            FROM player_sessions ps
+            JOIN player_merges pm ON pm.player_id = ps.player_id
+            WHERE ps.ended_at IS NULL
+        ) open_sessions
+        WHERE s.id = open_sessions.id AND open_sessions.latest > 1;
+
+        UPDATE player_sessions s
+        SET player_id = pm.keeper_id
+        FROM player_merges pm
+        WHERE s.player_id = pm.player_id AND pm.player_id <> pm.keeper_id;
+    END IF;
+END $$;
+
+-- ============================================================================
+-- EVENT RECORDS
+-- ============================================================================
+
+UPDATE kills k SET killer_id = pm.keeper_id
+FROM player_merges pm WHERE k.killer_id = pm.player_id AND pm.player_id <> pm.keeper_id;
+
+UPDATE kills k SET victim_id = pm.keeper_id
+FROM player_merges pm WHERE k.victim_id = pm.player_id AND pm.player_id <> pm.keeper_id;
+
+UPDATE kills k SET assister_id = pm.keeper_id
+FROM player_merges pm WHERE k.assister_id = pm.player_id AND pm.player_id <> pm.keeper_id;
+
+UPDATE airshots a SET player_id = pm.keeper_id
+FROM player_merges pm WHERE a.player_id = pm.player_id AND pm.player_id <> pm.keeper_id;
+
+UPDATE airshots a SET victim_id = pm.keeper_id
+FROM player_merges pm WHERE a.victim_id = pm.player_id AND pm.player_id <> pm.keeper_id;
+
+UPDATE deflects d SET player_id = pm.keeper_id
+FROM player_merges pm WHERE d.player_id = pm.player_id AND pm.player_id <> pm.keeper_id;
+
+UPDATE deflects d SET owner_id = pm.keeper_id
+FROM player_merges pm WHERE d.owner_id = pm.player_id AND pm.player_id <> pm.keeper_id;
+
+-- ============================================================================
+-- PLAYERS
+-- ============================================================================
+
+UPDATE players k
+SET name = t.name,
+    created_at = t.created_at,
+    last_seen = t.last_seen,
+    mmr = t.mmr,
+    peak_mmr = t.peak_mmr,
+    mmr_updated_at = t.mmr_updated_at,
+    total_kills = t.total_kills,
+    total_deaths = t.total_deaths,
+    total_assists = t.total_assists,
+    total_airshots = t.total_airshots,
+    total_headshots = t.total_headshots,
+    total_backstabs = t.total_backstabs,
+    total_deflects = t.total_deflects,
+    avatar_url = t.avatar_url,
+    country_code = t.country_code
+FROM (
+    SELECT pm.keeper_id,
+           (ARRAY_AGG(p.name ORDER BY p.last_seen DESC NULLS LAST))[1] AS name,
+           MIN(p.created_at) AS created_at,
+           MAX(p.last_seen) AS last_seen,
+           (ARRAY_AGG(p.mmr ORDER BY p.mmr_updated_at DESC NULLS LAST))[1] AS mmr,
+           MAX(p.peak_mmr) AS peak_mmr,
+           MAX(p.mmr_updated_at) AS mmr_updated_at,
+           SUM(p.total_kills) AS total_kills,
+           SUM(p.total_deaths) AS total_deaths,
+           SUM(p.total_assists) AS total_assists,
+           SUM(p.total_airshots) AS total_airshots,
+           SUM(p.total_headshots) AS total_headshots,
+           SUM(p.total_backstabs) AS total_backstabs,
+           SUM(p.total_deflects) AS total_deflects,
+           (ARRAY_AGG(p.avatar_url ORDER BY p.avatar_url IS NULL, p.last_seen DESC NULLS LAST))[1] AS avatar_url,
+           (ARRAY_AGG(p.country_code ORDER BY p.country_code IS NULL, p.last_seen DESC NULLS LAST))[1] AS country_code
+    FROM players p
+    JOIN player_merges pm ON pm.player_id = p.id
+    GROUP BY pm.keeper_id
+) t
+WHERE k.id = t.keeper_id;
+
+-- Nothing references the duplicates any more
+DELETE FROM players p
+USING player_merges pm
+WHERE p.id = pm.player_id AND pm.player_id <> pm.keeper_id;
+
+UPDATE players p
+SET steam_id = s.steam_id64
+FROM steam_id64s s
+WHERE p.id = s.id AND p.steam_id <> s.steam_id64;
+
+REFRESH MATERIALIZED VIEW leaderboard;
+
+COMMIT;
@@ -0,0 +1,79 @@
+-- UnitedStats migration 002: deduplicate events by event_key
+--
+-- The processor stores each event once, under a key derived from the plugin's
+-- event_id, and records a kill, airshot, deflect or match start once per
+-- event. This migration adds the columns and constraints it relies on to a
+-- database created before that:
+--
+--   * events.event_key, backfilled and made UNIQUE NOT NULL
+--   * matches.start_event_id
+--   * UNIQUE event_id on kills, airshots and deflects
+--
+-- Events are keyed like the processor keys them: by their event_id, hashed if
+-- it is longer than 64 bytes. Events without an event_id are keyed by a hash
+-- of their stored payload, which is not the hash the processor derives, so
+-- such an event that is sent again afterwards is stored again. Events that
+-- were already stored twice keep both rows; the later copies get a key of
+-- their own.
+--
+-- Adding the UNIQUE event_id constraints fails, and the migration rolls back,
+-- if an event was recorded twice. Find such events with:
+--
+--   SELECT event_id, COUNT(*) FROM kills GROUP BY event_id HAVING COUNT(*) > 1;
+--
+-- (and likewise for airshots and deflects). Databases created from schema.sql
+-- after the processor started deduplicating events need not run it. Run it
+-- once, while the processor is stopped, before starting the new processor:
+--
+--   psql "$DATABASE_URL" -f migrations/002_add_event_keys.sql
+
+BEGIN;
+
+-- ============================================================================
+-- EVENTS
+-- ============================================================================
+
+ALTER TABLE events ADD COLUMN event_key VARCHAR(64);
+
+UPDATE events e
+SET event_key = k.event_key
+FROM (
+    SELECT id,
+           CASE
+               WHEN ROW_NUMBER() OVER (PARTITION BY base_key ORDER BY id) = 1 THEN base_key
+               -- A copy of an event stored before deduplication
+               ELSE encode(sha256(convert_to(base_key || ':' || id, 'UTF8')), 'hex')
+           END AS event_key
+    FROM (
+        SELECT id,
+               CASE
+                   WHEN COALESCE(payload->>'event_id', '') = '' THEN
+                       encode(sha256(convert_to(payload::TEXT, 'UTF8')), 'hex')
+                   WHEN octet_length(payload->>'event_id') <= 64 THEN
+                       payload->>'event_id'
+                   ELSE
+                       encode(sha256(convert_to(payload->>'event_id', 'UTF8')), 'hex')
+               END AS base_key
+        FROM events
+    ) keyed
+) k
+WHERE e.id = k.id;
+
+ALTER TABLE events ALTER COLUMN event_key SET NOT NULL;
+ALTER TABLE events ADD CONSTRAINT events_event_key_key UNIQUE (event_key);
+
+-- ============================================================================
+-- EVENT RECORDS
+-- ============================================================================
+
+-- events references matches, so this is not a foreign key
+ALTER TABLE matches ADD COLUMN start_event_id BIGINT;
+ALTER TABLE matches ADD CONSTRAINT matches_start_event_id_key UNIQUE (start_event_id);
+
+ALTER TABLE kills ADD CONSTRAINT kills_event_id_key UNIQUE (event_id);
+ALTER TABLE airshots ADD CONSTRAINT airshots_event_id_key UNIQUE (event_id);
+ALTER TABLE deflects ADD CONSTRAINT deflects_event_id_key UNIQUE (event_id);
+
+COMMENT ON TABLE events IS 'Raw event log from game servers, one row per event (see event_key)';
+
+COMMIT;
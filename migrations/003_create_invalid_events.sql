@@ -0,0 +1,39 @@
+-- UnitedStats migration 003: create invalid_events
+--
+-- The processor stores the payloads the collector rejects, and the reason it
+-- rejected them, in invalid_events. This migration creates the table in a
+-- database created before that. It does nothing if the table exists, so
+-- databases created from schema.sql may run it too. Run it once, while the
+-- processor is stopped, before starting the new processor:
+--
+--   psql "$DATABASE_URL" -f migrations/003_create_invalid_events.sql
+
+BEGIN;
+
+-- ============================================================================
+-- INVALID EVENTS (Dead-lettered by the collector)
+-- ============================================================================
+
+CREATE TABLE IF NOT EXISTS invalid_events (
+    id BIGSERIAL PRIMARY KEY,
+    
+    -- Server the payload came from (verified ID, claimed server_ip or source IP)
+    server_ip VARCHAR(45) NOT NULL,
+    server_id VARCHAR(45),
+    source VARCHAR(64) NOT NULL,
+    
+    event_type VARCHAR(32),
+    reason TEXT NOT NULL,
+    
+    -- Raw bytes as received
+    payload BYTEA NOT NULL,
+    
+    received_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_invalid_events_server ON invalid_events(server_ip, received_at DESC);
+
+COMMENT ON TABLE invalid_events IS 'Payloads rejected by collector validation';
+
+COMMIT;
@@ -0,0 +1,40 @@
+-- UnitedStats migration 004: create poison_messages
+--
+-- The processor quarantines messages it gave up on in poison_messages, and the
+-- quarantine command lists, fixes and requeues them from there. This migration
+-- creates the table in a database created before that. It does nothing if the
+-- table exists, so databases created from schema.sql may run it too. Run it
+-- once, while the processor is stopped, before starting the new processor:
+--
+--   psql "$DATABASE_URL" -f migrations/004_create_poison_messages.sql
+
+BEGIN;
+
+-- ============================================================================
+-- POISON MESSAGES (Messages the processor gave up on)
+-- ============================================================================
+
+CREATE TABLE IF NOT EXISTS poison_messages (
+    id BIGSERIAL PRIMARY KEY,
+    
+    -- Original message
+    message_uuid VARCHAR(64) NOT NULL,
+    topic VARCHAR(64) NOT NULL,
+    payload BYTEA NOT NULL,
+    metadata JSONB NOT NULL DEFAULT '{}',
+    
+    -- Why processing failed, outermost error first
+    error_chain JSONB NOT NULL DEFAULT '[]',
+    attempts INTEGER NOT NULL,
+    
+    -- quarantined, requeued or discarded
+    status VARCHAR(16) NOT NULL DEFAULT 'quarantined',
+    quarantined_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    resolved_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_poison_messages_status ON poison_messages(status, quarantined_at DESC);
+
+COMMENT ON TABLE poison_messages IS 'Messages quarantined after the processor exhausted its retries';
+
+COMMIT;
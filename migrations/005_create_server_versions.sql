@@ -0,0 +1,33 @@
+-- UnitedStats migration 005: create server_versions
+--
+-- The processor counts the plugin and payload schema versions each server
+-- sends in server_versions. This migration creates the table in a database
+-- created before that. It does nothing if the table exists, so databases
+-- created from schema.sql may run it too. Run it once, while the processor is
+-- stopped, before starting the new processor:
+--
+--   psql "$DATABASE_URL" -f migrations/005_create_server_versions.sql
+
+BEGIN;
+
+-- ============================================================================
+-- SERVER VERSIONS (Plugin and schema versions each server sends)
+-- ============================================================================
+
+CREATE TABLE IF NOT EXISTS server_versions (
+    server_ip VARCHAR(45) NOT NULL,
+    
+    -- Empty for events from srcds log lines
+    plugin_version VARCHAR(32) NOT NULL DEFAULT '',
+    schema_version INTEGER NOT NULL,
+    
+    events BIGINT NOT NULL DEFAULT 0,
+    first_seen TIMESTAMP WITH TIME ZONE NOT NULL,
+    last_seen TIMESTAMP WITH TIME ZONE NOT NULL,
+    
+    PRIMARY KEY (server_ip, plugin_version, schema_version)
+);
+
+COMMENT ON TABLE server_versions IS 'Plugin and payload schema versions seen per server';
+
+COMMIT;
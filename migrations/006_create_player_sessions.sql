@@ -0,0 +1,38 @@
+-- UnitedStats migration 006: create player_sessions
+--
+-- The processor records the time each player spends on a server, from their
+-- first spawn to their disconnect, in player_sessions. This migration creates
+-- the table and its indexes in a database created before that. It does
+-- nothing if they exist, so databases created from schema.sql may run it too.
+-- It may run before or after migration 001. Run it once, while the processor
+-- is stopped, before starting the new processor:
+--
+--   psql "$DATABASE_URL" -f migrations/006_create_player_sessions.sql
+
+BEGIN;
+
+-- ============================================================================
+-- PLAYER SESSIONS (Time each player spends on a server)
+-- ============================================================================
+
+CREATE TABLE IF NOT EXISTS player_sessions (
+    id BIGSERIAL PRIMARY KEY,
+    player_id BIGINT NOT NULL REFERENCES players(id) ON DELETE CASCADE,
+    server_ip VARCHAR(45) NOT NULL,
+    
+    -- Opened by the first spawn, closed by a disconnect or the server going quiet
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    last_spawn_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    spawns INTEGER NOT NULL DEFAULT 1,
+    ended_at TIMESTAMP WITH TIME ZONE,
+    duration_seconds INTEGER,
+    end_reason TEXT
+);
+
+-- At most one open session per player and server
+CREATE UNIQUE INDEX IF NOT EXISTS idx_player_sessions_open ON player_sessions(player_id, server_ip) WHERE ended_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_player_sessions_player ON player_sessions(player_id, started_at DESC);
+
+COMMENT ON TABLE player_sessions IS 'Time players spend on each server, from spawn to disconnect';
+
+COMMIT;
@@ -73,6 +73,10 @@ const (
 
 	// First blood
 	EventTypeFirstBlood EventType = "first_blood"
+
+	// Server lifecycle events, published by the collector
+	EventTypeServerOnline  EventType = "server_online"
+	EventTypeServerOffline EventType = "server_offline"
 )
 
 // Player represents a player in an event
@@ -132,6 +136,21 @@ type BaseEvent struct {
 	Gamemode  string    `json:"gamemode"`
 	ServerIP  string    `json:"server_ip"`
 	EventType EventType `json:"event_type"`
+
+	// SchemaVersion is the payload schema the event was sent in. The parser
+	// upcasts older payloads to these structs and fills in 1 when the
+	// payload has no version.
+	SchemaVersion int `json:"schema_version,omitempty"`
+	// PluginVersion is the version of the plugin that sent the event
+	PluginVersion string `json:"plugin_version,omitempty"`
+	// EventID identifies the event across retransmissions and redeliveries.
+	// Events without one are identified by a hash of their payload.
+	EventID string `json:"event_id,omitempty"`
+}
+
+// base returns the embedded BaseEvent of a typed event
+func (b *BaseEvent) base() *BaseEvent {
+	return b
 }
 
 // KillEvent represents a player kill
@@ -153,6 +172,34 @@ type KillEvent struct {
 	CustomKill int       `json:"custom_kill,omitempty"`
 }
 
+// AssistEvent represents a player assisting a kill. Assists are also counted
+// from the kill event's assister.
+type AssistEvent struct {
+	BaseEvent
+	Assister    Player    `json:"assister"`
+	Killer      *Player   `json:"killer,omitempty"`
+	Victim      Player    `json:"victim"`
+	AssisterPos *Position `json:"assister_pos,omitempty"`
+}
+
+// DominationEvent represents a player dominating a victim, or taking revenge
+// on a player who dominated them
+type DominationEvent struct {
+	BaseEvent
+	Player Player `json:"player"`
+	Victim Player `json:"victim"`
+	Assist bool   `json:"assist,omitempty"` // Earned with an assist
+}
+
+// SpecialKillEvent represents a headshot, backstab or first blood, sent
+// alongside the kill event
+type SpecialKillEvent struct {
+	BaseEvent
+	Player Player  `json:"player"`
+	Victim Player  `json:"victim"`
+	Weapon *Weapon `json:"weapon,omitempty"`
+}
+
 // AirshotEvent represents various airshot achievements
 type AirshotEvent struct {
 	BaseEvent
@@ -316,6 +363,20 @@ type WeaponStatsEvent struct {
 	Weapon WeaponStatistics `json:"weapon"`
 }
 
+// PlayerSpawnEvent represents a player spawning
+type PlayerSpawnEvent struct {
+	BaseEvent
+	Player    Player    `json:"player"`
+	PlayerPos *Position `json:"player_pos,omitempty"`
+}
+
+// PlayerDisconnectEvent represents a player leaving the server
+type PlayerDisconnectEvent struct {
+	BaseEvent
+	Player Player `json:"player"`
+	Reason string `json:"reason,omitempty"`
+}
+
 // ClassChangeEvent represents a player changing class
 type ClassChangeEvent struct {
 	BaseEvent
@@ -324,12 +385,26 @@ type ClassChangeEvent struct {
 	NewClass string `json:"new_class"`
 }
 
+// ServerStatusEvent reports a server coming online or going quiet. Only the
+// collector publishes it.
+type ServerStatusEvent struct {
+	BaseEvent
+	SourceIP  string    `json:"source_ip"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Events    uint64    `json:"events"`     // events received since first_seen
+	EventRate float64   `json:"event_rate"` // events per second
+}
+
 // Event is a union type for all event types
 type Event struct {
 	Type EventType
 
 	// Combat events
 	Kill        *KillEvent
+	Assist      *AssistEvent
+	Domination  *DominationEvent
+	SpecialKill *SpecialKillEvent
 	Airshot     *AirshotEvent
 	Deflect     *DeflectEvent
 	Stun        *StunEvent
@@ -359,7 +434,82 @@ type Event struct {
 	MVP        *MVPEvent
 
 	// Player events
-	PlayerLoadout *PlayerLoadoutEvent
-	WeaponStats   *WeaponStatsEvent
-	ClassChange   *ClassChangeEvent
+	PlayerLoadout    *PlayerLoadoutEvent
+	WeaponStats      *WeaponStatsEvent
+	ClassChange      *ClassChangeEvent
+	PlayerSpawn      *PlayerSpawnEvent
+	PlayerDisconnect *PlayerDisconnectEvent
+
+	// Server events
+	ServerStatus *ServerStatusEvent
+}
+
+// Body returns the typed event held by the union, or nil if none is set
+func (e *Event) Body() interface{} {
+	switch {
+	case e.Kill != nil:
+		return e.Kill
+	case e.Assist != nil:
+		return e.Assist
+	case e.Domination != nil:
+		return e.Domination
+	case e.SpecialKill != nil:
+		return e.SpecialKill
+	case e.Airshot != nil:
+		return e.Airshot
+	case e.Deflect != nil:
+		return e.Deflect
+	case e.Stun != nil:
+		return e.Stun
+	case e.Jarate != nil:
+		return e.Jarate
+	case e.ShieldBlock != nil:
+		return e.ShieldBlock
+	case e.Jump != nil:
+		return e.Jump
+	case e.JumpKill != nil:
+		return e.JumpKill
+	case e.Teleport != nil:
+		return e.Teleport
+	case e.Building != nil:
+		return e.Building
+	case e.KilledObject != nil:
+		return e.KilledObject
+	case e.Healed != nil:
+		return e.Healed
+	case e.Medic != nil:
+		return e.Medic
+	case e.Buff != nil:
+		return e.Buff
+	case e.Food != nil:
+		return e.Food
+	case e.MatchStart != nil:
+		return e.MatchStart
+	case e.MatchEnd != nil:
+		return e.MatchEnd
+	case e.MVP != nil:
+		return e.MVP
+	case e.PlayerLoadout != nil:
+		return e.PlayerLoadout
+	case e.WeaponStats != nil:
+		return e.WeaponStats
+	case e.ClassChange != nil:
+		return e.ClassChange
+	case e.PlayerSpawn != nil:
+		return e.PlayerSpawn
+	case e.PlayerDisconnect != nil:
+		return e.PlayerDisconnect
+	case e.ServerStatus != nil:
+		return e.ServerStatus
+	default:
+		return nil
+	}
+}
+
+// Base returns the fields common to all events, or nil if none is set
+func (e *Event) Base() *BaseEvent {
+	if body, ok := e.Body().(interface{ base() *BaseEvent }); ok {
+		return body.base()
+	}
+	return nil
 }
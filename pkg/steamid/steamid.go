@@ -0,0 +1,149 @@
+// Package steamid parses Steam account IDs in the SteamID2 (STEAM_0:1:123),
+// SteamID3 ([U:1:247]) and SteamID64 (76561197960265975) formats and converts
+// between them. Players are stored by their SteamID64.
+package steamid
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ID is the SteamID64 of an individual account
+type ID uint64
+
+// individual is the upper 32 bits of an individual account's SteamID64:
+// universe 1 (public), type 1 (individual), instance 1 (desktop)
+const individual = 0x01100001
+
+// Errors returned by Parse. ErrBot and ErrUnassigned wrap ErrInvalid.
+var (
+	ErrInvalid    = errors.New("invalid SteamID")
+	ErrBot        = fmt.Errorf("%w: bot", ErrInvalid)
+	ErrUnassigned = fmt.Errorf("%w: unassigned", ErrInvalid)
+)
+
+// FromAccountID returns the ID of an individual account number
+func FromAccountID(account uint32) ID {
+	return ID(uint64(individual)<<32 | uint64(account))
+}
+
+// Parse parses a SteamID2, SteamID3 or SteamID64 of an individual account.
+// Bots and unassigned IDs (STEAM_ID_PENDING, STEAM_ID_LAN, account 0) are
+// reported as ErrBot and ErrUnassigned.
+func Parse(s string) (ID, error) {
+	s = strings.TrimSpace(s)
+
+	switch strings.ToUpper(s) {
+	case "BOT":
+		return 0, ErrBot
+	case "", "STEAM_ID_PENDING", "STEAM_ID_LAN", "UNKNOWN":
+		return 0, ErrUnassigned
+	}
+
+	var account uint32
+	var err error
+	switch {
+	case strings.HasPrefix(s, "STEAM_"):
+		account, err = parseSteam2(s)
+	case strings.HasPrefix(s, "[U:"):
+		account, err = parseSteam3(s)
+	default:
+		account, err = parseSteam64(s)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if account == 0 {
+		return 0, ErrUnassigned
+	}
+	return FromAccountID(account), nil
+}
+
+// Normalize returns the SteamID64 of an ID in any format
+func Normalize(s string) (string, error) {
+	id, err := Parse(s)
+	if err != nil {
+		return "", err
+	}
+
+	// Most IDs are already SteamID64s; keep those without allocating
+	if len(s) == 17 && isDigits(s) {
+		return s, nil
+	}
+	return id.String(), nil
+}
+
+// AccountID returns the account number, the lower 32 bits of the SteamID64
+func (id ID) AccountID() uint32 {
+	return uint32(id)
+}
+
+// String returns the SteamID64
+func (id ID) String() string {
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+// Steam2 returns the SteamID2, in universe 0 as TF2 prints it
+func (id ID) Steam2() string {
+	account := id.AccountID()
+	return fmt.Sprintf("STEAM_0:%d:%d", account&1, account>>1)
+}
+
+// Steam3 returns the SteamID3
+func (id ID) Steam3() string {
+	return fmt.Sprintf("[U:1:%d]", id.AccountID())
+}
+
+// parseSteam2 parses STEAM_X:Y:Z, whose account number is Z*2+Y. Universe X
+// is 0 in older games and 1 in newer ones; both mean the public universe.
+func parseSteam2(s string) (uint32, error) {
+	parts := strings.Split(strings.TrimPrefix(s, "STEAM_"), ":")
+	if len(parts) != 3 || (parts[0] != "0" && parts[0] != "1") || (parts[1] != "0" && parts[1] != "1") {
+		return 0, fmt.Errorf("%w: %q", ErrInvalid, s)
+	}
+
+	z, err := strconv.ParseUint(parts[2], 10, 31)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalid, s)
+	}
+
+	return uint32(z)<<1 | uint32(parts[1][0]-'0'), nil
+}
+
+// parseSteam3 parses [U:1:N], whose account number is N
+func parseSteam3(s string) (uint32, error) {
+	if !strings.HasPrefix(s, "[U:1:") || !strings.HasSuffix(s, "]") {
+		return 0, fmt.Errorf("%w: %q", ErrInvalid, s)
+	}
+
+	digits := s[len("[U:1:") : len(s)-1]
+	n, err := strconv.ParseUint(digits, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalid, s)
+	}
+
+	return uint32(n), nil
+}
+
+// parseSteam64 parses a SteamID64 of an individual account
+func parseSteam64(s string) (uint32, error) {
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil || n>>32 != individual {
+		return 0, fmt.Errorf("%w: %q", ErrInvalid, s)
+	}
+
+	return uint32(n), nil
+}
+
+// isDigits reports whether s is only ASCII digits
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,105 @@
+package steamid
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestParse tests parsing each format into the same ID
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    ID
+		wantErr error
+	}{
+		{name: "SteamID64", input: "76561197960265975", want: 76561197960265975},
+		{name: "SteamID3", input: "[U:1:247]", want: 76561197960265975},
+		{name: "SteamID2", input: "STEAM_0:1:123", want: 76561197960265975},
+		{name: "SteamID2 universe 1", input: "STEAM_1:1:123", want: 76561197960265975},
+		{name: "Whitespace", input: " [U:1:247]\n", want: 76561197960265975},
+		{name: "Largest account", input: "[U:1:4294967295]", want: 76561202255233023},
+		{name: "Bot", input: "BOT", wantErr: ErrBot},
+		{name: "Pending", input: "STEAM_ID_PENDING", wantErr: ErrUnassigned},
+		{name: "LAN", input: "STEAM_ID_LAN", wantErr: ErrUnassigned},
+		{name: "Empty", input: "", wantErr: ErrUnassigned},
+		{name: "Account 0", input: "[U:1:0]", wantErr: ErrUnassigned},
+		{name: "SteamID64 account 0", input: "76561197960265728", wantErr: ErrUnassigned},
+		{name: "SteamID2 bad Y", input: "STEAM_0:2:123", wantErr: ErrInvalid},
+		{name: "SteamID2 bad universe", input: "STEAM_4:1:123", wantErr: ErrInvalid},
+		{name: "SteamID2 signed", input: "STEAM_0:1:+123", wantErr: ErrInvalid},
+		{name: "SteamID3 game server", input: "[G:1:123]", wantErr: ErrInvalid},
+		{name: "SteamID3 other universe", input: "[U:2:247]", wantErr: ErrInvalid},
+		{name: "SteamID3 too large", input: "[U:1:4294967296]", wantErr: ErrInvalid},
+		{name: "SteamID64 game server", input: "90071996842377216", wantErr: ErrInvalid},
+		{name: "Account number", input: "247", wantErr: ErrInvalid},
+		{name: "Name", input: "Console", wantErr: ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.input)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Parse(%q) error = %v, want %v", tt.input, err, tt.wantErr)
+				}
+				if !errors.Is(err, ErrInvalid) {
+					t.Errorf("Parse(%q) error = %v, does not wrap ErrInvalid", tt.input, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.input, err)
+			}
+			if got != tt.want {
+				t.Errorf("Parse(%q) = %d, want %d", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestFormats tests converting an ID to each format and back
+func TestFormats(t *testing.T) {
+	for _, account := range []uint32{1, 246, 247, 4294967295} {
+		id := FromAccountID(account)
+		if id.AccountID() != account {
+			t.Errorf("AccountID() = %d, want %d", id.AccountID(), account)
+		}
+
+		for _, s := range []string{id.String(), id.Steam2(), id.Steam3()} {
+			parsed, err := Parse(s)
+			if err != nil {
+				t.Errorf("Parse(%q) error = %v", s, err)
+				continue
+			}
+			if parsed != id {
+				t.Errorf("Parse(%q) = %d, want %d", s, parsed, id)
+			}
+		}
+	}
+
+	id := ID(76561197960265975)
+	if got := id.Steam2(); got != "STEAM_0:1:123" {
+		t.Errorf("Steam2() = %q, want STEAM_0:1:123", got)
+	}
+	if got := id.Steam3(); got != "[U:1:247]" {
+		t.Errorf("Steam3() = %q, want [U:1:247]", got)
+	}
+}
+
+// TestNormalize tests that every format normalizes to the SteamID64
+func TestNormalize(t *testing.T) {
+	for _, input := range []string{"76561197960265975", "[U:1:247]", "STEAM_0:1:123", " 76561197960265975 "} {
+		got, err := Normalize(input)
+		if err != nil {
+			t.Fatalf("Normalize(%q) error = %v", input, err)
+		}
+		if got != "76561197960265975" {
+			t.Errorf("Normalize(%q) = %q, want 76561197960265975", input, got)
+		}
+	}
+
+	if _, err := Normalize("BOT"); !errors.Is(err, ErrBot) {
+		t.Errorf("Normalize(BOT) error = %v, want ErrBot", err)
+	}
+}
@@ -10,7 +10,7 @@ CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
 
 CREATE TABLE players (
     id BIGSERIAL PRIMARY KEY,
-    steam_id VARCHAR(32) UNIQUE NOT NULL,
+    steam_id VARCHAR(32) UNIQUE NOT NULL, -- SteamID64 (see pkg/steamid and migrations/001)
     name VARCHAR(64) NOT NULL,
     created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
@@ -66,6 +66,11 @@ CREATE TABLE matches (
     tournament_id BIGINT,
     tournament_match_id BIGINT,
     
+    -- Event that started the match (nullable), so a repeated start event
+    -- does not open a second match. events references matches, so this is
+    -- not a foreign key.
+    start_event_id BIGINT UNIQUE,
+    
     -- Metadata
     created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     
@@ -110,6 +115,28 @@ CREATE TABLE match_players (
     INDEX idx_player_id (player_id)
 );
 
+-- ============================================================================
+-- PLAYER SESSIONS (Time each player spends on a server)
+-- ============================================================================
+
+CREATE TABLE player_sessions (
+    id BIGSERIAL PRIMARY KEY,
+    player_id BIGINT NOT NULL REFERENCES players(id) ON DELETE CASCADE,
+    server_ip VARCHAR(45) NOT NULL,
+    
+    -- Opened by the first spawn, closed by a disconnect or the server going quiet
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    last_spawn_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    spawns INTEGER NOT NULL DEFAULT 1,
+    ended_at TIMESTAMP WITH TIME ZONE,
+    duration_seconds INTEGER,
+    end_reason TEXT
+);
+
+-- At most one open session per player and server
+CREATE UNIQUE INDEX idx_player_sessions_open ON player_sessions(player_id, server_ip) WHERE ended_at IS NULL;
+CREATE INDEX idx_player_sessions_player ON player_sessions(player_id, started_at DESC);
+
 -- ============================================================================
 -- EVENTS (Raw event log)
 -- ============================================================================
@@ -117,6 +144,9 @@ CREATE TABLE match_players (
 CREATE TABLE events (
     id BIGSERIAL PRIMARY KEY,
     
+    -- Deduplication key: the plugin's event_id, or a hash of the payload
+    event_key VARCHAR(64) UNIQUE NOT NULL,
+    
     -- Event metadata
     event_type VARCHAR(32) NOT NULL,
     timestamp TIMESTAMP WITH TIME ZONE NOT NULL,
@@ -141,13 +171,80 @@ CREATE TABLE events (
     INDEX idx_payload_gin (payload) USING GIN
 );
 
+-- ============================================================================
+-- SERVER VERSIONS (Plugin and schema versions each server sends)
+-- ============================================================================
+
+CREATE TABLE server_versions (
+    server_ip VARCHAR(45) NOT NULL,
+    
+    -- Empty for events from srcds log lines
+    plugin_version VARCHAR(32) NOT NULL DEFAULT '',
+    schema_version INTEGER NOT NULL,
+    
+    events BIGINT NOT NULL DEFAULT 0,
+    first_seen TIMESTAMP WITH TIME ZONE NOT NULL,
+    last_seen TIMESTAMP WITH TIME ZONE NOT NULL,
+    
+    PRIMARY KEY (server_ip, plugin_version, schema_version)
+);
+
+-- ============================================================================
+-- INVALID EVENTS (Dead-lettered by the collector)
+-- ============================================================================
+
+CREATE TABLE invalid_events (
+    id BIGSERIAL PRIMARY KEY,
+    
+    -- Server the payload came from (verified ID, claimed server_ip or source IP)
+    server_ip VARCHAR(45) NOT NULL,
+    server_id VARCHAR(45),
+    source VARCHAR(64) NOT NULL,
+    
+    event_type VARCHAR(32),
+    reason TEXT NOT NULL,
+    
+    -- Raw bytes as received
+    payload BYTEA NOT NULL,
+    
+    received_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_invalid_events_server ON invalid_events(server_ip, received_at DESC);
+
+-- ============================================================================
+-- POISON MESSAGES (Messages the processor gave up on)
+-- ============================================================================
+
+CREATE TABLE poison_messages (
+    id BIGSERIAL PRIMARY KEY,
+    
+    -- Original message
+    message_uuid VARCHAR(64) NOT NULL,
+    topic VARCHAR(64) NOT NULL,
+    payload BYTEA NOT NULL,
+    metadata JSONB NOT NULL DEFAULT '{}',
+    
+    -- Why processing failed, outermost error first
+    error_chain JSONB NOT NULL DEFAULT '[]',
+    attempts INTEGER NOT NULL,
+    
+    -- quarantined, requeued or discarded
+    status VARCHAR(16) NOT NULL DEFAULT 'quarantined',
+    quarantined_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    resolved_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_poison_messages_status ON poison_messages(status, quarantined_at DESC);
+
 -- ============================================================================
 -- KILLS (Detailed kill log)
 -- ============================================================================
 
 CREATE TABLE kills (
     id BIGSERIAL PRIMARY KEY,
-    event_id BIGINT REFERENCES events(id) ON DELETE CASCADE,
+    event_id BIGINT UNIQUE REFERENCES events(id) ON DELETE CASCADE,
     match_id BIGINT REFERENCES matches(id) ON DELETE CASCADE,
     
     -- Players
@@ -190,7 +287,7 @@ CREATE TABLE kills (
 
 CREATE TABLE airshots (
     id BIGSERIAL PRIMARY KEY,
-    event_id BIGINT REFERENCES events(id) ON DELETE CASCADE,
+    event_id BIGINT UNIQUE REFERENCES events(id) ON DELETE CASCADE,
     match_id BIGINT REFERENCES matches(id) ON DELETE CASCADE,
     
     player_id BIGINT NOT NULL REFERENCES players(id) ON DELETE CASCADE,
@@ -213,7 +310,7 @@ CREATE TABLE airshots (
 
 CREATE TABLE deflects (
     id BIGSERIAL PRIMARY KEY,
-    event_id BIGINT REFERENCES events(id) ON DELETE CASCADE,
+    event_id BIGINT UNIQUE REFERENCES events(id) ON DELETE CASCADE,
     match_id BIGINT REFERENCES matches(id) ON DELETE CASCADE,
     
     player_id BIGINT NOT NULL REFERENCES players(id) ON DELETE CASCADE,
@@ -482,7 +579,11 @@ ON CONFLICT (steam_id) DO NOTHING;
 
 COMMENT ON TABLE players IS 'Player profiles and aggregate statistics';
 COMMENT ON TABLE matches IS 'Match records with server and timing information';
-COMMENT ON TABLE events IS 'Raw event log from game servers';
+COMMENT ON TABLE player_sessions IS 'Time players spend on each server, from spawn to disconnect';
+COMMENT ON TABLE events IS 'Raw event log from game servers, one row per event (see event_key)';
+COMMENT ON TABLE server_versions IS 'Plugin and payload schema versions seen per server';
+COMMENT ON TABLE invalid_events IS 'Payloads rejected by collector validation';
+COMMENT ON TABLE poison_messages IS 'Messages quarantined after the processor exhausted its retries';
 COMMENT ON TABLE kills IS 'Detailed kill records with weapon and position data';
 COMMENT ON TABLE airshots IS 'Airshot achievements';
 COMMENT ON TABLE deflects IS 'Deflect events (airblast and dodgeball)';